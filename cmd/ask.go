@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"sync"
+
+	"perplexity-cli/pkg/config"
+	"perplexity-cli/pkg/perplexity"
+)
+
+// asker sends single requests to a model with the configured parameters and
+// totals their token usage. It is safe for concurrent use.
+type asker struct {
+	cfg    *config.Config
+	model  string
+	client *perplexity.Client
+
+	mu       sync.Mutex
+	requests int
+	usage    perplexity.Usage
+}
+
+// newAsker returns an asker sending requests to model
+func newAsker(cfg *config.Config, model string) *asker {
+	clientConfig := perplexity.DefaultConfig(cfg.APIKey)
+	clientConfig.Model = model
+	return &asker{cfg: cfg, model: model, client: perplexity.NewClientWithConfig(clientConfig)}
+}
+
+// ask sends prompt after the configured system prompt followed by system,
+// without web search when noSearch is set
+func (a *asker) ask(system, prompt string, noSearch bool) (*perplexity.ParsedResponse, error) {
+	var messages []perplexity.Message
+	if system = joinSystemPrompt(a.cfg.SystemPrompt, system); system != "" {
+		messages = append(messages, perplexity.Message{Role: "system", Content: system})
+	}
+	messages = append(messages, perplexity.Message{Role: "user", Content: prompt})
+
+	parsed, _, err := a.send(messages, noSearch)
+	return parsed, err
+}
+
+// send sends messages, without web search when noSearch is set, and returns
+// the parsed response with the usage of the request
+func (a *asker) send(messages []perplexity.Message, noSearch bool) (*perplexity.ParsedResponse, perplexity.Usage, error) {
+	req := newRunRequest(a.cfg, a.model, messages)
+	req.DisableSearch = noSearch
+	resp, err := a.client.CreateCompletionWithRequest(req)
+	if err != nil {
+		return nil, perplexity.Usage{}, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.requests++
+	a.usage.Add(resp.Usage)
+	return perplexity.ParseResponse(resp), resp.Usage, nil
+}
+
+// totals returns the number of requests sent and their total usage
+func (a *asker) totals() (int, perplexity.Usage) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.requests, a.usage
+}
+
+// newRunRequest returns a request sending messages to model with the
+// configured parameters
+func newRunRequest(cfg *config.Config, model string, messages []perplexity.Message) *perplexity.ChatCompletionRequest {
+	return &perplexity.ChatCompletionRequest{
+		Model:               model,
+		Messages:            messages,
+		MaxTokens:           cfg.MaxTokens,
+		Temperature:         cfg.Temperature,
+		TopP:                cfg.TopP,
+		SearchMode:          cfg.SearchMode,
+		SearchDomainFilter:  cfg.SearchDomainFilter,
+		SearchRecencyFilter: cfg.SearchRecencyFilter,
+		ReasoningEffort:     cfg.ReasoningEffort,
+		WebSearchOptions:    perplexity.NewWebSearchOptions(cfg.SearchContextSize),
+	}
+}
+
+// joinSystemPrompt returns the configured system prompt followed by prompt,
+// either of which may be empty
+func joinSystemPrompt(configured, prompt string) string {
+	switch {
+	case prompt == "":
+		return configured
+	case configured == "":
+		return prompt
+	}
+	return configured + "\n\n" + prompt
+}
@@ -0,0 +1,274 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"perplexity-cli/pkg/batch"
+	"perplexity-cli/pkg/config"
+	"perplexity-cli/pkg/conversation"
+	"perplexity-cli/pkg/ui"
+)
+
+// progressBarWidth is the number of cells in the batch progress bar
+const progressBarWidth = 30
+
+var (
+	batchOutput  string
+	batchWorkers int
+	batchRate    int
+	batchRestart bool
+)
+
+var batchCmd = &cobra.Command{
+	Use:   "batch <queries-file>",
+	Short: "Answer many queries from a file",
+	Long: `Answer every query in a file, several at a time, and write the results as
+JSON lines.
+
+The file holds one query per line; blank lines and lines starting with #
+are skipped. Files ending in .jsonl or .ndjson hold a JSON object per line
+with a "query" and an optional "id", which is copied to the result.
+
+Each result line has the query's index, id, query, answer, citations (the
+search results the answer's [n] markers refer to), token usage, or an error
+if the query failed. Results are written in input order to --output, by
+default the queries file with its extension replaced by .results.jsonl.
+
+Running the same command again resumes: queries already answered in the
+output file are skipped, and failed ones are asked again. --restart asks
+every query again. Ctrl+C stops starting new queries, waits for those in
+flight and keeps their results.
+
+Up to --workers requests run at once, and no more than --rate start per
+minute. Progress is shown on stderr.
+
+Examples:
+  pplx batch questions.txt
+  pplx batch packages.jsonl --workers 8 --rate 100 -o answers.jsonl
+  pplx batch questions.txt -o - | jq -r .answer`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if batchWorkers < 1 {
+			return fmt.Errorf("--workers must be at least 1")
+		}
+		if batchRate < 0 {
+			return fmt.Errorf("--rate must not be negative")
+		}
+
+		// Load configuration
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("configuration error: %w", err)
+		}
+
+		model, _ := cmd.Flags().GetString("model")
+		if model == "" {
+			model = cfg.Model
+		}
+
+		return runBatch(cfg, model, args[0])
+	},
+}
+
+// runBatch answers the queries in path and writes the results
+func runBatch(cfg *config.Config, model, path string) error {
+	items, err := batch.ReadItems(path)
+	if err != nil {
+		return err
+	}
+
+	output := batchOutput
+	if output == "" {
+		output = strings.TrimSuffix(path, filepath.Ext(path)) + ".results.jsonl"
+	}
+	toStdout := output == "-"
+	if filepath.Clean(output) == filepath.Clean(path) {
+		return fmt.Errorf("the output file must not be the queries file")
+	}
+
+	// Results of an earlier run are kept unless restarting
+	earlier := make(map[int]batch.Result)
+	if !toStdout && !batchRestart {
+		if earlier, err = batch.LoadResults(output); err != nil {
+			return err
+		}
+	}
+	pending := batch.Pending(items, earlier)
+	if skipped := len(items) - len(pending); skipped > 0 {
+		fmt.Fprintf(os.Stderr, "Resuming: %d of %d queries already answered in %s\n", skipped, len(items), output)
+	}
+	if len(pending) == 0 {
+		fmt.Fprintf(os.Stderr, "%s All %d queries are answered in %s (use --restart to ask them again)\n", ui.Green("✓"), len(items), output)
+		return nil
+	}
+
+	var w io.Writer = os.Stdout
+	if !toStdout {
+		flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if len(earlier) > 0 {
+			flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		}
+		file, err := os.OpenFile(output, flags, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open output: %w", err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	api := newAsker(cfg, model)
+	opts := conversation.OptionsFromConfig(cfg, model)
+
+	ask := func(item batch.Item) batch.Result {
+		result := batch.Result{Index: item.Index, ID: item.ID, Query: item.Query}
+		messages := conversation.Build(nil, item.Query, opts).Messages
+		parsed, usage, err := api.send(messages, false)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+
+		result.Answer = parsed.Content
+		result.Citations = parsed.SearchResults
+		result.Usage = &usage
+		return result
+	}
+
+	bar := newProgressBar(os.Stderr)
+	started := time.Now()
+	results, err := batch.Run(ctx, pending, ask, w, batch.Options{
+		Workers:  batchWorkers,
+		Rate:     batchRate,
+		Progress: bar.update,
+	})
+	bar.finish()
+	if err != nil {
+		return err
+	}
+
+	// Appended results follow the earlier ones; put them back in input order
+	if len(earlier) > 0 {
+		if err := batch.WriteResults(output, mergeResults(items, earlier, results)); err != nil {
+			return err
+		}
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Failed() {
+			failed++
+		}
+	}
+	_, usage := api.totals()
+
+	where := "in " + output
+	if toStdout {
+		where = "on stdout"
+	}
+	fmt.Fprintf(os.Stderr, "%s Answered %d of %d queries in %s, %d tokens; results %s\n", ui.Green("✓"),
+		len(results)-failed, len(pending), formatLatency(time.Since(started)), usage.TotalTokens, where)
+
+	switch {
+	case ctx.Err() != nil:
+		return fmt.Errorf("interrupted with %d of %d queries left; run the same command again to resume",
+			len(pending)-len(results), len(pending))
+	case failed > 0 && toStdout:
+		return fmt.Errorf("%d of %d queries failed", failed, len(pending))
+	case failed > 0:
+		return fmt.Errorf("%d of %d queries failed; run the same command again to retry them", failed, len(pending))
+	}
+	return nil
+}
+
+// mergeResults returns the latest result of each item: from this run, or
+// from the earlier run if it was for the same query
+func mergeResults(items []batch.Item, earlier map[int]batch.Result, latest []batch.Result) []batch.Result {
+	byIndex := make(map[int]batch.Result, len(latest))
+	for _, result := range latest {
+		byIndex[result.Index] = result
+	}
+
+	var merged []batch.Result
+	for _, item := range items {
+		if result, ok := byIndex[item.Index]; ok {
+			merged = append(merged, result)
+		} else if result, ok := earlier[item.Index]; ok && result.Query == item.Query {
+			merged = append(merged, result)
+		}
+	}
+	return merged
+}
+
+// progressBar shows batch progress on a terminal, redrawing one line; on
+// other outputs it prints a line at every tenth of the queries
+type progressBar struct {
+	w        io.Writer
+	terminal bool
+	started  time.Time
+	// reported is the last tenth printed when not on a terminal
+	reported int
+	drawn    bool
+}
+
+func newProgressBar(f *os.File) *progressBar {
+	return &progressBar{w: f, terminal: term.IsTerminal(int(f.Fd())), started: time.Now()}
+}
+
+// update shows the progress after a result
+func (b *progressBar) update(p batch.Progress) {
+	elapsed := time.Since(b.started)
+	status := fmt.Sprintf("%d/%d", p.Done, p.Total)
+	if p.Failed > 0 {
+		status += fmt.Sprintf("  %d failed", p.Failed)
+	}
+	status += "  " + formatDuration(elapsed)
+	if p.Done < p.Total {
+		remaining := elapsed / time.Duration(p.Done) * time.Duration(p.Total-p.Done)
+		status += fmt.Sprintf("  ~%s left", formatDuration(remaining))
+	}
+
+	if !b.terminal {
+		if tenth := p.Done * 10 / p.Total; tenth > b.reported || p.Done == p.Total {
+			b.reported = tenth
+			fmt.Fprintln(b.w, status)
+		}
+		return
+	}
+
+	filled := p.Done * progressBarWidth / p.Total
+	bar := strings.Repeat("█", filled) + strings.Repeat("░", progressBarWidth-filled)
+	fmt.Fprintf(b.w, "\r\033[K%s %s", bar, status)
+	b.drawn = true
+}
+
+// finish ends the progress line
+func (b *progressBar) finish() {
+	if b.drawn {
+		fmt.Fprintln(b.w)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(batchCmd)
+	batchCmd.Flags().StringVarP(&batchOutput, "output", "o", "", "Results file, or - for stdout (default: <queries-file>.results.jsonl)")
+	batchCmd.Flags().IntVarP(&batchWorkers, "workers", "w", 4, "Number of requests run at once")
+	batchCmd.Flags().IntVar(&batchRate, "rate", 50, "Most requests started per minute (0 for no limit)")
+	batchCmd.Flags().BoolVar(&batchRestart, "restart", false, "Ignore results in the output file and ask every query again")
+}
@@ -0,0 +1,395 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"perplexity-cli/pkg/config"
+	"perplexity-cli/pkg/conversation"
+	"perplexity-cli/pkg/perplexity"
+	"perplexity-cli/pkg/session"
+	"perplexity-cli/pkg/ui"
+)
+
+const (
+	// compareMinColumnWidth is the narrowest answer column of the
+	// side-by-side layout; narrower terminals get the stacked layout
+	compareMinColumnWidth = 40
+	compareColumnGap      = 3
+	// compareTag is added to sessions saved by 'pplx compare'
+	compareTag = "compare"
+)
+
+var (
+	compareModels []string
+	compareLayout string
+	compareSave   bool
+)
+
+var compareCmd = &cobra.Command{
+	Use:   "compare [query]",
+	Short: "Ask several models the same query and compare their answers",
+	Long: `Send the same query to several models at once and print their answers
+side by side, or one after another, followed by each model's latency and
+token usage and the overlap of the domains their answers cite.
+
+The configured system prompt and request settings apply to every model.
+Piped input is combined with the query as with 'pplx run'.
+
+--layout chooses how answers are printed:
+  auto     side by side when the terminal fits a column per model (default)
+  side     side by side
+  stacked  one after another; always used when output is piped
+
+--save records each answer as its own session, tagged "compare" and linked
+to the others; 'pplx session show' lists the linked sessions, and each can
+be continued with 'pplx -c'.
+
+Examples:
+  pplx compare --models sonar,sonar-pro,sonar-reasoning "Is Rust faster than Go?"
+  pplx compare --models sonar,sonar-pro --layout stacked "Explain CRDTs"
+  git diff | pplx compare --models sonar-pro,sonar-reasoning-pro --save "Review this change"`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if compareLayout != "auto" && compareLayout != "side" && compareLayout != "stacked" {
+			return fmt.Errorf("--layout must be auto, side or stacked, not %q", compareLayout)
+		}
+
+		var models []string
+		for _, model := range compareModels {
+			if model = strings.TrimSpace(model); model != "" && !slices.Contains(models, model) {
+				models = append(models, model)
+			}
+		}
+		if len(models) < 2 {
+			return fmt.Errorf("--models needs at least two models, such as --models sonar,sonar-pro")
+		}
+
+		// Load configuration
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("configuration error: %w", err)
+		}
+
+		var query, input string
+		if len(args) > 0 {
+			query = args[0]
+		}
+		if stdinPiped() {
+			if input, err = readStdin(cfg.StdinMaxSize); err != nil {
+				return err
+			}
+		}
+		query = combineStdin(query, input, "context")
+		if query == "" {
+			return fmt.Errorf("query is required\n\nUsage: pplx compare --models sonar,sonar-pro \"<query>\"")
+		}
+
+		return runCompare(cfg, models, query)
+	},
+}
+
+// comparison is one model's answer to the compared query
+type comparison struct {
+	model   string
+	parsed  *perplexity.ParsedResponse
+	usage   perplexity.Usage
+	latency time.Duration
+	err     error
+}
+
+// runCompare asks every model query concurrently and prints the answers
+// and how they compare
+func runCompare(cfg *config.Config, models []string, query string) error {
+	fmt.Fprintf(os.Stderr, "Asking %s...\n", strings.Join(models, ", "))
+
+	results := make([]comparison, len(models))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, model := range models {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = askModel(cfg, model, query)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err := results[i].err; err != nil {
+				fmt.Fprintf(os.Stderr, "  %s %s failed: %v\n", ui.Red("✗"), model, err)
+			} else {
+				fmt.Fprintf(os.Stderr, "  %s %s (%s)\n", ui.Green("✓"), model, formatLatency(results[i].latency))
+			}
+		}()
+	}
+	wg.Wait()
+	fmt.Fprintln(os.Stderr)
+
+	if width, ok := sideBySideWidth(len(results)); ok {
+		printSideBySide(cfg, results, width)
+	} else {
+		printStacked(cfg, results)
+	}
+	fmt.Println()
+	printCompareStats(results)
+	printDomainOverlap(results)
+
+	var answered []comparison
+	for _, r := range results {
+		if r.err == nil {
+			answered = append(answered, r)
+		}
+	}
+	if compareSave && len(answered) > 0 {
+		if err := saveComparison(cfg, query, answered); err != nil {
+			return err
+		}
+	}
+
+	if failed := len(results) - len(answered); failed > 0 {
+		return fmt.Errorf("%d of %d models failed", failed, len(results))
+	}
+	return nil
+}
+
+// askModel sends query to model with the configured system prompt and
+// request settings
+func askModel(cfg *config.Config, model, query string) comparison {
+	messages := conversation.Build(nil, query, conversation.OptionsFromConfig(cfg, model)).Messages
+	started := time.Now()
+	parsed, usage, err := newAsker(cfg, model).send(messages, false)
+	return comparison{model: model, parsed: parsed, usage: usage, latency: time.Since(started), err: err}
+}
+
+// sideBySideWidth returns the terminal width when the answers of n models
+// are to be printed side by side
+func sideBySideWidth(n int) (int, bool) {
+	if compareLayout == "stacked" || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return 0, false
+	}
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width <= 0 {
+		return 0, false
+	}
+	fits := (width-compareColumnGap*(n-1))/n >= compareMinColumnWidth
+	return width, fits || compareLayout == "side"
+}
+
+// printStacked prints the answers one after another
+func printStacked(cfg *config.Config, results []comparison) {
+	for i, r := range results {
+		if i > 0 {
+			fmt.Println()
+		}
+		ui.PrintSeparator(ui.Cyan)
+		fmt.Printf("%s  %s\n", ui.Bold(r.model), compareDetails(r))
+		ui.PrintSeparator(ui.Cyan)
+		if r.err != nil {
+			fmt.Println(ui.Red("Error: " + r.err.Error()))
+			continue
+		}
+		if cfg.ShowReasoning {
+			ui.PrintReasoning(r.parsed.Reasoning)
+		}
+		fmt.Println(ui.RenderMarkdownAlways(perplexity.FormatWithReferences(r.parsed), cfg))
+	}
+}
+
+// printSideBySide prints the answers in columns filling width
+func printSideBySide(cfg *config.Config, results []comparison, width int) {
+	n := len(results)
+	columnWidth := max((width-compareColumnGap*(n-1))/n, 10)
+	renderer, err := ui.NewRenderer(ui.ResolveStyle(cfg), columnWidth-2)
+	if err != nil {
+		renderer = nil
+	}
+
+	column := lipgloss.NewStyle().Width(columnWidth).MaxWidth(columnWidth)
+	gap := strings.Repeat(" ", compareColumnGap)
+
+	var columns []string
+	for i, r := range results {
+		var body string
+		if r.err != nil {
+			body = ui.Red("Error: " + r.err.Error())
+		} else {
+			body = perplexity.FormatWithReferences(r.parsed)
+			if renderer != nil {
+				if rendered, err := renderer.Render(body); err == nil {
+					body = rendered
+				}
+			}
+			if cfg.ShowReasoning && r.parsed.Reasoning != "" {
+				body = ui.Faint("Reasoning:\n"+r.parsed.Reasoning) + "\n\n" + strings.Trim(body, "\n")
+			}
+		}
+
+		header := ui.Bold(r.model) + "\n" + compareDetails(r) + "\n" + ui.Cyan(strings.Repeat("─", columnWidth))
+		if i > 0 {
+			columns = append(columns, gap)
+		}
+		columns = append(columns, column.Render(header+"\n"+strings.Trim(body, "\n")))
+	}
+	fmt.Println(lipgloss.JoinHorizontal(lipgloss.Top, columns...))
+}
+
+// compareDetails summarizes the latency and usage of an answer
+func compareDetails(r comparison) string {
+	if r.err != nil {
+		return fmt.Sprintf("failed after %s", formatLatency(r.latency))
+	}
+	return fmt.Sprintf("%s, %d tokens", formatLatency(r.latency), r.usage.TotalTokens)
+}
+
+// printCompareStats prints a table of each model's latency, token usage
+// and number of sources
+func printCompareStats(results []comparison) {
+	modelWidth := len("Model")
+	for _, r := range results {
+		modelWidth = max(modelWidth, len(r.model))
+	}
+
+	fmt.Printf("%-*s  %8s  %7s  %10s  %7s  %7s\n", modelWidth, "Model", "Latency", "Prompt", "Completion", "Total", "Sources")
+	for _, r := range results {
+		if r.err != nil {
+			fmt.Printf("%-*s  %8s  %s\n", modelWidth, r.model, formatLatency(r.latency), ui.Red("failed"))
+			continue
+		}
+		fmt.Printf("%-*s  %8s  %7d  %10d  %7d  %7d\n", modelWidth, r.model, formatLatency(r.latency),
+			r.usage.PromptTokens, r.usage.CompletionTokens, r.usage.TotalTokens, len(r.parsed.SearchResults))
+	}
+}
+
+// printDomainOverlap prints which models cite each domain, the domains all
+// of them cite and the overlap of each pair as the share of their domains
+// both cite
+func printDomainOverlap(results []comparison) {
+	var answered []comparison
+	domains := make(map[string][]string)
+	var order []string
+	for _, r := range results {
+		if r.err != nil {
+			continue
+		}
+		answered = append(answered, r)
+		for _, domain := range perplexity.Domains(r.parsed.SearchResults) {
+			if _, ok := domains[domain]; !ok {
+				order = append(order, domain)
+			}
+			domains[domain] = append(domains[domain], r.model)
+		}
+	}
+	if len(order) == 0 {
+		fmt.Println("\nNo sources cited.")
+		return
+	}
+
+	// Domains cited by more models first
+	sort.SliceStable(order, func(i, j int) bool { return len(domains[order[i]]) > len(domains[order[j]]) })
+	domainWidth := 0
+	for _, domain := range order {
+		domainWidth = max(domainWidth, len(domain))
+	}
+
+	fmt.Println("\nCited domains:")
+	shared := 0
+	for _, domain := range order {
+		models := domains[domain]
+		if len(models) == len(answered) {
+			shared++
+		}
+		fmt.Printf("  %-*s  %s\n", domainWidth, domain, strings.Join(models, ", "))
+	}
+	if len(answered) < 2 {
+		return
+	}
+
+	fmt.Printf("\nCited by all %d models: %d of %d domains\n", len(answered), shared, len(order))
+	var pairs []string
+	for i := range answered {
+		for j := i + 1; j < len(answered); j++ {
+			a := perplexity.Domains(answered[i].parsed.SearchResults)
+			b := perplexity.Domains(answered[j].parsed.SearchResults)
+			pairs = append(pairs, fmt.Sprintf("%s & %s %s", answered[i].model, answered[j].model, domainOverlap(a, b)))
+		}
+	}
+	fmt.Printf("Overlap: %s\n", strings.Join(pairs, ", "))
+}
+
+// domainOverlap formats the share of the domains in a or b that both cite
+func domainOverlap(a, b []string) string {
+	union := len(a)
+	both := 0
+	for _, domain := range b {
+		if slices.Contains(a, domain) {
+			both++
+		} else {
+			union++
+		}
+	}
+	if union == 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%d%%", both*100/union)
+}
+
+// saveComparison saves each answer as a session, tagged and linked to the
+// others
+func saveComparison(cfg *config.Config, query string, results []comparison) error {
+	sessionManager, err := session.NewManager()
+	if err != nil {
+		return fmt.Errorf("failed to create session manager: %w", err)
+	}
+	defer sessionManager.Close()
+
+	sessions := make([]*session.Session, len(results))
+	for i, r := range results {
+		s := session.NewSession(r.model, query)
+		s.AddMessage("user", query)
+		s.AddReply(perplexity.StripReferences(r.parsed.Content), r.parsed.Reasoning)
+		s.AddTags(compareTag)
+		maybeAutoTitle(cfg, s)
+		sessions[i] = s
+	}
+
+	// Sessions get their final IDs when first saved, which the links need
+	for _, s := range sessions {
+		if err := sessionManager.Save(s); err != nil {
+			return fmt.Errorf("failed to save session: %w", err)
+		}
+	}
+	session.LinkCompared(sessions)
+
+	saved := make([]string, len(sessions))
+	for i, s := range sessions {
+		if err := sessionManager.Save(s); err != nil {
+			return fmt.Errorf("failed to save session: %w", err)
+		}
+		saved[i] = fmt.Sprintf("[%s] %s", s.ShortID, s.Metadata.Model)
+	}
+	if len(saved) == 1 {
+		fmt.Fprintf(os.Stderr, "\n%s Saved as session %s\n", ui.Green("✓"), saved[0])
+	} else {
+		fmt.Fprintf(os.Stderr, "\n%s Saved as linked sessions: %s\n", ui.Green("✓"), strings.Join(saved, ", "))
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(compareCmd)
+	compareCmd.Flags().StringSliceVarP(&compareModels, "models", "m", nil, "Comma-separated models to compare (at least two)")
+	compareCmd.Flags().StringVar(&compareLayout, "layout", "auto", "How answers are printed: auto, side or stacked")
+	compareCmd.Flags().BoolVar(&compareSave, "save", false, "Save each answer as a session linked to the others")
+	compareCmd.MarkFlagRequired("models")
+}
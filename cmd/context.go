@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+
+	"perplexity-cli/pkg/config"
+	"perplexity-cli/pkg/conversation"
+	"perplexity-cli/pkg/session"
+)
+
+// buildContext builds the request context for answering input in s. With
+// context_strategy: summarize, history that does not fit is folded into the
+// session's context summary using title_model; the extended summary is
+// returned for the caller to store on s, or nil if it did not change.
+// Notices about left out or summarized history are passed to notify.
+func buildContext(cfg *config.Config, s *session.Session, input string, notify func(string)) (*conversation.Context, *conversation.Summary) {
+	if cfg.ContextStrategy != conversation.StrategySummarize {
+		ctx := conversation.Build(s.Messages, input, conversation.OptionsFromConfig(cfg, s.Metadata.Model))
+		reportTruncation(ctx, notify)
+		return ctx, nil
+	}
+
+	opts := conversation.SessionOptions(cfg, s)
+	client := newTitleClient(cfg)
+	summarize := func(previous string, messages []session.SessionMessage) (string, error) {
+		return session.GenerateContextSummary(client, cfg.TitleModel, previous, messages)
+	}
+
+	ctx, summary, err := conversation.BuildCompacted(s.Messages, input, opts, summarize)
+	if err != nil {
+		notify(fmt.Sprintf("Warning: %v", err))
+	}
+	reportTruncation(ctx, notify)
+
+	if summary == opts.Summary {
+		return ctx, nil
+	}
+
+	notify(fmt.Sprintf("(Context: %d earlier message(s) are now summarized)", summary.Messages))
+	return ctx, &summary
+}
+
+// reportTruncation tells the user when older messages were left out of the
+// request context
+func reportTruncation(ctx *conversation.Context, notify func(string)) {
+	if !ctx.Truncated() {
+		return
+	}
+
+	limit := fmt.Sprintf("~%d token budget", ctx.Budget)
+	if ctx.MessageLimited {
+		limit = "context_messages limit"
+	}
+	notify(fmt.Sprintf("(Context: %d older message(s) left out, sending %d; %s)", ctx.Dropped, ctx.Sent, limit))
+}
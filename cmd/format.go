@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+)
+
+// count formats n with noun, adding an s unless n is 1
+func count(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// formatLatency formats a request duration to a tenth of a second
+func formatLatency(d time.Duration) string {
+	return fmt.Sprintf("%.1fs", d.Seconds())
+}
+
+// formatDuration formats a duration to the second, as 1m05s or 42s
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+	return fmt.Sprintf("%dm%02ds", int(d.Minutes()), int(d.Seconds())%60)
+}
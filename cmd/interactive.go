@@ -2,24 +2,92 @@ package cmd
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 
+	"perplexity-cli/pkg/attach"
 	"perplexity-cli/pkg/config"
+	"perplexity-cli/pkg/conversation"
+	"perplexity-cli/pkg/lineedit"
 	"perplexity-cli/pkg/perplexity"
 	"perplexity-cli/pkg/session"
 	"perplexity-cli/pkg/ui"
 )
 
 const (
-	MaxContextMessages = 20
-	ExitCommand        = "/q"
-	AltExitCommand     = "/quit"
+	ExitCommand    = "/q"
+	AltExitCommand = "/quit"
+	ForkCommand    = "/fork"
+	TitleCommand   = "/title"
+	TagCommand     = "/tag"
+	HelpCommand    = "/help"
 )
 
+// errExit is returned by a command to end the interactive loop
+var errExit = errors.New("exit")
+
+// slashCommand is a command available in interactive mode
+type slashCommand struct {
+	name    string
+	aliases []string
+	// usage describes the arguments, e.g. "<key> <value>"
+	usage string
+	// summary is the one-line description listed by /help
+	summary string
+	// help is the longer description shown by /help <command>
+	help string
+	// minArgs and maxArgs bound the number of arguments; maxArgs < 0
+	// means no limit
+	minArgs int
+	maxArgs int
+	run     func(is *InteractiveSession, args []string) error
+}
+
+// slashCommands lists the registered commands in registration order, and
+// commandIndex maps names and aliases to them
+var (
+	slashCommands []*slashCommand
+	commandIndex  = map[string]*slashCommand{}
+)
+
+// registerCommand makes a slash command available in interactive mode
+func registerCommand(c *slashCommand) {
+	for _, name := range append([]string{c.name}, c.aliases...) {
+		if _, exists := commandIndex[name]; exists {
+			panic("slash command registered twice: " + name)
+		}
+		commandIndex[name] = c
+	}
+	slashCommands = append(slashCommands, c)
+}
+
+// lookupCommand finds a command by name or alias, with or without the
+// leading slash
+func lookupCommand(name string) (*slashCommand, bool) {
+	if !strings.HasPrefix(name, "/") {
+		name = "/" + name
+	}
+	c, ok := commandIndex[name]
+	return c, ok
+}
+
+// synopsis returns the command name followed by its usage
+func (c *slashCommand) synopsis() string {
+	if c.usage == "" {
+		return c.name
+	}
+	return c.name + " " + c.usage
+}
+
 // InteractiveSession manages an interactive conversation
 type InteractiveSession struct {
 	client         *perplexity.Client
@@ -27,26 +95,110 @@ type InteractiveSession struct {
 	session        *session.Session
 	config         *config.Config
 	reader         *bufio.Reader
+	editor         *lineedit.Editor
 	firstMessage   bool
+	// model is used for requests and for new sessions; a resumed session
+	// keeps the model it was created with
+	model string
+	// scripted prints bare responses like 'pplx run' and never prompts;
+	// format is the output format they are printed in
+	scripted bool
+	format   string
+	// notify receives notices about the request context and saving, such
+	// as left out history or a save conflict; nil prints them to stderr
+	notify func(string)
+
+	// lastContext is the context of the latest request, and usage sums
+	// the token usage reported for requests made in this run
+	lastContext *conversation.Context
+	usage       perplexity.Usage
+	requests    int
+
+	// attachments are the files attached with /attach or --file, sent
+	// with the next message
+	attachments []attach.File
+
+	// replacing is the exchange removed by /retry or /edit, kept as
+	// alternates of the exchange that replaces it
+	replacing []session.SessionMessage
+
+	// unstored is the latest message recorded without the contents of its
+	// attachments (store_attachments: false), kept so /retry and /edit can
+	// send the files again
+	unstored *unstoredMessage
+
+	// mu guards session against the interrupt handler saving concurrently
+	mu sync.Mutex
+	// savedCount is the number of messages the session had when it was
+	// last saved, used to re-apply new messages after a save conflict
+	savedCount int
+}
+
+// unstoredMessage is a message recorded with placeholders for its attached
+// files: recorded is the message as recorded, and input the text typed
+type unstoredMessage struct {
+	recorded    string
+	input       string
+	attachments []attach.File
 }
 
 // NewInteractiveSession creates a new interactive session
 func NewInteractiveSession(cfg *config.Config) (*InteractiveSession, error) {
-	clientConfig := perplexity.DefaultConfig(cfg.APIKey)
-	clientConfig.Model = cfg.Model
-
 	sessionManager, err := session.NewManager()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create session manager: %w", err)
 	}
 
+	return newInteractiveSession(cfg, sessionManager, cfg.Model), nil
+}
+
+// ResumeInteractiveSession creates an interactive session continuing s with
+// the model it was created with
+func ResumeInteractiveSession(cfg *config.Config, sessionManager *session.Manager, s *session.Session) *InteractiveSession {
+	is := newInteractiveSession(cfg, sessionManager, s.Metadata.Model)
+	is.session = s
+	is.savedCount = len(s.Messages)
+	is.firstMessage = false
+	return is
+}
+
+func newInteractiveSession(cfg *config.Config, sessionManager *session.Manager, model string) *InteractiveSession {
+	clientConfig := perplexity.DefaultConfig(cfg.APIKey)
+	clientConfig.Model = model
+
+	editor := lineedit.New(os.Stdin, os.Stdout)
+	editor.History = loadInputHistory(cfg)
+
 	return &InteractiveSession{
 		client:         perplexity.NewClientWithConfig(clientConfig),
 		sessionManager: sessionManager,
 		config:         cfg,
-		reader:         bufio.NewReader(os.Stdin),
+		reader:         editor.Reader(),
+		editor:         editor,
 		firstMessage:   true,
-	}, nil
+		model:          model,
+	}
+}
+
+// loadInputHistory loads the input history from ~/.pplx/history. With
+// encrypt_sessions set, history is kept in memory only so messages are not
+// written to disk in plain text.
+func loadInputHistory(cfg *config.Config) *lineedit.History {
+	if cfg.EncryptSessions {
+		return lineedit.NewHistory(lineedit.DefaultHistorySize)
+	}
+
+	history, err := lineedit.LoadHistory(getHistoryPath(), lineedit.DefaultHistorySize)
+	if err != nil {
+		session.Debugf("Failed to load input history: %v", err)
+		return lineedit.NewHistory(lineedit.DefaultHistorySize)
+	}
+	return history
+}
+
+// getHistoryPath returns the path of the input history file
+func getHistoryPath() string {
+	return filepath.Join(config.GetConfigDir(), "history")
 }
 
 // Run starts the interactive REPL
@@ -58,18 +210,22 @@ func (is *InteractiveSession) Run() error {
 	go func() {
 		<-sigChan
 		fmt.Println("\nReceived interrupt signal. Saving session...")
-		is.saveSession()
+		is.save(nil)
 		fmt.Println("Goodbye!")
 		os.Exit(0)
 	}()
 
-	fmt.Println("Welcome to PPLX Interactive Mode!")
-	fmt.Printf("Model: %s | Type '%s' or press Ctrl+C to exit\n\n", is.config.Model, ExitCommand)
+	if is.session != nil {
+		fmt.Printf("Continuing session [%s]\n", is.session.ShortID)
+	} else {
+		fmt.Println("Welcome to PPLX Interactive Mode!")
+	}
+	fmt.Printf("Model: %s | Type '%s' for commands, '%s' or Ctrl+C to exit\n\n", is.model, HelpCommand, ExitCommand)
 
 	// Main loop
 	for {
 		if err := is.processInput(); err != nil {
-			if err.Error() == "exit" {
+			if errors.Is(err, errExit) {
 				is.saveSession()
 				fmt.Println("Goodbye!")
 				return nil
@@ -86,11 +242,16 @@ func (is *InteractiveSession) processInput() error {
 		ui.PrintSeparator(ui.Cyan)
 	}
 
-	// Display prompt
-	fmt.Print("You: ")
-
-	// Read input
-	input, err := is.reader.ReadString('\n')
+	// Read input; end of input (Ctrl+D or a closed pipe) and Ctrl+C on an
+	// empty line exit
+	prompt := "You: "
+	if n := len(is.attachments); n > 0 {
+		prompt = fmt.Sprintf("You [%d attached]: ", n)
+	}
+	input, err := is.editor.ReadLine(prompt)
+	if errors.Is(err, io.EOF) || errors.Is(err, lineedit.ErrInterrupted) {
+		return errExit
+	}
 	if err != nil {
 		return fmt.Errorf("failed to read input: %w", err)
 	}
@@ -98,128 +259,395 @@ func (is *InteractiveSession) processInput() error {
 	// Trim whitespace and newlines
 	input = strings.TrimSpace(input)
 
-	// Check for exit command
-	if input == ExitCommand || input == AltExitCommand {
-		return fmt.Errorf("exit")
-	}
-
 	// Skip empty input
 	if input == "" {
 		return nil
 	}
 
-	// Initialize session on first message
-	if is.session == nil {
-		is.session = session.NewSession(is.config.Model, input)
+	// A leading // sends a message that starts with a slash
+	if strings.HasPrefix(input, "//") {
+		return is.ask(input[1:])
+	}
+
+	if strings.HasPrefix(input, "/") {
+		return is.runCommand(input)
+	}
+
+	return is.ask(input)
+}
+
+// runCommand parses and runs a slash command. Unknown commands are errors
+// rather than prompts.
+func (is *InteractiveSession) runCommand(input string) error {
+	fields, err := splitArgs(input)
+	if err != nil {
+		return err
+	}
+
+	c, ok := lookupCommand(fields[0])
+	if !ok {
+		return fmt.Errorf("unknown command %s (type %s for a list, or start the message with // to send it)", fields[0], HelpCommand)
+	}
+
+	args := fields[1:]
+	if len(args) < c.minArgs || (c.maxArgs >= 0 && len(args) > c.maxArgs) {
+		return fmt.Errorf("usage: %s", c.synopsis())
+	}
+	return c.run(is, args)
+}
+
+// splitArgs splits a command line into fields separated by spaces. Single
+// or double quotes group words into one field.
+func splitArgs(input string) ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	var quote rune
+	inField := false
+
+	for _, r := range input {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			field.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inField = true
+		case r == ' ' || r == '\t':
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		default:
+			field.WriteRune(r)
+			inField = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inField {
+		fields = append(fields, field.String())
 	}
+	return fields, nil
+}
 
-	// Build message history for API (limit to last N messages)
-	apiMessages := is.buildAPIMessages(input)
+// RunOnce reads a single message, answers it and returns without entering
+// the REPL loop
+func (is *InteractiveSession) RunOnce() error {
+	if !is.firstMessage {
+		fmt.Println()
+		ui.PrintSeparator(ui.Cyan)
+	}
+	input, err := is.editor.ReadLine("You: ")
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, lineedit.ErrInterrupted) {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
 
-	// Make API request
-	req := &perplexity.ChatCompletionRequest{
-		Model:           is.config.Model,
-		Messages:        apiMessages,
-		MaxTokens:       is.config.MaxTokens,
-		Temperature:     is.config.Temperature,
-		TopP:            is.config.TopP,
-		SearchMode:      is.config.SearchMode,
-		ReasoningEffort: is.config.ReasoningEffort,
+	input = strings.TrimSpace(input)
+	if input == "" {
+		fmt.Println("No message provided. Exiting.")
+		return nil
 	}
 
-	resp, err := is.client.CreateCompletionWithRequest(req)
+	return is.ask(input)
+}
+
+// Send answers a single message without reading from the terminal, for
+// scripts. The response is printed like 'pplx run' prints it, save conflicts
+// are resolved without prompting, and save failures are returned.
+func (is *InteractiveSession) Send(input string) error {
+	is.scripted = true
+	is.reader = nil
+	return is.ask(input)
+}
+
+// ask sends input with the conversation context, displays the response and
+// saves the session
+func (is *InteractiveSession) ask(input string) error {
+	// Attached files are sent as code blocks before the message
+	is.startSession(input)
+	message := attach.Message(is.attachments, input)
+
+	resp, err := is.client.CreateCompletionWithRequest(is.newRequest(message))
 	if err != nil {
 		return fmt.Errorf("API request failed: %w", err)
 	}
 
+	is.addUsage(resp.Usage)
+
 	// Parse response
 	parsed := perplexity.ParseResponse(resp)
-
-	// Add messages to session
-	is.session.AddMessage("user", input)
-
-	// Add assistant response (without references for clean context)
-	cleanContent := perplexity.StripReferences(parsed.Content)
-	is.session.AddMessage("assistant", cleanContent)
+	if len(is.attachments) > 0 && !is.config.StoreAttachments {
+		message = attach.Placeholder(is.attachments, input)
+		is.unstored = &unstoredMessage{recorded: message, input: input, attachments: is.attachments}
+	}
+	is.recordExchange(message, parsed)
+	is.recordAttachments()
 
 	// Display response
-	fmt.Println()
-	ui.PrintSeparator(ui.Magenta)
-	fmt.Print("PPLX: ")
-	formatted := perplexity.FormatWithReferences(parsed)
-	rendered, err := ui.RenderMarkdown(formatted, is.config)
-	if err != nil {
-		fmt.Println(formatted)
+	if is.scripted {
+		if err := printResponse(parsed, &resp.Usage, is.config, is.format); err != nil {
+			return err
+		}
 	} else {
-		fmt.Println(rendered)
+		fmt.Println()
+		ui.PrintSeparator(ui.Magenta)
+		if is.config.ShowReasoning {
+			ui.PrintReasoning(parsed.Reasoning)
+		}
+		fmt.Print("PPLX: ")
+		formatted := perplexity.FormatWithReferences(parsed)
+		rendered, err := ui.RenderMarkdown(formatted, is.config)
+		if err != nil {
+			fmt.Println(formatted)
+		} else {
+			fmt.Println(rendered)
+		}
+		fmt.Println()
 	}
-	fmt.Println()
-
-	// Mark first message as complete
-	is.firstMessage = false
 
 	// Auto-save session
 	if err := is.saveSession(); err != nil {
+		if is.scripted {
+			return err
+		}
 		session.Debugf("Failed to auto-save session: %v", err)
 	}
 
+	// Title the session after the first exchange if enabled, now that the
+	// response is shown
+	is.titleSession()
+
 	return nil
 }
 
-// buildAPIMessages builds the message array for API request
-// It strips references from previous assistant messages before sending to API
-func (is *InteractiveSession) buildAPIMessages(newInput string) []perplexity.Message {
+// newRequest builds the API request for input with the conversation
+// context, starting the session on the first message
+func (is *InteractiveSession) newRequest(input string) *perplexity.ChatCompletionRequest {
+	is.startSession(input)
+
+	// Build message history for API within the context budget
+	ctx, summary := buildContext(is.config, is.session, input, is.notice)
+	if summary != nil {
+		is.mu.Lock()
+		is.session.SetContextSummary(summary.Text, summary.Messages)
+		is.mu.Unlock()
+	}
+	is.lastContext = ctx
+
+	return &perplexity.ChatCompletionRequest{
+		Model:               is.model,
+		Messages:            ctx.Messages,
+		MaxTokens:           is.config.MaxTokens,
+		Temperature:         is.config.Temperature,
+		TopP:                is.config.TopP,
+		SearchMode:          is.config.SearchMode,
+		SearchDomainFilter:  is.config.SearchDomainFilter,
+		SearchRecencyFilter: is.config.SearchRecencyFilter,
+		ReasoningEffort:     is.config.ReasoningEffort,
+		WebSearchOptions:    perplexity.NewWebSearchOptions(is.config.SearchContextSize),
+	}
+}
+
+// startSession starts the session on the first message, with query as its
+// initial query
+func (is *InteractiveSession) startSession(query string) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
 	if is.session == nil {
-		return []perplexity.Message{
-			{Role: "user", Content: newInput},
+		is.session = session.NewSession(is.model, query)
+	}
+}
+
+// recordAttachments records the paths of the attached files in the session
+// once they have been sent, and clears them
+func (is *InteractiveSession) recordAttachments() {
+	if len(is.attachments) == 0 {
+		return
+	}
+
+	is.mu.Lock()
+	is.session.AddAttachments(attach.Paths(is.attachments)...)
+	is.mu.Unlock()
+	is.attachments = nil
+}
+
+// recordExchange adds input and its response to the session
+func (is *InteractiveSession) recordExchange(input string, parsed *perplexity.ParsedResponse) {
+	// Add messages to session
+	is.mu.Lock()
+	is.session.AddMessage("user", input)
+
+	// Add assistant response (without references for clean context), with
+	// its reasoning kept apart so it is not sent on later turns
+	cleanContent := perplexity.StripReferences(parsed.Content)
+	is.session.AddReply(cleanContent, parsed.Reasoning)
+	if is.replacing != nil {
+		is.session.KeepAlternates(is.replacing)
+		is.replacing = nil
+	}
+	is.mu.Unlock()
+
+	// Mark first message as complete
+	is.firstMessage = false
+}
+
+// titleSession titles the session after its first exchange when auto_title
+// is enabled, and saves it. The title is generated without holding mu, so
+// it is only applied if the session still has no title.
+func (is *InteractiveSession) titleSession() {
+	is.mu.Lock()
+	var id string
+	var messages []session.SessionMessage
+	if is.session != nil && wantsTitle(is.config, is.session) {
+		id, messages = is.session.ID, slices.Clone(is.session.Messages)
+	}
+	is.mu.Unlock()
+	if messages == nil {
+		return
+	}
+
+	title := autoTitle(is.config, messages)
+	if title == "" {
+		return
+	}
+
+	is.mu.Lock()
+	titled := is.session != nil && is.session.ID == id && is.session.Metadata.Title == ""
+	if titled {
+		is.session.SetTitle(title)
+	}
+	is.mu.Unlock()
+
+	if titled {
+		if err := is.store(nil); err != nil {
+			session.Debugf("Failed to save session title: %v", err)
 		}
 	}
+}
+
+// addUsage adds the token usage of a request to the totals for this run
+func (is *InteractiveSession) addUsage(usage perplexity.Usage) {
+	is.usage.Add(usage)
+	is.requests++
+}
+
+// setTitle sets or clears the title of the current session
+func (is *InteractiveSession) setTitle(title string) error {
+	if is.session == nil {
+		return fmt.Errorf("start a conversation before setting a title")
+	}
+
+	is.session.SetTitle(title)
+	if title == "" {
+		fmt.Println("Title cleared.")
+	} else {
+		fmt.Printf("Title set to %q.\n", is.session.Metadata.Title)
+	}
+	fmt.Println()
+	return is.saveSession()
+}
+
+// addTags adds space-separated tags to the current session
+func (is *InteractiveSession) addTags(arg string) error {
+	if is.session == nil {
+		return fmt.Errorf("start a conversation before adding tags")
+	}
 
-	// Get last N messages for context
-	messages := is.session.GetLastMessages(MaxContextMessages)
-	apiMessages := make([]perplexity.Message, 0, len(messages)+1)
+	tags := strings.Fields(arg)
+	if len(tags) == 0 {
+		fmt.Printf("Tags: %s\n\n", formatTagsOrNone(is.session.Metadata.Tags))
+		return nil
+	}
+
+	is.session.AddTags(tags...)
+	fmt.Printf("Tags: %s\n\n", formatTagsOrNone(is.session.Metadata.Tags))
+	return is.saveSession()
+}
 
-	// Convert session messages to perplexity messages, stripping references
-	for _, msg := range messages {
-		content := msg.Content
+// forkSession branches the current session at the given message index
+// (default: the latest message) and switches the conversation to the fork
+func (is *InteractiveSession) forkSession(arg string) error {
+	if is.session == nil || len(is.session.Messages) == 0 {
+		return fmt.Errorf("nothing to fork yet")
+	}
 
-		// Strip references section from assistant messages
-		if msg.Role == "assistant" {
-			content = perplexity.StripReferences(content)
+	at := len(is.session.Messages)
+	if arg != "" {
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return fmt.Errorf("invalid message index: %s", arg)
 		}
+		at = n
+	}
 
-		apiMessages = append(apiMessages, perplexity.Message{
-			Role:    msg.Role,
-			Content: content,
-		})
+	if err := is.saveSession(); err != nil {
+		return err
 	}
 
-	// Add the new user message if not already in history
-	if len(messages) == 0 || messages[len(messages)-1].Content != newInput {
-		apiMessages = append(apiMessages, perplexity.Message{
-			Role:    "user",
-			Content: newInput,
-		})
+	fork, err := is.sessionManager.Fork(is.session, at)
+	if err != nil {
+		return fmt.Errorf("failed to fork session: %w", err)
 	}
 
-	return apiMessages
+	fmt.Printf("Forked [%s] at message %d. Now continuing in [%s].\n\n", is.session.ShortID, at, fork.ShortID)
+	is.mu.Lock()
+	is.session = fork
+	is.savedCount = len(fork.Messages)
+	is.mu.Unlock()
+	return nil
 }
 
-// saveSession saves the current session
+// saveSession saves the current session, asking the user how to resolve a
+// conflict if the session was modified by another process
 func (is *InteractiveSession) saveSession() error {
+	return is.save(is.reader)
+}
+
+// save saves the current session, printing a warning if it fails. If
+// reader is nil, conflicts are resolved without prompting by reloading and
+// appending the new messages.
+func (is *InteractiveSession) save(reader *bufio.Reader) error {
+	if err := is.store(reader); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save session: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+// store saves the current session like save, without printing
+func (is *InteractiveSession) store(reader *bufio.Reader) error {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+
 	if is.session == nil {
 		return nil
 	}
 
-	if err := is.sessionManager.Save(is.session); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: failed to save session: %v\n", err)
+	saved, err := saveResolvingConflicts(is.sessionManager, is.session, is.savedCount, reader, is.notice)
+	if err != nil {
 		return err
 	}
 
+	is.session = saved
+	is.savedCount = len(saved.Messages)
 	session.Debugf("Session auto-saved: %s", is.session.ID)
 	return nil
 }
 
+// notice reports a notice to notify, or on stderr so the output of scripted
+// runs stays clean
+func (is *InteractiveSession) notice(text string) {
+	if is.notify != nil {
+		is.notify(text)
+		return
+	}
+	fmt.Fprintln(os.Stderr, ui.Yellow(text))
+}
+
 // runInteractive is the entry point called from root.go
 func runInteractive() {
 	// Load configuration
@@ -0,0 +1,747 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"perplexity-cli/pkg/attach"
+	"perplexity-cli/pkg/config"
+	"perplexity-cli/pkg/conversation"
+	"perplexity-cli/pkg/lineedit"
+	"perplexity-cli/pkg/session"
+	"perplexity-cli/pkg/ui"
+)
+
+// defaultHistoryMessages is the number of messages /history prints by default
+const defaultHistoryMessages = 10
+
+func init() {
+	registerCommand(&slashCommand{
+		name:    HelpCommand,
+		usage:   "[command]",
+		summary: "List commands, or show help for one command",
+		maxArgs: 1,
+		run:     (*InteractiveSession).showHelp,
+	})
+	registerCommand(&slashCommand{
+		name:    ExitCommand,
+		aliases: []string{AltExitCommand, "/exit"},
+		summary: "Save the session and exit",
+		run: func(is *InteractiveSession, args []string) error {
+			return errExit
+		},
+	})
+	registerCommand(&slashCommand{
+		name:    "/compose",
+		usage:   "[text]",
+		summary: "Write a message in $EDITOR and send it",
+		help:    "The editor starts with the given text. Saving an empty file sends nothing.",
+		maxArgs: -1,
+		run:     (*InteractiveSession).composeMessage,
+	})
+	registerCommand(&slashCommand{
+		name:    "/attach",
+		usage:   "[path...]",
+		summary: "Attach files to the next message",
+		help: "Paths may be files, globs such as 'docs/*.md', or directories, which are expanded " +
+			"leaving out files ignored by .gitignore, binary files and files over the size limit. " +
+			"The files are sent as code blocks before your next message. " +
+			"Without arguments, lists the attached files.",
+		maxArgs: -1,
+		run:     (*InteractiveSession).attachFiles,
+	})
+	registerCommand(&slashCommand{
+		name:    "/detach",
+		summary: "Remove the files attached to the next message",
+		run: func(is *InteractiveSession, args []string) error {
+			is.attachments = nil
+			fmt.Println("Attachments cleared.")
+			fmt.Println()
+			return nil
+		},
+	})
+	registerCommand(&slashCommand{
+		name:    "/model",
+		usage:   "[name]",
+		summary: "Show or switch the model",
+		help: "Without an argument, prints the current model and the known models. " +
+			"The new model is used for the following messages and is stored on the session, " +
+			"so continuing it later uses the same model.",
+		maxArgs: 1,
+		run:     (*InteractiveSession).switchModel,
+	})
+	registerCommand(&slashCommand{
+		name:    "/set",
+		usage:   "[key] [value]",
+		summary: "Show or change a setting for this run",
+		help: "Without arguments, prints the settings that can be changed. " +
+			"Changes apply until pplx exits and are not written to the config file. " +
+			"Example: /set temperature 0.5",
+		maxArgs: -1,
+		run:     (*InteractiveSession).changeSetting,
+	})
+	registerCommand(&slashCommand{
+		name:    "/reasoning",
+		usage:   "[on|off]",
+		summary: "Show or hide the reasoning of reasoning models",
+		help: "Reasoning models such as sonar-reasoning think before they answer. The reasoning is hidden " +
+			"unless turned on here, with --show-reasoning or with show_reasoning in the config file, " +
+			"and is printed dimmed before the answer. It is never sent back to the model as context.",
+		maxArgs: 1,
+		run: func(is *InteractiveSession, args []string) error {
+			status, err := setShowReasoning(is.config, args)
+			if err != nil {
+				return err
+			}
+			fmt.Println(status)
+			fmt.Println()
+			return nil
+		},
+	})
+	registerCommand(&slashCommand{
+		name:    "/info",
+		summary: "Show the session, context size and token usage",
+		run:     (*InteractiveSession).showInfo,
+	})
+	registerCommand(&slashCommand{
+		name:    "/history",
+		usage:   "[n]",
+		summary: "Print the last n messages (default 10)",
+		maxArgs: 1,
+		run:     (*InteractiveSession).showHistory,
+	})
+	registerCommand(&slashCommand{
+		name:    "/retry",
+		summary: "Ask the last message again, replacing its response",
+		help: "The previous response is kept as an alternate of the new one; " +
+			"see them with 'pplx session show --alternates'.",
+		run: (*InteractiveSession).retry,
+	})
+	registerCommand(&slashCommand{
+		name:    "/edit",
+		summary: "Edit the last message in $EDITOR and ask it again",
+		help: "The previous message and its response are kept as an alternate of the edited message; " +
+			"see them with 'pplx session show --alternates'. " +
+			"Before the first message, /edit writes a new message like /compose.",
+		run: (*InteractiveSession).editLast,
+	})
+	registerCommand(&slashCommand{
+		name:    "/undo",
+		summary: "Remove the last message and its response",
+		help:    "The removed exchange is discarded, along with any alternates it had.",
+		run:     (*InteractiveSession).undo,
+	})
+	registerCommand(&slashCommand{
+		name:    "/new",
+		summary: "Save the session and start a new one",
+		run:     (*InteractiveSession).startNewSession,
+	})
+	registerCommand(&slashCommand{
+		name:    "/clear",
+		summary: "Clear the screen",
+		run: func(is *InteractiveSession, args []string) error {
+			fmt.Print("\033[H\033[2J")
+			return nil
+		},
+	})
+	registerCommand(&slashCommand{
+		name:    "/save",
+		usage:   "[name]",
+		summary: "Save the session now, optionally giving it a name",
+		help:    "Named sessions can be continued with 'pplx -c <name>' and 'pplx run --session <name>'.",
+		maxArgs: 1,
+		run:     (*InteractiveSession).saveNamed,
+	})
+	registerCommand(&slashCommand{
+		name:    "/export",
+		usage:   "[file]",
+		summary: "Write the conversation to a Markdown or JSON file",
+		help:    "The default file is <short id>.md in the current directory. A .json file gets the full session.",
+		maxArgs: 1,
+		run:     (*InteractiveSession).export,
+	})
+	registerCommand(&slashCommand{
+		name:    ForkCommand,
+		usage:   "[n]",
+		summary: "Branch the conversation after message n (default: the latest)",
+		maxArgs: 1,
+		run: func(is *InteractiveSession, args []string) error {
+			return is.forkSession(strings.Join(args, " "))
+		},
+	})
+	registerCommand(&slashCommand{
+		name:    TitleCommand,
+		usage:   "[title]",
+		summary: "Set the session title (no argument clears it)",
+		maxArgs: -1,
+		run: func(is *InteractiveSession, args []string) error {
+			return is.setTitle(strings.Join(args, " "))
+		},
+	})
+	registerCommand(&slashCommand{
+		name:    TagCommand,
+		usage:   "[tag...]",
+		summary: "Add tags to the session (no argument prints them)",
+		maxArgs: -1,
+		run: func(is *InteractiveSession, args []string) error {
+			return is.addTags(strings.Join(args, " "))
+		},
+	})
+}
+
+// showHelp lists the commands, or describes one command in detail
+func (is *InteractiveSession) showHelp(args []string) error {
+	if len(args) == 1 {
+		c, ok := lookupCommand(args[0])
+		if !ok {
+			return fmt.Errorf("unknown command %s", args[0])
+		}
+
+		fmt.Printf("%s\n  %s\n", c.synopsis(), c.summary)
+		if c.help != "" {
+			fmt.Printf("  %s\n", c.help)
+		}
+		if len(c.aliases) > 0 {
+			fmt.Printf("  Aliases: %s\n", strings.Join(c.aliases, ", "))
+		}
+		fmt.Println()
+		return nil
+	}
+
+	fmt.Println("Commands:")
+	for _, c := range slashCommands {
+		fmt.Printf("  %-20s %s\n", c.synopsis(), c.summary)
+	}
+	fmt.Printf("\nType '%s <command>' for details. Start a message with // to send text beginning with /.\n\n", HelpCommand)
+	return nil
+}
+
+// composeMessage opens the user's editor and sends the saved text
+func (is *InteractiveSession) composeMessage(args []string) error {
+	message, err := lineedit.EditExternal(strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+
+	if message == "" {
+		fmt.Println("Empty message, nothing sent.")
+		fmt.Println()
+		return nil
+	}
+
+	fmt.Println(message)
+	if err := is.editor.History.Add(message); err != nil {
+		session.Debugf("Failed to record input history: %v", err)
+	}
+	return is.ask(message)
+}
+
+// attachFiles attaches files to the next message, or lists the attached
+// files without arguments
+func (is *InteractiveSession) attachFiles(args []string) error {
+	if len(args) == 0 {
+		if len(is.attachments) == 0 {
+			fmt.Println("No files attached.")
+		}
+		for _, f := range is.attachments {
+			fmt.Printf("  %s (%s, ~%d tokens)\n", f.Path, attach.FormatSize(f.Size), f.Tokens())
+		}
+		fmt.Println()
+		return nil
+	}
+
+	limits := attachLimits(is.config)
+	files, skipped, err := attach.Collect(args, limits)
+	if err != nil {
+		return err
+	}
+	merged := attach.Merge(is.attachments, files)
+	if err := attach.CheckBudget(merged, limits); err != nil {
+		return err
+	}
+	is.attachments = merged
+
+	for _, f := range files {
+		fmt.Printf("%s Attached %s (%s, ~%d tokens)\n", ui.Green("✓"), f.Path, attach.FormatSize(f.Size), f.Tokens())
+	}
+	printSkipped(os.Stdout, skipped)
+	if len(files) == 0 {
+		fmt.Println("No files attached.")
+	} else {
+		fmt.Println("The files are sent with your next message.")
+	}
+	fmt.Println()
+	return nil
+}
+
+// attachLimits returns the configured attachment limits
+func attachLimits(cfg *config.Config) attach.Limits {
+	return attach.Limits{MaxFileSize: int64(cfg.AttachMaxFileSize), MaxTokens: cfg.AttachMaxTokens}
+}
+
+// printSkipped lists files found in directories that were not attached
+func printSkipped(w io.Writer, skipped []attach.Skipped) {
+	for _, s := range skipped {
+		fmt.Fprintf(w, "  Skipped %s (%s)\n", s.Path, s.Reason)
+	}
+}
+
+// switchModel prints or changes the model used for requests
+func (is *InteractiveSession) switchModel(args []string) error {
+	if len(args) == 0 {
+		fmt.Printf("Model: %s\nKnown models: %s\n\n", is.model, strings.Join(knownModels(), ", "))
+		return nil
+	}
+
+	model := args[0]
+	if _, ok := conversation.ModelContextTokens[model]; !ok {
+		fmt.Printf("Note: %s is not a known model; requests may fail.\n", model)
+	}
+
+	is.setModel(model)
+	fmt.Printf("Model set to %s.\n\n", model)
+
+	if is.session == nil {
+		return nil
+	}
+	return is.saveSession()
+}
+
+// setModel switches the model used for later requests and records it on
+// the session
+func (is *InteractiveSession) setModel(model string) {
+	is.model = model
+	if is.session == nil {
+		return
+	}
+	is.mu.Lock()
+	is.session.Metadata.Model = model
+	is.mu.Unlock()
+}
+
+// knownModels returns the models with a known context window, sorted
+func knownModels() []string {
+	models := make([]string, 0, len(conversation.ModelContextTokens))
+	for model := range conversation.ModelContextTokens {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	return models
+}
+
+// setting is a configuration value /set can change
+type setting struct {
+	get func(cfg *config.Config) string
+	set func(cfg *config.Config, value string) error
+}
+
+// settings lists the configuration values /set can change, by config key
+var settings = map[string]setting{
+	"temperature":           floatSetting(func(c *config.Config) *float64 { return &c.Temperature }),
+	"top_p":                 floatSetting(func(c *config.Config) *float64 { return &c.TopP }),
+	"max_tokens":            intSetting(func(c *config.Config) *int { return &c.MaxTokens }),
+	"search_mode":           stringSetting(func(c *config.Config) *string { return &c.SearchMode }),
+	"search_domain_filter":  listSetting(func(c *config.Config) *[]string { return &c.SearchDomainFilter }),
+	"search_recency_filter": stringSetting(func(c *config.Config) *string { return &c.SearchRecencyFilter }),
+	"search_context_size":   stringSetting(func(c *config.Config) *string { return &c.SearchContextSize }),
+	"reasoning_effort":      stringSetting(func(c *config.Config) *string { return &c.ReasoningEffort }),
+	"system_prompt":         stringSetting(func(c *config.Config) *string { return &c.SystemPrompt }),
+	"context_tokens":        intSetting(func(c *config.Config) *int { return &c.ContextTokens }),
+	"context_messages":      intSetting(func(c *config.Config) *int { return &c.ContextMessages }),
+	"context_strategy":      stringSetting(func(c *config.Config) *string { return &c.ContextStrategy }),
+	"attach_max_tokens":     intSetting(func(c *config.Config) *int { return &c.AttachMaxTokens }),
+}
+
+func floatSetting(field func(*config.Config) *float64) setting {
+	return setting{
+		get: func(c *config.Config) string { return strconv.FormatFloat(*field(c), 'g', -1, 64) },
+		set: func(c *config.Config, value string) error {
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("%q is not a number", value)
+			}
+			*field(c) = v
+			return nil
+		},
+	}
+}
+
+func intSetting(field func(*config.Config) *int) setting {
+	return setting{
+		get: func(c *config.Config) string { return strconv.Itoa(*field(c)) },
+		set: func(c *config.Config, value string) error {
+			v, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%q is not a whole number", value)
+			}
+			*field(c) = v
+			return nil
+		},
+	}
+}
+
+func stringSetting(field func(*config.Config) *string) setting {
+	return setting{
+		get: func(c *config.Config) string { return *field(c) },
+		set: func(c *config.Config, value string) error {
+			*field(c) = value
+			return nil
+		},
+	}
+}
+
+// listSetting is a list of values, given separated by commas or spaces
+func listSetting(field func(*config.Config) *[]string) setting {
+	return setting{
+		get: func(c *config.Config) string { return strings.Join(*field(c), ",") },
+		set: func(c *config.Config, value string) error {
+			*field(c) = strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+			return nil
+		},
+	}
+}
+
+// setShowReasoning turns showing reasoning on or off for the rest of the
+// run as /reasoning asks, and describes the resulting state
+func setShowReasoning(cfg *config.Config, args []string) (string, error) {
+	if len(args) == 1 {
+		switch strings.ToLower(args[0]) {
+		case "on":
+			cfg.ShowReasoning = true
+		case "off":
+			cfg.ShowReasoning = false
+		default:
+			return "", fmt.Errorf("expected on or off, not %q", args[0])
+		}
+	}
+
+	if cfg.ShowReasoning {
+		return "Reasoning is shown.", nil
+	}
+	return "Reasoning is hidden.", nil
+}
+
+// changeSetting prints the settings or changes one for the rest of the run.
+// Invalid values are rejected and leave the setting unchanged.
+func (is *InteractiveSession) changeSetting(args []string) error {
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	if len(args) == 0 {
+		for _, key := range keys {
+			fmt.Printf("  %-20s %s\n", key, settings[key].get(is.config))
+		}
+		fmt.Println()
+		return nil
+	}
+
+	s, ok := settings[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown setting %s (one of: %s)", args[0], strings.Join(keys, ", "))
+	}
+	if len(args) == 1 {
+		fmt.Printf("%s = %s\n\n", args[0], s.get(is.config))
+		return nil
+	}
+
+	updated := *is.config
+	if err := s.set(&updated, strings.Join(args[1:], " ")); err != nil {
+		return fmt.Errorf("invalid %s: %w", args[0], err)
+	}
+	if err := updated.Validate(); err != nil {
+		return fmt.Errorf("invalid %s: %w", args[0], err)
+	}
+
+	*is.config = updated
+	fmt.Printf("%s set to %s for this run.\n\n", args[0], s.get(is.config))
+	return nil
+}
+
+// showInfo prints the current session, the size of the last request's
+// context and the token usage reported in this run
+func (is *InteractiveSession) showInfo(args []string) error {
+	if is.session == nil {
+		fmt.Println("Session: not started")
+	} else {
+		fmt.Printf("Session: [%s] %s%s\n", is.session.ShortID, is.session.ID, nameMarker(is.session.ToInfo()))
+		fmt.Printf("Messages: %d\n", len(is.session.Messages))
+	}
+	fmt.Printf("Model: %s\n", is.model)
+
+	if ctx := is.lastContext; ctx != nil {
+		fmt.Printf("Context: ~%d of %d tokens, %d history messages sent", ctx.Tokens, ctx.Budget, ctx.Sent)
+		if ctx.Dropped > 0 {
+			fmt.Printf(", %d left out", ctx.Dropped)
+		}
+		if ctx.Summarized > 0 {
+			fmt.Printf(", %d summarized", ctx.Summarized)
+		}
+		fmt.Println()
+	}
+
+	u := is.usage
+	fmt.Printf("Tokens used: %d prompt, %d completion, %d total over %d requests\n", u.PromptTokens, u.CompletionTokens, u.TotalTokens, is.requests)
+	if u.ReasoningTokens > 0 {
+		fmt.Printf("Reasoning tokens: %d\n", u.ReasoningTokens)
+	}
+	fmt.Println()
+	return nil
+}
+
+// showHistory prints the last messages of the session, one line each
+func (is *InteractiveSession) showHistory(args []string) error {
+	n := defaultHistoryMessages
+	if len(args) == 1 {
+		v, err := strconv.Atoi(args[0])
+		if err != nil || v < 1 {
+			return fmt.Errorf("invalid message count: %s", args[0])
+		}
+		n = v
+	}
+
+	if is.session == nil || len(is.session.Messages) == 0 {
+		fmt.Println("No messages yet.")
+		fmt.Println()
+		return nil
+	}
+
+	messages := is.session.Messages
+	start := max(len(messages)-n, 0)
+	for i, msg := range messages[start:] {
+		speaker := "You"
+		if msg.Role == "assistant" {
+			speaker = "PPLX"
+		}
+		line := strings.Join(strings.Fields(msg.Content), " ")
+		fmt.Printf("%3d. %s: %s\n", start+i+1, speaker, session.TruncateQuery(line, 100))
+	}
+	fmt.Println()
+	return nil
+}
+
+// removeLastExchange removes the latest message and its response from the
+// session and returns the removed message
+func (is *InteractiveSession) removeLastExchange() (string, error) {
+	if is.session == nil {
+		return "", fmt.Errorf("no messages yet")
+	}
+
+	is.mu.Lock()
+	removed, ok := is.session.RemoveLastExchange()
+	is.savedCount = min(is.savedCount, len(is.session.Messages))
+	is.mu.Unlock()
+
+	if !ok {
+		return "", fmt.Errorf("no messages yet")
+	}
+	return removed.Content, nil
+}
+
+// retry asks the last message again, replacing its response
+func (is *InteractiveSession) retry(args []string) error {
+	replaced := is.lastExchange()
+	recorded, err := is.removeLastExchange()
+	if err != nil {
+		return err
+	}
+
+	input, files := is.typedMessage(recorded)
+	is.attachments = attach.Merge(files, is.attachments)
+	fmt.Printf("Retrying: %s\n", session.TruncateQuery(input, 80))
+	return is.resend(input, replaced)
+}
+
+// editLast opens the last message in the user's editor and asks the edited
+// message in its place
+func (is *InteractiveSession) editLast(args []string) error {
+	replaced := is.lastExchange()
+	if replaced == nil {
+		return is.composeMessage(nil)
+	}
+
+	original, files := is.typedMessage(replaced[0].Content)
+	message, err := lineedit.EditExternal(original)
+	if err != nil {
+		return err
+	}
+
+	switch message {
+	case "":
+		fmt.Println("Empty message, nothing sent.")
+		fmt.Println()
+		return nil
+	case original:
+		fmt.Println("Message unchanged; use /retry to ask it again.")
+		fmt.Println()
+		return nil
+	}
+
+	if _, err := is.removeLastExchange(); err != nil {
+		return err
+	}
+	is.attachments = attach.Merge(files, is.attachments)
+	fmt.Println(message)
+	if err := is.editor.History.Add(message); err != nil {
+		session.Debugf("Failed to record input history: %v", err)
+	}
+	return is.resend(message, replaced)
+}
+
+// typedMessage returns the text typed for a recorded message and the files
+// attached to it, which are only returned if the session recorded
+// placeholders in place of their contents
+func (is *InteractiveSession) typedMessage(recorded string) (string, []attach.File) {
+	if is.unstored == nil || is.unstored.recorded != recorded {
+		return recorded, nil
+	}
+	return is.unstored.input, is.unstored.attachments
+}
+
+// lastExchange returns a copy of the latest message and its response
+func (is *InteractiveSession) lastExchange() []session.SessionMessage {
+	if is.session == nil {
+		return nil
+	}
+
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	return is.session.LastExchange()
+}
+
+// resend asks input in place of the replaced exchange, which was removed
+// from the session. The replaced messages are kept as alternates of the new
+// exchange, or restored if the request fails.
+func (is *InteractiveSession) resend(input string, replaced []session.SessionMessage) error {
+	is.replacing = replaced
+	err := is.ask(input)
+	if is.replacing != nil {
+		is.mu.Lock()
+		is.session.Messages = append(is.session.Messages, is.replacing...)
+		is.mu.Unlock()
+		is.replacing = nil
+	}
+	return err
+}
+
+// undo removes the last message and its response
+func (is *InteractiveSession) undo(args []string) error {
+	input, err := is.removeLastExchange()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Removed: %s\n\n", session.TruncateQuery(input, 80))
+	return is.saveSession()
+}
+
+// startNewSession saves the current session and starts an empty one
+func (is *InteractiveSession) startNewSession(args []string) error {
+	if err := is.saveSession(); err != nil {
+		return err
+	}
+
+	is.mu.Lock()
+	previous := is.session
+	is.session = nil
+	is.savedCount = 0
+	is.lastContext = nil
+	is.mu.Unlock()
+	is.firstMessage = true
+
+	if previous != nil {
+		fmt.Printf("Saved [%s]. ", previous.ShortID)
+	}
+	fmt.Println("Started a new conversation.")
+	fmt.Println()
+	return nil
+}
+
+// saveNamed saves the session now, giving it a name if one is passed
+func (is *InteractiveSession) saveNamed(args []string) error {
+	if is.session == nil {
+		return fmt.Errorf("nothing to save yet")
+	}
+
+	previous := is.session.Metadata.Name
+	if len(args) == 1 {
+		if err := is.sessionManager.CheckName(args[0], is.session.ID); err != nil {
+			return err
+		}
+		is.mu.Lock()
+		is.session.Metadata.Name = args[0]
+		is.mu.Unlock()
+	}
+
+	if err := is.saveSession(); err != nil {
+		// Another process took the name meanwhile; keep the old one so
+		// later saves still succeed
+		if errors.Is(err, session.ErrNameTaken) {
+			is.mu.Lock()
+			is.session.Metadata.Name = previous
+			is.mu.Unlock()
+		}
+		return err
+	}
+
+	fmt.Printf("%s Saved [%s]%s\n\n", ui.Green("✓"), is.session.ShortID, nameMarker(is.session.ToInfo()))
+	return nil
+}
+
+// export writes the conversation to a Markdown file, or the full session to
+// a JSON file
+func (is *InteractiveSession) export(args []string) error {
+	if is.session == nil || len(is.session.Messages) == 0 {
+		return fmt.Errorf("nothing to export yet")
+	}
+
+	path := is.session.ShortID + ".md"
+	if len(args) == 1 {
+		path = args[0]
+	}
+
+	var data []byte
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		var err error
+		data, err = json.MarshalIndent(is.session, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode session: %w", err)
+		}
+	} else {
+		data = []byte(sessionMarkdown(is.session))
+	}
+
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to export session: %w", err)
+	}
+
+	fmt.Printf("%s Exported [%s] to %s\n\n", ui.Green("✓"), is.session.ShortID, path)
+	return nil
+}
+
+// sessionMarkdown renders a session as a Markdown document
+func sessionMarkdown(s *session.Session) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", s.ToInfo().DisplayTitle())
+	fmt.Fprintf(&b, "- Session: %s (%s)\n", s.ShortID, s.ID)
+	fmt.Fprintf(&b, "- Model: %s\n", s.Metadata.Model)
+	fmt.Fprintf(&b, "- Created: %s\n", session.FormatSessionTime(s.Metadata.CreatedAt))
+
+	for _, msg := range s.Messages {
+		heading := "You"
+		if msg.Role == "assistant" {
+			heading = "PPLX"
+		}
+		fmt.Fprintf(&b, "\n## %s\n\n%s\n", heading, strings.TrimSpace(msg.Content))
+	}
+	return b.String()
+}
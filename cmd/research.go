@@ -0,0 +1,257 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"perplexity-cli/pkg/config"
+	"perplexity-cli/pkg/perplexity"
+	"perplexity-cli/pkg/research"
+	"perplexity-cli/pkg/session"
+	"perplexity-cli/pkg/ui"
+)
+
+const (
+	// maxResearchSteps caps --max-steps
+	maxResearchSteps = 20
+	// researchTag is added to sessions saved by 'pplx research'
+	researchTag = "research"
+
+	planPrompt = "You plan research on a topic. Break the topic into at most %d sub-questions that together " +
+		"cover it: background, the main aspects, alternatives or competing views, and recent developments " +
+		"where relevant. Each sub-question must make sense on its own and be answerable with a web search. " +
+		"Reply with only a JSON array of strings."
+
+	stepPrompt = "You research one sub-question of a larger topic. Answer it thoroughly and specifically, " +
+		"citing sources for each claim. Do not cover other parts of the topic."
+
+	summaryPrompt = "You write the summary of a research report. You are given a topic and the findings for " +
+		"each of its sub-questions. Write a concise summary that answers the topic as a whole, drawing " +
+		"conclusions across the findings and noting where they disagree. Keep citation markers such as [1] " +
+		"on the statements they support, and do not add citations or information that is not in the " +
+		"findings. Do not use headings."
+
+	summaryRequest = "Write the summary of the research report."
+)
+
+var (
+	researchMaxSteps int
+	researchWorkers  int
+)
+
+var researchCmd = &cobra.Command{
+	Use:   "research <topic>",
+	Short: "Research a topic in several steps and write a report",
+	Long: `Research a topic that one query would only partly cover.
+
+The model first plans the research as sub-questions, at most --max-steps of
+them. The sub-questions are then answered with web search, up to --workers
+at a time, and a summary is written from their answers. The report has the
+summary, a section per sub-question and one list of references, merged
+from all the answers without repeats.
+
+The plan, each answer and the report are saved in a new session tagged
+"research", so the work can be reviewed with 'pplx session show' and the
+report discussed further with 'pplx -c'. Progress is shown on stderr.
+
+Examples:
+  pplx research "State of WebAssembly outside the browser"
+  pplx research --max-steps 8 --workers 4 "Tradeoffs of Postgres logical replication"
+  pplx research --model sonar-pro "EU AI Act obligations for open-source models"`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if researchMaxSteps < 1 || researchMaxSteps > maxResearchSteps {
+			return fmt.Errorf("--max-steps must be between 1 and %d", maxResearchSteps)
+		}
+		if researchWorkers < 1 {
+			return fmt.Errorf("--workers must be at least 1")
+		}
+
+		topic := strings.TrimSpace(args[0])
+		if topic == "" {
+			return fmt.Errorf("a topic is required\n\nUsage: pplx research \"<topic>\"")
+		}
+
+		// Load configuration
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("configuration error: %w", err)
+		}
+
+		model, _ := cmd.Flags().GetString("model")
+		if model == "" {
+			model = cfg.Model
+		}
+
+		return runResearch(cfg, model, topic)
+	},
+}
+
+// researchRun researches a topic, recording each request and response in
+// a session
+type researchRun struct {
+	asker   *asker
+	session *session.Session
+
+	// mu serializes the progress of sub-questions answered at once
+	mu sync.Mutex
+}
+
+// runResearch plans topic as sub-questions, answers them and prints and
+// saves the report
+func runResearch(cfg *config.Config, model, topic string) error {
+	r := &researchRun{
+		asker:   newAsker(cfg, model),
+		session: session.NewSession(model, topic),
+	}
+	r.session.SetTitle("Research: " + topic)
+	r.session.AddTags(researchTag)
+	started := time.Now()
+
+	// Plan
+	fmt.Fprint(os.Stderr, "Planning...")
+	stepStarted := time.Now()
+	planRequest := "Topic: " + topic
+	plan, err := r.asker.ask(fmt.Sprintf(planPrompt, researchMaxSteps), planRequest, true)
+	if err != nil {
+		fmt.Fprintln(os.Stderr)
+		return fmt.Errorf("failed to plan the research: %w", err)
+	}
+	questions := research.ParsePlan(plan.Content, researchMaxSteps)
+	if len(questions) == 0 {
+		fmt.Fprintln(os.Stderr)
+		return fmt.Errorf("the plan has no sub-questions; the model replied:\n%s", plan.Content)
+	}
+	fmt.Fprintf(os.Stderr, " %s (%s)\n", count(len(questions), "sub-question"), formatLatency(time.Since(stepStarted)))
+	r.record(planRequest, plan.Content, plan.Reasoning)
+
+	// Answer the sub-questions
+	steps := r.answer(topic, questions)
+	answered := 0
+	for i, step := range steps {
+		prompt := stepRequest(topic, step.Question)
+		if step.Err != nil {
+			r.record(prompt, "Failed: "+step.Err.Error(), "")
+			continue
+		}
+		answered++
+		r.record(prompt, perplexity.FormatWithReferences(steps[i].Answer), steps[i].Answer.Reasoning)
+	}
+	if answered == 0 {
+		return r.fail(fmt.Errorf("none of the %s could be answered", count(len(steps), "sub-question")))
+	}
+
+	// Summarize, citing the merged sources
+	contents, sources := research.MergeAnswers(steps)
+	fmt.Fprint(os.Stderr, "Writing the report...")
+	stepStarted = time.Now()
+	summary, err := r.asker.ask(summaryPrompt, fmt.Sprintf("Topic: %s\n\nFindings:\n\n%s", topic, research.Findings(steps, contents)), true)
+	if err != nil {
+		fmt.Fprintln(os.Stderr)
+		return r.fail(fmt.Errorf("failed to write the summary: %w", err))
+	}
+	fmt.Fprintf(os.Stderr, " done (%s)\n", formatLatency(time.Since(stepStarted)))
+
+	// Renumber the sources in order of first citation, as the references
+	// list is numbered
+	body := research.Report(topic, perplexity.StripReferences(summary.Content), steps, contents)
+	final, cited := perplexity.MergeSources([]*perplexity.ParsedResponse{{Content: body, SearchResults: sources}})
+	report := &perplexity.ParsedResponse{
+		Content:       final[0],
+		Citations:     perplexity.ExtractCitations(final[0]),
+		SearchResults: cited,
+	}
+	r.record(summaryRequest, perplexity.FormatWithReferences(report), summary.Reasoning)
+
+	if err := r.save(); err != nil {
+		return err
+	}
+	requests, usage := r.asker.totals()
+	fmt.Fprintf(os.Stderr, "%s Researched %d of %s in %s, %d tokens (%s); saved as session [%s]\n", ui.Green("✓"),
+		answered, count(len(steps), "sub-question"), count(requests, "request"), usage.TotalTokens,
+		formatLatency(time.Since(started)), r.session.ShortID)
+	return printResponse(report, &usage, cfg, "markdown")
+}
+
+// answer researches the sub-questions, up to --workers at a time, and
+// returns them in order with their answers
+func (r *researchRun) answer(topic string, questions []string) []research.Step {
+	steps := make([]research.Step, len(questions))
+	fmt.Fprintf(os.Stderr, "Researching %s:\n", count(len(questions), "sub-question"))
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, researchWorkers)
+	var done int
+	for i, question := range questions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			started := time.Now()
+			answer, err := r.asker.ask(stepPrompt, stepRequest(topic, question), false)
+			steps[i] = research.Step{Question: question, Answer: answer, Err: err}
+
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			done++
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "  %s [%d/%d] %s: %v\n", ui.Red("✗"), done, len(questions), question, err)
+			} else {
+				fmt.Fprintf(os.Stderr, "  %s [%d/%d] %s (%s)\n", ui.Green("✓"), done, len(questions), question, formatLatency(time.Since(started)))
+			}
+		}()
+	}
+	wg.Wait()
+	return steps
+}
+
+// stepRequest is the message asking a sub-question of topic
+func stepRequest(topic, question string) string {
+	return fmt.Sprintf("Topic: %s\n\nSub-question: %s", topic, question)
+}
+
+// record adds a request and its response, with the reasoning given before
+// it, to the session as an exchange
+func (r *researchRun) record(prompt, response, reasoning string) {
+	r.session.AddMessage("user", prompt)
+	r.session.AddReply(response, reasoning)
+}
+
+// fail saves the work done before err, so the answers already paid for
+// are kept, and returns err saying where they are
+func (r *researchRun) fail(err error) error {
+	if saveErr := r.save(); saveErr != nil {
+		return err
+	}
+	return fmt.Errorf("%w; the work so far is saved as session [%s]", err, r.session.ShortID)
+}
+
+// save saves the session
+func (r *researchRun) save() error {
+	sessionManager, err := session.NewManager()
+	if err != nil {
+		return fmt.Errorf("failed to create session manager: %w", err)
+	}
+	defer sessionManager.Close()
+
+	if err := sessionManager.Save(r.session); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(researchCmd)
+	researchCmd.Flags().IntVar(&researchMaxSteps, "max-steps", 5, fmt.Sprintf("Most sub-questions researched (1-%d)", maxResearchSteps))
+	researchCmd.Flags().IntVarP(&researchWorkers, "workers", "w", 3, "Sub-questions researched at once")
+}
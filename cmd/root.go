@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -13,6 +14,12 @@ var cfgFile string
 var shortcutContinue string
 var shortcutListLimit int
 var shortcutSearchQuery string
+var (
+	shortcutOnce      bool
+	shortcutStdin     bool
+	shortcutNoHistory bool
+	shortcutFormat    string
+)
 
 var rootCmd = &cobra.Command{
 	Use:   "pplx",
@@ -36,10 +43,21 @@ Examples:
 
 	Shortcuts:
   pplx -c [id]           Continue a session (same as: pplx session continue [id])
+  pplx -c [id] --once    Send one message to a session and exit
+  pplx -c [id] [message] Send a message to a session without prompting
+  pplx -c [id] --format json [message]
+                         Print the response as JSON, like pplx run --format json
   pplx -l [limit]        List recent sessions (same as: pplx session list -l [limit])
   pplx -s [query]        Search sessions (same as: pplx session search [query])
 
 Note: Shortcuts only work at the root level and cannot be combined with session commands.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		// Only -c takes positional arguments: the message to send
+		if shortcutContinue == "" && len(args) > 0 {
+			return fmt.Errorf("unknown command %q for %q", args[0], cmd.CommandPath())
+		}
+		return nil
+	},
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 		isSessionCommand := len(args) > 0 && args[0] == "session"
 
@@ -57,7 +75,14 @@ Note: Shortcuts only work at the root level and cannot be combined with session
 	Run: func(cmd *cobra.Command, args []string) {
 		// Handle shortcut -sc (continue session)
 		if shortcutContinue != "" {
-			if err := continueSession(shortcutContinue); err != nil {
+			opts := continueOptions{
+				message:   strings.Join(args, " "),
+				once:      shortcutOnce,
+				stdin:     shortcutStdin,
+				noHistory: shortcutNoHistory,
+				format:    shortcutFormat,
+			}
+			if err := continueSession(shortcutContinue, opts); err != nil {
 				fmt.Fprintf(os.Stderr, "\033[31mError:\033[0m %v\n", err)
 				os.Exit(1)
 			}
@@ -83,23 +108,7 @@ Note: Shortcuts only work at the root level and cannot be combined with session
 				os.Exit(1)
 			}
 
-			if len(sessions) == 0 {
-				fmt.Println("No sessions found.")
-				fmt.Println("Start a conversation with 'pplx' or run a query with 'pplx run \"<query>\"'")
-				return
-			}
-
-			fmt.Printf("Recent sessions (showing %d of %d total):\n\n", len(sessions), len(sessions))
-
-			for i, info := range sessions {
-				fmt.Printf("%d. [%s] %s\n", i+1, info.ShortID, session.FormatSessionTime(info.CreatedAt))
-				fmt.Printf("   %s\n", session.TruncateQuery(info.InitialQuery, 60))
-				fmt.Printf("   (%d messages)\n", info.MessageCount)
-
-				if i < len(sessions)-1 {
-					fmt.Println()
-				}
-			}
+			printSessionList(sessions, false)
 			return
 		}
 
@@ -117,19 +126,7 @@ Note: Shortcuts only work at the root level and cannot be combined with session
 				os.Exit(1)
 			}
 
-			if len(results) == 0 {
-				fmt.Println("No sessions found matching your query.")
-				return
-			}
-
-			fmt.Printf("Found %d session(s) matching '%s':\n\n", len(results), shortcutSearchQuery)
-
-			for i, info := range results {
-				fmt.Printf("%d. [%s] %s\n", i+1, info.ShortID, session.FormatSessionTime(info.CreatedAt))
-				fmt.Printf("   Query: %s\n", session.TruncateQuery(info.InitialQuery, 60))
-				fmt.Printf("   Messages: %d\n", info.MessageCount)
-				fmt.Println()
-			}
+			printSearchResults(shortcutSearchQuery, results)
 			return
 		}
 
@@ -153,9 +150,15 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.pplx/config.yaml)")
 	rootCmd.PersistentFlags().String("model", "sonar", "Perplexity model to use")
 	viper.BindPFlag("model", rootCmd.PersistentFlags().Lookup("model"))
+	rootCmd.PersistentFlags().Bool("show-reasoning", false, "Show the reasoning of reasoning models, dimmed, before their answers")
+	viper.BindPFlag("show_reasoning", rootCmd.PersistentFlags().Lookup("show-reasoning"))
 	rootCmd.Flags().StringVarP(&shortcutContinue, "shortcut-continue", "c", "", "Continue a session (shortcut for: pplx session continue [id])")
 	rootCmd.Flags().IntVarP(&shortcutListLimit, "shortcut-list", "l", 0, "List recent sessions (shortcut for: pplx session list -l [limit])")
 	rootCmd.Flags().StringVarP(&shortcutSearchQuery, "shortcut-search", "s", "", "Search sessions (shortcut for: pplx session search [query])")
+	rootCmd.Flags().BoolVar(&shortcutOnce, "once", false, "With -c, send a single message and exit")
+	rootCmd.Flags().BoolVar(&shortcutStdin, "stdin", false, "With -c, append standard input to the message")
+	rootCmd.Flags().BoolVar(&shortcutNoHistory, "no-history", false, "With -c, do not print the existing conversation")
+	rootCmd.Flags().StringVar(&shortcutFormat, "format", "markdown", "With -c, output format of a message sent without prompting: markdown, plain or json")
 }
 
 func initConfig() {
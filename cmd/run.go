@@ -1,53 +1,102 @@
 package cmd
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"slices"
 	"strings"
 
 	"github.com/spf13/cobra"
+	"perplexity-cli/pkg/attach"
 	"perplexity-cli/pkg/config"
+	"perplexity-cli/pkg/conversation"
 	"perplexity-cli/pkg/perplexity"
+	"perplexity-cli/pkg/session"
+	"perplexity-cli/pkg/templates"
 	"perplexity-cli/pkg/ui"
 )
 
+var (
+	runSave    bool
+	runSession string
+	runFiles   []string
+	runStdinAs string
+	runChunk   bool
+	// runTemplate names the template the query is rendered from, with
+	// runVars as its variables
+	runTemplate string
+	runVars     []string
+	runFormat   string
+	// runChunkTokens is the chunk size for --chunk; 0 fits chunks to the
+	// model's context window
+	runChunkTokens int
+)
+
+// defaultStdinMaxSize is the most standard input read when stdin_max_size
+// is not set
+const defaultStdinMaxSize = 1024 * 1024
+
 var runCmd = &cobra.Command{
 	Use:   "run [query]",
 	Short: "Send a one-shot query to Perplexity",
 	Long: `Send a single query to the Perplexity Sonar API and display the response.
 
+Nothing is saved unless --save or --session is given. --save records the
+query and response as a new session. --session appends them to the session
+with the given name or ID, sending the earlier conversation as context; a
+session with that name is created if none exists, so scripts can carry a
+conversation across invocations.
+
+Standard input that is piped or redirected is read too. Without a query it
+is the query; with one, the two are combined. --stdin-as chooses how:
+  context  the query, then the input as a fenced code block (default)
+  prompt   the query, then the input as plain text, for input that is
+           itself part of the question
+Input over stdin_max_size (1 MB by default) is refused.
+
+--file attaches local files as code blocks before the query. It takes a
+file, a glob or a directory, which is expanded leaving out files ignored by
+.gitignore, and can be repeated. Binary files and files over the size and
+token limits (attach_max_file_size, attach_max_tokens) are refused.
+
+--chunk answers a question about input too large for one request. The piped
+input and files are split into chunks on paragraph and code block
+boundaries, the question is asked about each chunk, and the partial answers
+are combined into one, with their references merged into a single list.
+Progress is shown on stderr. --chunk-tokens sets the chunk size; by default
+chunks are as large as the model's context window allows. The attachment
+token budget does not apply with --chunk.
+
+--template renders the query from a template in ~/.pplx/templates, with
+variables given as --var name=value. The template's front matter can set
+the model, system prompt, search filters and output format; --model and
+--format given on the command line take precedence. See 'pplx template'.
+
+--format chooses how the answer is printed:
+  markdown  rendered on a terminal, plain markdown when piped (default)
+  plain     plain markdown, even on a terminal
+  json      a JSON object with the answer, citations and token usage
+
 Examples:
   pplx run "What is the capital of France?"
   pplx run "Explain quantum computing" --model sonar-pro
-  echo "What is 2+2?" | pplx run`,
+  echo "What is 2+2?" | pplx run
+  cat error.log | pplx run "Why does this fail?"
+  cat questions.txt | pplx run --stdin-as prompt "Answer briefly:"
+  pplx run --save "Summarize the Go 1.25 release notes"
+  pplx run --session deploy-research "Compare blue-green and canary deploys"
+  pplx run --session deploy-research "Which suits a single VM?"
+  pplx run --file main.go --file 'docs/*.md' "Explain the flow"
+  cat server.log | pplx run --chunk "List every distinct error and its cause"
+  pplx run -t cve --var id=CVE-2024-3094
+  pplx run "Latest Go release?" --format json | jq -r .answer`,
 	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// Get query from argument or stdin
-		var query string
-		if len(args) > 0 {
-			query = args[0]
-		} else {
-			// Try to read from stdin
-			stat, _ := os.Stdin.Stat()
-			if (stat.Mode() & os.ModeCharDevice) == 0 {
-				// Data is being piped
-				var buf strings.Builder
-				buffer := make([]byte, 1024)
-				for {
-					n, err := os.Stdin.Read(buffer)
-					if n > 0 {
-						buf.Write(buffer[:n])
-					}
-					if err != nil {
-						break
-					}
-				}
-				query = strings.TrimSpace(buf.String())
-			}
-		}
-
-		if query == "" {
-			return fmt.Errorf("query is required\n\nUsage: pplx run \"<query>\"\n   or: echo \"<query>\" | pplx run")
+		if runStdinAs != "context" && runStdinAs != "prompt" {
+			return fmt.Errorf("--stdin-as must be context or prompt, not %q", runStdinAs)
 		}
 
 		// Load configuration
@@ -60,51 +109,299 @@ Examples:
 			return fmt.Errorf("configuration error: %w", err)
 		}
 
-		// Get model from flag or config
+		// Get query from argument, template and stdin
+		var query, input string
+		if len(args) > 0 {
+			query = args[0]
+		}
+		tmpl, err := applyRunTemplate(cmd, cfg)
+		if err != nil {
+			return err
+		}
+		if tmpl != nil {
+			if query != "" {
+				return fmt.Errorf("--template renders the query; pass values with --var instead of a query argument")
+			}
+			if query, err = tmpl.Render(parseVars(runVars)); err != nil {
+				return fmt.Errorf("%w\n\nSet variables with --var name=value; 'pplx template show %s' shows the template", err, tmpl.Name)
+			}
+		}
+		if runFormat == "" {
+			runFormat = "markdown"
+		}
+		if err := checkFormat(runFormat); err != nil {
+			return err
+		}
+		if stdinPiped() {
+			input, err = readStdin(cfg.StdinMaxSize)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Get model from flag, template or config
 		model, _ := cmd.Flags().GetString("model")
+		if tmpl != nil && tmpl.Model != "" && !cmd.Flags().Changed("model") {
+			model = tmpl.Model
+		}
 		if model == "" {
 			model = cfg.Model
 		}
 
-		// Create API client
-		clientConfig := perplexity.DefaultConfig(cfg.APIKey)
-		clientConfig.Model = model
-		client := perplexity.NewClientWithConfig(clientConfig)
+		// Chunked input may exceed the attachment budget, which is the point
+		files, err := collectRunFiles(cfg, !runChunk)
+		if err != nil {
+			return err
+		}
 
-		// Prepare messages
-		messages := []perplexity.Message{
-			{Role: "user", Content: query},
+		if runChunk {
+			return runChunked(cfg, model, query, input, files, runFormat)
 		}
 
-		// Make API request
-		req := &perplexity.ChatCompletionRequest{
-			Model:           model,
-			Messages:        messages,
-			MaxTokens:       cfg.MaxTokens,
-			Temperature:     cfg.Temperature,
-			TopP:            cfg.TopP,
-			SearchMode:      cfg.SearchMode,
-			ReasoningEffort: cfg.ReasoningEffort,
+		query = combineStdin(query, input, runStdinAs)
+		if query == "" {
+			return fmt.Errorf("query is required\n\nUsage: pplx run \"<query>\"\n   or: echo \"<query>\" | pplx run\n   or: cat error.log | pplx run \"<question>\"")
 		}
 
-		resp, err := client.CreateCompletionWithRequest(req)
+		if runSave || runSession != "" {
+			return runInSession(cfg, model, query, files)
+		}
 
+		// Prepare messages, with the configured system prompt if any
+		ctx := conversation.Build(nil, attach.Message(files, query), conversation.OptionsFromConfig(cfg, model))
+		if ctx.Tokens > ctx.Budget {
+			return fmt.Errorf("the query is ~%d tokens, over the %d available for %s; use --chunk to answer it in parts",
+				ctx.Tokens, ctx.Budget, model)
+		}
+
+		// Make API request
+		parsed, usage, err := newAsker(cfg, model).send(ctx.Messages, false)
 		if err != nil {
 			return fmt.Errorf("API request failed: %w", err)
 		}
 
-		// Parse response
-		parsed := perplexity.ParseResponse(resp)
-
 		// Display formatted response with references
+		return printResponse(parsed, &usage, cfg, runFormat)
+
+	},
+}
+
+// applyRunTemplate loads the template given with --template and applies its
+// front matter to cfg and the output format. It returns nil without one.
+func applyRunTemplate(cmd *cobra.Command, cfg *config.Config) (*templates.Template, error) {
+	if runTemplate == "" {
+		if len(runVars) > 0 {
+			return nil, fmt.Errorf("--var sets template variables; use it with --template")
+		}
+		return nil, nil
+	}
+
+	tmpl, err := templates.Load(templates.Dir(), runTemplate)
+	if errors.Is(err, templates.ErrNotFound) {
+		return nil, fmt.Errorf("%w\n\nRun 'pplx template list' to see available templates", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range runVars {
+		if name, _, ok := strings.Cut(v, "="); !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("--var must be name=value, not %q", v)
+		}
+	}
+
+	tmpl.Apply(cfg)
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("template %s: %w", tmpl.Name, err)
+	}
+	if !cmd.Flags().Changed("format") {
+		runFormat = tmpl.Format
+	}
+	return tmpl, nil
+}
+
+// parseVars parses name=value pairs; a later value for a name wins
+func parseVars(pairs []string) map[string]string {
+	vars := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		name, value, _ := strings.Cut(pair, "=")
+		vars[strings.TrimSpace(name)] = value
+	}
+	return vars
+}
+
+// runResult is a response printed with --format json
+type runResult struct {
+	// Answer is the response content; its citation markers such as [1]
+	// refer to Citations by position
+	Answer    string                    `json:"answer"`
+	Citations []perplexity.SearchResult `json:"citations,omitempty"`
+	Usage     *perplexity.Usage         `json:"usage,omitempty"`
+	// Reasoning is the thinking of a reasoning model, included with
+	// show_reasoning
+	Reasoning string `json:"reasoning,omitempty"`
+}
+
+// checkFormat checks a --format value
+func checkFormat(format string) error {
+	if !slices.Contains(templates.Formats, format) {
+		return fmt.Errorf("--format must be one of %s, not %q", strings.Join(templates.Formats, ", "), format)
+	}
+	return nil
+}
+
+// printResponse prints a response in an output format: with its references,
+// rendered as markdown on a terminal and as plain markdown when output is
+// piped or format is plain, or as JSON. The markdown format is used when
+// format is empty. The reasoning of reasoning models is printed before the
+// answer only with show_reasoning.
+func printResponse(parsed *perplexity.ParsedResponse, usage *perplexity.Usage, cfg *config.Config, format string) error {
+	if format == "json" {
+		result := runResult{Answer: parsed.Content, Citations: parsed.SearchResults, Usage: usage}
+		if cfg.ShowReasoning {
+			result.Reasoning = parsed.Reasoning
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			return fmt.Errorf("failed to write response: %w", err)
+		}
+		return nil
+	}
+
+	if cfg.ShowReasoning {
+		ui.PrintReasoning(parsed.Reasoning)
+	}
+	switch format {
+	case "plain":
+		fmt.Println(perplexity.FormatWithReferences(parsed))
+	default:
 		formatted := perplexity.FormatWithReferences(parsed)
 		rendered := ui.RenderMarkdownAlways(formatted, cfg)
 		fmt.Println(rendered)
+	}
+	return nil
+}
 
-		return nil
-	},
+// stdinPiped reports whether standard input is piped or redirected rather
+// than a terminal
+func stdinPiped() bool {
+	stat, err := os.Stdin.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice == 0
+}
+
+// readStdin reads standard input, refusing more than limit bytes, or
+// defaultStdinMaxSize when limit is zero
+func readStdin(limit int) (string, error) {
+	if limit <= 0 {
+		limit = defaultStdinMaxSize
+	}
+
+	// Read one byte past the limit to tell input at the limit from input over it
+	data, err := io.ReadAll(io.LimitReader(os.Stdin, int64(limit)+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read stdin: %w", err)
+	}
+	if len(data) > limit {
+		return "", fmt.Errorf("standard input is over the %s limit (stdin_max_size); attach large files with --file or raise the limit",
+			attach.FormatSize(int64(limit)))
+	}
+	return string(data), nil
+}
+
+// combineStdin combines the query with piped input: as a fenced code block
+// after it with layout "context", or as plain text after it with "prompt".
+// Either may be empty, in which case the other is returned alone.
+func combineStdin(query, input, layout string) string {
+	query = strings.TrimSpace(query)
+	input = strings.Trim(input, "\n")
+	if strings.TrimSpace(input) == "" || query == "" || layout == "prompt" {
+		return joinMessage(query, input)
+	}
+	return query + "\n\n" + attach.CodeBlock(input+"\n", "")
+}
+
+// collectRunFiles reads the files given with --file, listing on stderr any
+// skipped while expanding directories, and checks the token budget when
+// checkBudget is set
+func collectRunFiles(cfg *config.Config, checkBudget bool) ([]attach.File, error) {
+	if len(runFiles) == 0 {
+		return nil, nil
+	}
+
+	limits := attachLimits(cfg)
+	files, skipped, err := attach.Collect(runFiles, limits)
+	if err != nil {
+		return nil, err
+	}
+	printSkipped(os.Stderr, skipped)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files to attach in %s", strings.Join(runFiles, ", "))
+	}
+	if checkBudget {
+		if err := attach.CheckBudget(files, limits); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// runInSession answers query with files attached and records the exchange:
+// in a new session with --save, or in the session named or identified by
+// --session, which is created with that name if it does not exist
+func runInSession(cfg *config.Config, model, query string, files []attach.File) error {
+	sessionManager, err := session.NewManager()
+	if err != nil {
+		return fmt.Errorf("failed to create session manager: %w", err)
+	}
+	defer sessionManager.Close()
+
+	var interactive *InteractiveSession
+	if runSession == "" {
+		interactive = newInteractiveSession(cfg, sessionManager, model)
+	} else if s, err := sessionManager.Find(runSession); err == nil {
+		interactive = ResumeInteractiveSession(cfg, sessionManager, s)
+	} else if !errors.Is(err, session.ErrSessionNotFound) {
+		return err
+	} else {
+		// Checked again when the session is saved, in case another run
+		// creates a session with the name meanwhile
+		if err := sessionManager.CheckName(runSession, ""); err != nil {
+			return fmt.Errorf("session %s not found and cannot be created: %w", runSession, err)
+		}
+		interactive = newInteractiveSession(cfg, sessionManager, model)
+		interactive.session = session.NewSession(model, query)
+		interactive.session.Metadata.Name = runSession
+	}
+
+	created := interactive.savedCount == 0
+	interactive.attachments = files
+	interactive.format = runFormat
+	if err := interactive.Send(query); err != nil {
+		return err
+	}
+
+	// Report where the exchange went on stderr to keep stdout clean
+	s := interactive.session
+	if created {
+		fmt.Fprintf(os.Stderr, "%s Saved as session [%s]%s\n", ui.Green("✓"), s.ShortID, nameMarker(s.ToInfo()))
+	} else {
+		fmt.Fprintf(os.Stderr, "%s Added to session [%s]%s (%d messages)\n", ui.Green("✓"), s.ShortID, nameMarker(s.ToInfo()), len(s.Messages))
+	}
+	return nil
 }
 
 func init() {
 	rootCmd.AddCommand(runCmd)
+	runCmd.Flags().BoolVar(&runSave, "save", false, "Save the query and response as a new session")
+	runCmd.Flags().StringVar(&runSession, "session", "", "Append to the session with this name or ID, creating a named session if none exists")
+	runCmd.Flags().StringVar(&runStdinAs, "stdin-as", "context", "How piped input is combined with the query: context (fenced block) or prompt (plain text)")
+	runCmd.Flags().StringArrayVarP(&runFiles, "file", "f", nil, "Attach a file, glob or directory to the query (repeatable)")
+	runCmd.Flags().BoolVar(&runChunk, "chunk", false, "Answer the query about each chunk of large input, then combine the answers")
+	runCmd.Flags().IntVar(&runChunkTokens, "chunk-tokens", 0, "Chunk size for --chunk in estimated tokens (default: fit the model's context)")
+	runCmd.Flags().StringVarP(&runTemplate, "template", "t", "", "Render the query from this template in ~/.pplx/templates")
+	runCmd.Flags().StringArrayVar(&runVars, "var", nil, "Set a template variable as name=value (repeatable)")
+	runCmd.Flags().StringVar(&runFormat, "format", "", "Output format: markdown, plain or json (default: the template's, or markdown)")
+	runCmd.MarkFlagsMutuallyExclusive("save", "session")
+	runCmd.MarkFlagsMutuallyExclusive("chunk", "save")
+	runCmd.MarkFlagsMutuallyExclusive("chunk", "session")
 }
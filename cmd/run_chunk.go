@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"perplexity-cli/pkg/attach"
+	"perplexity-cli/pkg/chunk"
+	"perplexity-cli/pkg/config"
+	"perplexity-cli/pkg/conversation"
+	"perplexity-cli/pkg/perplexity"
+	"perplexity-cli/pkg/ui"
+)
+
+const (
+	// chunkOverheadTokens is kept free in each request for the framing
+	// around a chunk or partial answers
+	chunkOverheadTokens = 200
+
+	mapPrompt = "You answer an instruction about a large input that has been split into parts. " +
+		"You are given one part. Answer the instruction using this part, keeping details that may need " +
+		"to be combined with the other parts. If the part has nothing relevant, say so in one sentence."
+
+	reducePrompt = "You combine partial answers into one answer to an instruction. " +
+		"Each partial answer was written about one part of a larger input. " +
+		"Merge them into a single coherent answer without repeating points, and do not mention the parts. " +
+		"Keep citation markers such as [1] on the statements they support, " +
+		"and do not add citations or information that is not in the partial answers."
+)
+
+// chunkRun answers a question about input split into chunks
+type chunkRun struct {
+	asker *asker
+	// budget is the size of a chunk, or of a group of partial answers
+	// combined at once, in estimated tokens
+	budget int
+}
+
+// runChunked answers instruction about input and files in chunks: each chunk
+// is answered on its own, then the partial answers are combined with their
+// references merged and printed in format
+func runChunked(cfg *config.Config, model, instruction, input string, files []attach.File, format string) error {
+	instruction = strings.TrimSpace(instruction)
+	if instruction == "" {
+		return fmt.Errorf("--chunk needs a question as an argument, asked about each chunk")
+	}
+	if strings.TrimSpace(input) == "" && len(files) == 0 {
+		return fmt.Errorf("--chunk needs input to split: pipe it on stdin or attach files with --file")
+	}
+
+	r := &chunkRun{asker: newAsker(cfg, model)}
+
+	opts := conversation.OptionsFromConfig(cfg, model)
+	r.budget = opts.Budget() - conversation.EstimateTokens(opts.SystemPrompt+mapPrompt+instruction) - chunkOverheadTokens
+	if runChunkTokens > 0 {
+		r.budget = min(runChunkTokens, r.budget)
+	}
+	if r.budget <= 0 {
+		return fmt.Errorf("the instruction and system prompt leave no room for input in a request to %s", model)
+	}
+
+	chunks := chunkInput(input, files, r.budget)
+	started := time.Now()
+
+	answers := make([]*perplexity.ParsedResponse, len(chunks))
+	for i, text := range chunks {
+		fmt.Fprintf(os.Stderr, "Chunk %d/%d (~%d tokens)...", i+1, len(chunks), conversation.EstimateTokens(text))
+		chunkStarted := time.Now()
+
+		// Input that fits in one chunk is asked about like any other query
+		system, prompt := "", instruction+"\n\n"+text
+		if len(chunks) > 1 {
+			system = mapPrompt
+			prompt = fmt.Sprintf("%s\n\nPart %d of %d of the input:\n\n%s", instruction, i+1, len(chunks), text)
+		}
+		parsed, err := r.asker.ask(system, prompt, false)
+		if err != nil {
+			fmt.Fprintln(os.Stderr)
+			return fmt.Errorf("chunk %d of %d failed: %w", i+1, len(chunks), err)
+		}
+		fmt.Fprintf(os.Stderr, " done (%s)\n", formatLatency(time.Since(chunkStarted)))
+		answers[i] = parsed
+	}
+
+	result := answers[0]
+	if len(answers) > 1 {
+		var err error
+		result, err = r.reduce(instruction, answers)
+		if err != nil {
+			return err
+		}
+	}
+
+	requests, usage := r.asker.totals()
+	fmt.Fprintf(os.Stderr, "%s Answered %s in %s, %d tokens (%s)\n", ui.Green("✓"),
+		count(len(chunks), "chunk"), count(requests, "request"), usage.TotalTokens, formatLatency(time.Since(started)))
+	return printResponse(result, &usage, cfg, format)
+}
+
+// chunkInput splits piped input and files into chunks of at most budget
+// tokens. Files are labelled with their paths, each part of a split file
+// with its part number, and small files share chunks.
+func chunkInput(input string, files []attach.File, budget int) []string {
+	// Leave room for the fences and labels added around each part
+	size := max(budget-chunkOverheadTokens/2, budget/2)
+
+	var blocks []string
+	for _, part := range chunk.Split(input, size) {
+		blocks = append(blocks, attach.CodeBlock(part, ""))
+	}
+	for _, f := range files {
+		parts := chunk.Split(f.Content, size)
+		for i, part := range parts {
+			label := "File: " + f.Path
+			if len(parts) > 1 {
+				label += fmt.Sprintf(" (part %d of %d)", i+1, len(parts))
+			}
+			blocks = append(blocks, label+"\n"+attach.CodeBlock(part, attach.Language(f.Path)))
+		}
+	}
+	return chunk.Pack(blocks, budget)
+}
+
+// reduce combines partial answers into one. Their citations are renumbered
+// into one list of sources first, and the combining request does not search
+// so the answer cites only those sources. Answers too large to combine in
+// one request are combined in groups first.
+func (r *chunkRun) reduce(instruction string, answers []*perplexity.ParsedResponse) (*perplexity.ParsedResponse, error) {
+	contents, sources := perplexity.MergeSources(answers)
+	for i, content := range contents {
+		contents[i] = strings.TrimSpace(perplexity.StripReferences(content))
+	}
+
+	for round := 1; ; round++ {
+		groups := packAnswers(contents, r.budget)
+		if len(groups) == len(contents) && len(contents) > 1 {
+			// Every answer fills a request on its own; combining them in
+			// one request is all that is left to try
+			groups = [][]string{contents}
+		}
+
+		combined := make([]string, len(groups))
+		for i, group := range groups {
+			if len(group) == 1 {
+				combined[i] = group[0]
+				continue
+			}
+
+			fmt.Fprintf(os.Stderr, "Combining %d answers", len(group))
+			if len(groups) > 1 {
+				fmt.Fprintf(os.Stderr, " (group %d/%d, round %d)", i+1, len(groups), round)
+			}
+			fmt.Fprint(os.Stderr, "...")
+			started := time.Now()
+
+			parsed, err := r.asker.ask(reducePrompt, reduceInput(instruction, group), true)
+			if err != nil {
+				fmt.Fprintln(os.Stderr)
+				return nil, fmt.Errorf("failed to combine answers: %w", err)
+			}
+			fmt.Fprintf(os.Stderr, " done (%s)\n", formatLatency(time.Since(started)))
+			combined[i] = parsed.Content
+		}
+
+		if len(combined) == 1 {
+			// Renumber the sources in order of first citation, as the
+			// references list is numbered
+			final, cited := perplexity.MergeSources([]*perplexity.ParsedResponse{{Content: combined[0], SearchResults: sources}})
+			return &perplexity.ParsedResponse{
+				Content:       final[0],
+				Citations:     perplexity.ExtractCitations(final[0]),
+				SearchResults: cited,
+			}, nil
+		}
+		contents = combined
+	}
+}
+
+// packAnswers groups consecutive answers so each group fits in budget
+// tokens
+func packAnswers(answers []string, budget int) [][]string {
+	var groups [][]string
+	var group []string
+	tokens := 0
+	for _, answer := range answers {
+		n := conversation.EstimateTokens(answer)
+		if len(group) > 0 && tokens+n > budget {
+			groups = append(groups, group)
+			group, tokens = nil, 0
+		}
+		group = append(group, answer)
+		tokens += n
+	}
+	if len(group) > 0 {
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// reduceInput formats the instruction and partial answers for combining
+func reduceInput(instruction string, answers []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Instruction:\n%s\n\nPartial answers:", instruction)
+	for i, answer := range answers {
+		fmt.Fprintf(&b, "\n\n--- Partial answer %d of %d ---\n%s", i+1, len(answers), answer)
+	}
+	return b.String()
+}
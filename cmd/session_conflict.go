@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strings"
+
+	"perplexity-cli/pkg/session"
+)
+
+// saveResolvingConflicts saves s, resolving concurrent modifications by another process.
+// base is the number of messages s had when it was loaded or last saved.
+//
+// If the session was modified elsewhere and reader is non-nil, the user is
+// asked whether to reload the session and append the new messages, or to keep
+// this version as a new fork. Without a reader the session is reloaded and
+// the new messages appended, so neither writer loses data.
+//
+// Notices about the conflict are passed to notify. The session that ended up
+// on disk is returned.
+func saveResolvingConflicts(m *session.Manager, s *session.Session, base int, reader *bufio.Reader, notify func(string)) (*session.Session, error) {
+	err := m.Save(s)
+	if err == nil {
+		return s, nil
+	}
+	if !errors.Is(err, session.ErrSessionModified) {
+		return s, err
+	}
+
+	notify(fmt.Sprintf("Session [%s] was modified elsewhere since it was loaded.", s.ShortID))
+
+	if reader != nil && !confirm(reader, "Reload it and append your new messages? [Y/n] ", true) {
+		fork, err := m.Fork(s, len(s.Messages))
+		if err != nil {
+			return s, fmt.Errorf("failed to save as a new session: %w", err)
+		}
+		notify(fmt.Sprintf("Saved your version as new session [%s].", fork.ShortID))
+		return fork, nil
+	}
+
+	merged, err := m.Rebase(s, base)
+	if err != nil {
+		return s, fmt.Errorf("failed to reload session: %w", err)
+	}
+	notify(fmt.Sprintf("Reloaded [%s] and appended %d new message(s).", merged.ShortID, len(s.Messages)-base))
+	return merged, nil
+}
+
+// confirm asks a yes/no question, returning def on empty input or read errors
+func confirm(reader *bufio.Reader, prompt string, def bool) bool {
+	fmt.Print(prompt)
+	answer, err := reader.ReadString('\n')
+	if err != nil {
+		return def
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	case "n", "no":
+		return false
+	default:
+		return def
+	}
+}
@@ -1,54 +1,101 @@
 package cmd
 
 import (
-	"bufio"
 	"fmt"
-	"os"
 	"strings"
 
 	"github.com/spf13/cobra"
 	"perplexity-cli/pkg/config"
-	"perplexity-cli/pkg/perplexity"
 	"perplexity-cli/pkg/session"
-	"perplexity-cli/pkg/ui"
 )
 
+var (
+	continueOnce      bool
+	continueStdin     bool
+	continueNoHistory bool
+	continueFormat    string
+)
+
+// continueOptions controls how continueSession resumes a session
+type continueOptions struct {
+	// message is sent without prompting when set
+	message string
+	// once answers a single prompted message instead of starting the REPL
+	once bool
+	// stdin appends standard input to the message
+	stdin bool
+	// noHistory skips printing the existing transcript
+	noHistory bool
+	// format is the output format of the response to message, one of
+	// templates.Formats; empty means markdown
+	format string
+}
+
 // sessionContinueCmd loads an existing session and continues the conversation
 var sessionContinueCmd = &cobra.Command{
-	Use:   "continue [id]",
+	Use:   "continue [id] [message]",
 	Short: "Continue a conversation session",
-	Long: `Load an existing conversation session and prompt for a new message to continue the conversation.
+	Long: `Load an existing conversation session and continue it in interactive mode.
 
-The ID can be either:
-- Short ID (e.g., a8x9k2) - the 6-7 character alphanumeric code shown in session list
+The ID can be any of:
+- Short ID (e.g., a8x9k2) - the alphanumeric code shown in brackets, or a
+  unique prefix of at least 4 characters
+- Session name (e.g., deploy-research) - set with 'pplx session name'
+- latest, @-1, @-2, ... - the most recent, second most recent, ... session
 - Full timestamp ID (e.g., 20240115-103045.123) - for backward compatibility
 
 This command will:
 1. Display the session history
-2. Prompt you for a new message
-3. Send your message with conversation context to Perplexity
-4. Display the response with citations
-5. Save the updated session
+2. Start an interactive conversation using the session's model
+3. Send each message with conversation context to Perplexity
+4. Save the session after every response
+
+Use --once to send a single message and exit instead.
+
+When a message is given as arguments or with --stdin, it is sent without
+prompting and the response is printed like 'pplx run' prints it, in the
+--format output format, so the command can be used from scripts. With
+--stdin, standard input is appended to the message, up to stdin_max_size.
 
 Examples:
   pplx session continue a8x9k2
+  pplx session continue a8x9k2 --once
+  pplx session continue a8x9k2 "and what about Rust?"
+  git diff | pplx session continue a8x9k2 --stdin --no-history "review this"
+  pplx session continue a8x9k2 --no-history --format json "and in Python?"
   pplx session continue 20240115-103045.123`,
-	Args: cobra.ExactArgs(1),
+	Args: cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		id := args[0]
-
-		return continueSession(id)
+		return continueSession(id, continueOptions{
+			message:   strings.Join(args[1:], " "),
+			once:      continueOnce,
+			stdin:     continueStdin,
+			noHistory: continueNoHistory,
+			format:    continueFormat,
+		})
 	},
 }
 
 func init() {
 	if sessionCmd != nil {
 		sessionCmd.AddCommand(sessionContinueCmd)
+		sessionContinueCmd.Flags().BoolVar(&continueOnce, "once", false, "Send a single message and exit")
+		sessionContinueCmd.Flags().BoolVar(&continueStdin, "stdin", false, "Append standard input to the message and send it without prompting")
+		sessionContinueCmd.Flags().BoolVar(&continueNoHistory, "no-history", false, "Do not print the existing conversation")
+		sessionContinueCmd.Flags().StringVar(&continueFormat, "format", "markdown", "Output format of a response sent without prompting: markdown, plain or json")
 	}
 }
 
-// continueSession handles the workflow for continuing a session
-func continueSession(sessionID string) error {
+// continueSession displays a session and continues it: with a message
+// non-interactively, otherwise in the REPL or for a single prompted message
+func continueSession(sessionID string, opts continueOptions) error {
+	if opts.format != "" {
+		if err := checkFormat(opts.format); err != nil {
+			return err
+		}
+	}
+
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
@@ -59,117 +106,61 @@ func continueSession(sessionID string) error {
 		return fmt.Errorf("configuration error: %w", err)
 	}
 
+	message := opts.message
+	if opts.stdin {
+		input, err := readStdin(cfg.StdinMaxSize)
+		if err != nil {
+			return err
+		}
+		message = joinMessage(message, input)
+		if message == "" {
+			return fmt.Errorf("no message provided on stdin or as arguments")
+		}
+	}
+
 	// Create session manager
 	sessionManager, err := session.NewManager()
 	if err != nil {
 		return fmt.Errorf("failed to create session manager: %w", err)
 	}
+	defer sessionManager.Close()
 
 	// Load session (try short ID first, then full ID)
-	var s *session.Session
-	s, err = sessionManager.LoadByShortID(sessionID)
+	s, err := sessionManager.Find(sessionID)
 	if err != nil {
-		s, err = sessionManager.Load(sessionID)
-		if err != nil {
-			return fmt.Errorf("session not found: %s\n\nRun 'pplx session list' to see available sessions", sessionID)
-		}
+		return fmt.Errorf("%w\n\nRun 'pplx session list' to see available sessions", err)
 	}
 
 	// Display session history
-	if err := session.DisplaySession(s); err != nil {
-		return fmt.Errorf("failed to display session: %w", err)
-	}
-
-	// Display separator
-	fmt.Println()
-	ui.PrintSeparator(ui.Cyan)
-
-	// Prompt for new message
-	fmt.Print("You: ")
-	reader := bufio.NewReader(os.Stdin)
-	input, err := reader.ReadString('\n')
-	if err != nil {
-		return fmt.Errorf("failed to read input: %w", err)
-	}
-
-	input = strings.TrimSpace(input)
-	if input == "" {
-		fmt.Println("No message provided. Exiting.")
-		return nil
-	}
-
-	// Create API client
-	clientConfig := perplexity.DefaultConfig(cfg.APIKey)
-	clientConfig.Model = s.Metadata.Model
-	client := perplexity.NewClientWithConfig(clientConfig)
-
-	// Build API messages with conversation context
-	messages := s.GetLastMessages(MaxContextMessages)
-	apiMessages := make([]perplexity.Message, 0, len(messages)+1)
-
-	// Convert session messages, stripping references from assistant messages
-	for _, msg := range messages {
-		content := msg.Content
-		if msg.Role == "assistant" {
-			content = perplexity.StripReferences(content)
+	if !opts.noHistory {
+		if err := session.DisplaySession(s); err != nil {
+			return fmt.Errorf("failed to display session: %w", err)
 		}
-		apiMessages = append(apiMessages, perplexity.Message{
-			Role:    msg.Role,
-			Content: content,
-		})
 	}
 
-	// Add the new user message
-	apiMessages = append(apiMessages, perplexity.Message{
-		Role:    "user",
-		Content: input,
-	})
-
-	// Make API request
-	req := &perplexity.ChatCompletionRequest{
-		Model:           s.Metadata.Model,
-		Messages:        apiMessages,
-		MaxTokens:       cfg.MaxTokens,
-		Temperature:     cfg.Temperature,
-		TopP:            cfg.TopP,
-		SearchMode:      cfg.SearchMode,
-		ReasoningEffort: cfg.ReasoningEffort,
+	interactive := ResumeInteractiveSession(cfg, sessionManager, s)
+	interactive.format = opts.format
+	switch {
+	case message != "":
+		return interactive.Send(message)
+	case opts.once:
+		return interactive.RunOnce()
+	default:
+		return interactive.Run()
 	}
+}
 
-	resp, err := client.CreateCompletionWithRequest(req)
-	if err != nil {
-		return fmt.Errorf("API request failed: %w", err)
-	}
-
-	// Parse response
-	parsed := perplexity.ParseResponse(resp)
-
-	// Display separator
-	fmt.Println()
-	ui.PrintSeparator(ui.Magenta)
-	fmt.Print("PPLX: ")
+// joinMessage combines a message with piped input, separated by a blank line
+func joinMessage(message, input string) string {
+	message = strings.TrimSpace(message)
+	input = strings.TrimSpace(input)
 
-	// Display response with markdown rendering
-	formatted := perplexity.FormatWithReferences(parsed)
-	rendered, err := ui.RenderMarkdown(formatted, cfg)
-	if err != nil {
-		fmt.Println(formatted)
-	} else {
-		fmt.Println(rendered)
+	switch {
+	case message == "":
+		return input
+	case input == "":
+		return message
+	default:
+		return message + "\n\n" + input
 	}
-	fmt.Println()
-
-	// Update session with new messages
-	s.AddMessage("user", input)
-	cleanContent := perplexity.StripReferences(parsed.Content)
-	s.AddMessage("assistant", cleanContent)
-
-	// Save updated session
-	if err := sessionManager.Save(s); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: failed to save session: %v\n", err)
-	} else {
-		session.Debugf("Session updated: %s", s.ID)
-	}
-
-	return nil
 }
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"perplexity-cli/pkg/config"
+	"perplexity-cli/pkg/session"
+	"perplexity-cli/pkg/ui"
+)
+
+// sessionEncryptAllCmd rewrites every session encrypted
+var sessionEncryptAllCmd = &cobra.Command{
+	Use:   "encrypt-all",
+	Short: "Encrypt all saved sessions",
+	Long: `Rewrite every saved session encrypted with AES-256-GCM.
+
+The key is derived from the PPLX_SESSION_PASSPHRASE environment variable
+when it is set. Otherwise a random key is generated in ~/.pplx/session.key
+(mode 0600) on first use. Losing the passphrase or key file makes encrypted
+sessions unreadable.
+
+Set encrypt_sessions: true in ~/.pplx/config.yaml so new sessions are
+encrypted too.
+
+Examples:
+  pplx session encrypt-all
+  PPLX_SESSION_PASSPHRASE=... pplx session encrypt-all`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return convertSessions(true)
+	},
+}
+
+// sessionDecryptAllCmd rewrites every session in plaintext
+var sessionDecryptAllCmd = &cobra.Command{
+	Use:   "decrypt-all",
+	Short: "Decrypt all saved sessions",
+	Long: `Rewrite every saved session in plaintext, using the same passphrase or
+key file that encrypted it.
+
+Set encrypt_sessions: false in ~/.pplx/config.yaml so new sessions are not
+encrypted again.
+
+Examples:
+  pplx session decrypt-all`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return convertSessions(false)
+	},
+}
+
+// convertSessions rewrites every session with encryption on or off
+func convertSessions(encrypt bool) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	_, keyErr := os.Stat(session.GetSessionKeyPath())
+	generatesKey := encrypt && os.Getenv(session.PassphraseEnv) == "" && os.IsNotExist(keyErr)
+
+	store, err := session.OpenStore(cfg.SessionStore, session.NewEncryption(encrypt))
+	if err != nil {
+		return fmt.Errorf("failed to open session store: %w", err)
+	}
+	sessionManager := session.NewManagerWithStore(store)
+	defer sessionManager.Close()
+
+	ids, err := store.IDs()
+	if err != nil {
+		return err
+	}
+
+	converted, failed := 0, 0
+	for _, id := range ids {
+		if err := sessionManager.Convert(id); err != nil {
+			failed++
+			fmt.Printf("%s %s: %v\n", ui.Red("✗"), id, err)
+			continue
+		}
+		converted++
+	}
+
+	// Drop freed database pages that may still hold the old form
+	if compactor, ok := store.(interface{ Compact() error }); ok {
+		if err := compactor.Compact(); err != nil {
+			return err
+		}
+	}
+
+	verb := "Decrypted"
+	if encrypt {
+		verb = "Encrypted"
+	}
+	fmt.Printf("%s %d session(s), %d failed.\n", verb, converted, failed)
+
+	if generatesKey && converted > 0 {
+		fmt.Printf("\nGenerated a new key at %s. Back it up: without it your sessions cannot be read.\n", session.GetSessionKeyPath())
+	}
+	if cfg.EncryptSessions != encrypt {
+		fmt.Printf("\nTo apply this to new sessions too, set this in %s:\n  encrypt_sessions: %t\n", config.GetConfigFilePath(), encrypt)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d session(s) could not be converted", failed)
+	}
+	return nil
+}
+
+func init() {
+	if sessionCmd != nil {
+		sessionCmd.AddCommand(sessionEncryptAllCmd)
+		sessionCmd.AddCommand(sessionDecryptAllCmd)
+	}
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"perplexity-cli/pkg/session"
+)
+
+var forkAt int
+
+// sessionForkCmd creates a new session branching from an existing one
+var sessionForkCmd = &cobra.Command{
+	Use:   "fork [id]",
+	Short: "Fork a conversation session at a given message",
+	Long: `Create a new session containing the messages of an existing session up to
+a given point, leaving the original untouched.
+
+Messages are numbered from 1 in the order shown by 'pplx session show'; each
+exchange is a user message followed by an assistant reply. The fork point must
+be an assistant reply. Without --at the whole conversation is copied.
+
+The new session records its parent and fork point, which are shown by
+'pplx session show' and 'pplx session tree'.
+
+Examples:
+  pplx session fork a8x9k2
+  pplx session fork a8x9k2 --at 4`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sessionManager, err := session.NewManager()
+		if err != nil {
+			return fmt.Errorf("failed to create session manager: %w", err)
+		}
+
+		parent, err := sessionManager.Find(args[0])
+		if err != nil {
+			return fmt.Errorf("%w\n\nRun 'pplx session list' to see available sessions", err)
+		}
+
+		at := forkAt
+		if at == 0 {
+			at = len(parent.Messages)
+		}
+
+		fork, err := sessionManager.Fork(parent, at)
+		if err != nil {
+			return fmt.Errorf("failed to fork session: %w", err)
+		}
+
+		fmt.Printf("Forked [%s] at message %d into new session [%s]\n", parent.ShortID, at, fork.ShortID)
+		fmt.Printf("Continue it with: pplx -c %s\n", fork.ShortID)
+		return nil
+	},
+}
+
+func init() {
+	if sessionCmd != nil {
+		sessionCmd.AddCommand(sessionForkCmd)
+		sessionForkCmd.Flags().IntVar(&forkAt, "at", 0, "Message index to fork at (default: last message)")
+	}
+}
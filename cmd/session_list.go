@@ -2,13 +2,17 @@ package cmd
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"perplexity-cli/pkg/session"
+	"perplexity-cli/pkg/ui"
 )
 
 var (
 	listLimit int
+	listTags  []string
+	listLong  bool
 )
 
 // sessionListCmd lists recent sessions
@@ -18,12 +22,17 @@ var sessionListCmd = &cobra.Command{
 	Long: `List your recent conversation sessions sorted by date.
 
 By default, shows the 10 most recent sessions. Use the -l/--limit flag
-to change the number of sessions displayed.
+to change the number of sessions displayed. Pinned sessions are always
+shown first. Use --tag (repeatable) to only show sessions carrying all
+of the given tags, and --long to include cached summaries (see
+'pplx session summarize').
 
 Examples:
   pplx session list
   pplx session list -l 5
-  pplx session list --limit 20`,
+  pplx session list --limit 20
+  pplx session list --tag work --tag rust
+  pplx session list --long`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Create session manager
 		sessionManager, err := session.NewManager()
@@ -32,34 +41,69 @@ Examples:
 		}
 
 		// Get recent sessions
-		sessions, err := sessionManager.ListRecent(listLimit)
+		sessions, err := sessionManager.ListRecentTagged(listLimit, listTags)
 		if err != nil {
 			return fmt.Errorf("failed to list sessions: %w", err)
 		}
 
-		if len(sessions) == 0 {
-			fmt.Println("No sessions found.")
-			fmt.Println("Start a conversation with 'pplx' or run a query with 'pplx run \"<query>\"'")
-			return nil
-		}
+		printSessionList(sessions, listLong)
+		return nil
+	},
+}
 
-		// Display results
-		fmt.Printf("Recent sessions (showing %d of %d total):\n\n", len(sessions), len(sessions))
+// printSessionList prints sessions in the format used by 'session list' and 'pplx -l'
+func printSessionList(sessions []session.SessionInfo, long bool) {
+	if len(sessions) == 0 {
+		fmt.Println("No sessions found.")
+		fmt.Println("Start a conversation with 'pplx' or run a query with 'pplx run \"<query>\"'")
+		return
+	}
 
-		for i, info := range sessions {
-			// Format: 1. [shortid] Jan 02, 2006 15:04:05
-			fmt.Printf("%d. [%s] %s\n", i+1, info.ShortID, session.FormatSessionTime(info.CreatedAt))
-			fmt.Printf("   %s\n", session.TruncateQuery(info.InitialQuery, 60))
-			fmt.Printf("   (%d messages)\n", info.MessageCount)
+	// Display results
+	fmt.Printf("Recent sessions (showing %d of %d total):\n\n", len(sessions), len(sessions))
 
-			// Add spacing between entries
-			if i < len(sessions)-1 {
-				fmt.Println()
-			}
+	for i, info := range sessions {
+		// Format: 1. [shortid] name Jan 02, 2006 15:04:05
+		fmt.Printf("%d. [%s]%s %s%s\n", i+1, info.ShortID, nameMarker(info), session.FormatSessionTime(info.CreatedAt), pinnedMarker(info))
+		fmt.Printf("   %s\n", session.TruncateQuery(info.DisplayTitle(), 60))
+		if len(info.Tags) > 0 {
+			fmt.Printf("   %s\n", formatTags(info.Tags))
+		}
+		fmt.Printf("   (%d messages)\n", info.MessageCount)
+		if long && info.Summary != "" {
+			fmt.Printf("   Summary: %s\n", info.Summary)
 		}
 
-		return nil
-	},
+		// Add spacing between entries
+		if i < len(sessions)-1 {
+			fmt.Println()
+		}
+	}
+}
+
+// pinnedMarker returns a marker appended to the header of pinned sessions
+func pinnedMarker(info session.SessionInfo) string {
+	if !info.Pinned {
+		return ""
+	}
+	return " " + ui.Yellow("(pinned)")
+}
+
+// nameMarker returns the session name for list output, if it has one
+func nameMarker(info session.SessionInfo) string {
+	if info.Name == "" {
+		return ""
+	}
+	return " " + ui.Cyan(info.Name)
+}
+
+// formatTags formats tags as a space-separated list of #tags
+func formatTags(tags []string) string {
+	formatted := make([]string, len(tags))
+	for i, tag := range tags {
+		formatted[i] = "#" + tag
+	}
+	return ui.Cyan(strings.Join(formatted, " "))
 }
 
 func init() {
@@ -70,6 +114,8 @@ func init() {
 		// Add the -l/--limit flag
 		// Also add it to the parent session command for 'pplx session -l 10' syntax
 		sessionListCmd.Flags().IntVarP(&listLimit, "limit", "l", 10, "Number of sessions to display")
+		sessionListCmd.Flags().StringSliceVar(&listTags, "tag", nil, "Only show sessions with this tag (repeatable)")
+		sessionListCmd.Flags().BoolVar(&listLong, "long", false, "Show cached session summaries")
 		sessionCmd.Flags().IntVarP(&listLimit, "limit", "l", 10, "Number of sessions to display")
 	}
 }
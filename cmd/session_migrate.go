@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"perplexity-cli/pkg/session"
+	"perplexity-cli/pkg/ui"
+)
+
+var migrateDryRun bool
+
+// sessionMigrateCmd upgrades all session files to the current schema
+var sessionMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade saved sessions to the current schema version",
+	Long: `Upgrade every saved session to the current session schema version.
+
+Sessions are also migrated lazily whenever they are loaded; this command
+upgrades them all at once. The original file of each migrated session is
+kept in ~/.pplx/sessions/backups/ before it is rewritten.
+
+Sessions written by a newer version of pplx are reported and left untouched.
+
+Examples:
+  pplx session migrate --dry-run
+  pplx session migrate`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sessionManager, err := session.NewManager()
+		if err != nil {
+			return fmt.Errorf("failed to create session manager: %w", err)
+		}
+
+		reports, err := sessionManager.MigrateAll(migrateDryRun)
+		if err != nil {
+			return fmt.Errorf("failed to migrate sessions: %w", err)
+		}
+
+		if len(reports) == 0 {
+			fmt.Printf("All sessions are at schema version %d.\n", session.CurrentSchemaVersion)
+			return nil
+		}
+
+		verb := "Migrated"
+		if migrateDryRun {
+			verb = "Would migrate"
+		}
+
+		migrated, failed := 0, 0
+		for _, report := range reports {
+			if report.Err != nil {
+				failed++
+				fmt.Printf("%s %s: %v\n", ui.Red("✗"), report.ID, report.Err)
+				continue
+			}
+
+			migrated++
+			fmt.Printf("%s %s: v%d → v%d\n", ui.Green("✓"), report.ID, report.From, session.CurrentSchemaVersion)
+			for _, step := range report.Steps {
+				fmt.Printf("    v%d → v%d: %s\n", step.From, step.From+1, step.Description)
+			}
+		}
+
+		fmt.Printf("\n%s %d session(s), %d failed.\n", verb, migrated, failed)
+		if failed > 0 {
+			return fmt.Errorf("%d session(s) could not be migrated", failed)
+		}
+		return nil
+	},
+}
+
+func init() {
+	if sessionCmd != nil {
+		sessionCmd.AddCommand(sessionMigrateCmd)
+		sessionMigrateCmd.Flags().BoolVar(&migrateDryRun, "dry-run", false, "Show what would be migrated without writing anything")
+	}
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/spf13/cobra"
+	"perplexity-cli/pkg/config"
+	"perplexity-cli/pkg/session"
+	"perplexity-cli/pkg/ui"
+)
+
+var migrateStoreTo string
+
+// sessionMigrateStoreCmd copies all sessions to a different storage backend
+var sessionMigrateStoreCmd = &cobra.Command{
+	Use:   "migrate-store",
+	Short: "Copy all sessions to a different storage backend",
+	Long: `Copy every session from the configured session store to another one and
+verify that all of them arrived.
+
+Supported stores:
+  json    One JSON file per session in ~/.pplx/sessions/ (default)
+  sqlite  A single database at ~/.pplx/sessions.db with full-text search
+
+The source store is left untouched. After a successful copy, set
+session_store in ~/.pplx/config.yaml to switch to the new store.
+
+Examples:
+  pplx session migrate-store --to sqlite
+  pplx session migrate-store --to json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+
+		from := cfg.SessionStore
+		if from == "" {
+			from = session.StoreJSON
+		}
+		if migrateStoreTo == from {
+			return fmt.Errorf("sessions are already stored in the %s store", from)
+		}
+
+		src, err := session.OpenStore(from, session.NewEncryption(cfg.EncryptSessions))
+		if err != nil {
+			return fmt.Errorf("failed to open %s store: %w", from, err)
+		}
+		defer src.Close()
+
+		dst, err := session.OpenStore(migrateStoreTo, session.NewEncryption(cfg.EncryptSessions))
+		if err != nil {
+			return fmt.Errorf("failed to open %s store: %w", migrateStoreTo, err)
+		}
+		defer dst.Close()
+
+		copied, skipped, err := session.CopyStore(dst, src)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range skipped {
+			fmt.Printf("%s skipped unreadable session %s\n", ui.Yellow("!"), id)
+		}
+
+		// Verify every copied session is present in the destination
+		srcIDs, err := src.IDs()
+		if err != nil {
+			return err
+		}
+		dstIDs, err := dst.IDs()
+		if err != nil {
+			return err
+		}
+
+		present := make(map[string]bool, len(dstIDs))
+		for _, id := range dstIDs {
+			present[id] = true
+		}
+
+		missing := 0
+		for _, id := range srcIDs {
+			if !present[id] && !slices.Contains(skipped, id) {
+				missing++
+				fmt.Printf("%s session %s is missing from the %s store\n", ui.Red("✗"), id, migrateStoreTo)
+			}
+		}
+
+		fmt.Printf("Copied %d of %d session(s) from %s to %s (%d skipped).\n", copied, len(srcIDs), from, migrateStoreTo, len(skipped))
+		if missing > 0 {
+			return fmt.Errorf("verification failed: %d session(s) missing", missing)
+		}
+
+		fmt.Printf("Verified: %d session(s) present in the %s store.\n", len(srcIDs)-len(skipped), migrateStoreTo)
+		fmt.Printf("\nTo use it, set this in %s:\n  session_store: %s\n", config.GetConfigFilePath(), migrateStoreTo)
+		return nil
+	},
+}
+
+func init() {
+	if sessionCmd != nil {
+		sessionCmd.AddCommand(sessionMigrateStoreCmd)
+		sessionMigrateStoreCmd.Flags().StringVar(&migrateStoreTo, "to", "", "Destination store: json or sqlite")
+		sessionMigrateStoreCmd.MarkFlagRequired("to")
+	}
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"perplexity-cli/pkg/session"
+)
+
+// sessionNameCmd sets the unique name of a session
+var sessionNameCmd = &cobra.Command{
+	Use:   "name [id] [name]",
+	Short: "Give a conversation session a unique name",
+	Long: `Give a session a unique name. The name can be used instead of the short ID
+with every session command and with 'pplx run --session'.
+
+Names start with a letter and contain only letters, digits, '.', '-' and '_'.
+Pass an empty name to remove it.
+
+Examples:
+  pplx session name a8x9k2 deploy-research
+  pplx session continue deploy-research
+  pplx session name deploy-research ""`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sessionManager, err := session.NewManager()
+		if err != nil {
+			return fmt.Errorf("failed to create session manager: %w", err)
+		}
+
+		s, err := sessionManager.Find(args[0])
+		if err != nil {
+			return fmt.Errorf("%w\n\nRun 'pplx session list' to see available sessions", err)
+		}
+
+		s, err = sessionManager.SetName(s.ID, args[1])
+		if err != nil {
+			return fmt.Errorf("failed to name session: %w", err)
+		}
+
+		if s.Metadata.Name == "" {
+			fmt.Printf("Removed name from [%s]\n", s.ShortID)
+		} else {
+			fmt.Printf("Named [%s] %s\n", s.ShortID, s.Metadata.Name)
+		}
+		return nil
+	},
+}
+
+func init() {
+	if sessionCmd != nil {
+		sessionCmd.AddCommand(sessionNameCmd)
+	}
+}
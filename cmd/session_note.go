@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"perplexity-cli/pkg/session"
+)
+
+var noteClear bool
+
+// sessionNoteCmd shows or sets the free-form notes of a session
+var sessionNoteCmd = &cobra.Command{
+	Use:   "note [id] [text]",
+	Short: "Show or set notes on a conversation session",
+	Long: `Attach free-form notes to a session. Without text, the current notes
+are printed. Notes are shown by 'pplx session show' and included in searches.
+
+Examples:
+  pplx session note a8x9k2
+  pplx session note a8x9k2 "Conclusion: go with tokio, revisit in Q3"
+  pplx session note a8x9k2 --clear`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		text := strings.TrimSpace(strings.Join(args[1:], " "))
+
+		if text == "" && !noteClear {
+			sessionManager, err := session.NewManager()
+			if err != nil {
+				return fmt.Errorf("failed to create session manager: %w", err)
+			}
+			defer sessionManager.Close()
+
+			s, err := sessionManager.Find(args[0])
+			if err != nil {
+				return err
+			}
+
+			if s.Metadata.Notes == "" {
+				fmt.Printf("No notes for [%s]\n", s.ShortID)
+			} else {
+				fmt.Println(s.Metadata.Notes)
+			}
+			return nil
+		}
+
+		return updateSession(args[0], func(s *session.Session) string {
+			s.Metadata.Notes = text
+			if text == "" {
+				return fmt.Sprintf("Cleared notes for [%s]", s.ShortID)
+			}
+			return fmt.Sprintf("Updated notes for [%s]", s.ShortID)
+		})
+	},
+}
+
+func init() {
+	if sessionCmd != nil {
+		sessionCmd.AddCommand(sessionNoteCmd)
+		sessionNoteCmd.Flags().BoolVar(&noteClear, "clear", false, "Remove the notes from the session")
+	}
+}
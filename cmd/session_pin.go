@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"perplexity-cli/pkg/session"
+)
+
+// sessionPinCmd pins a session to the top of the session list
+var sessionPinCmd = &cobra.Command{
+	Use:   "pin [id]",
+	Short: "Pin a conversation session",
+	Long: `Pin a session so it is always shown first in 'pplx session list',
+regardless of its age.
+
+Examples:
+  pplx session pin a8x9k2`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateSession(args[0], func(s *session.Session) string {
+			s.Metadata.Pinned = true
+			return fmt.Sprintf("Pinned [%s]", s.ShortID)
+		})
+	},
+}
+
+// sessionUnpinCmd removes the pin from a session
+var sessionUnpinCmd = &cobra.Command{
+	Use:   "unpin [id]",
+	Short: "Unpin a conversation session",
+	Long: `Remove the pin from a session.
+
+Examples:
+  pplx session unpin a8x9k2`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateSession(args[0], func(s *session.Session) string {
+			s.Metadata.Pinned = false
+			return fmt.Sprintf("Unpinned [%s]", s.ShortID)
+		})
+	},
+}
+
+func init() {
+	if sessionCmd != nil {
+		sessionCmd.AddCommand(sessionPinCmd)
+		sessionCmd.AddCommand(sessionUnpinCmd)
+	}
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"perplexity-cli/pkg/session"
+)
+
+// sessionRenameCmd sets the title of a session
+var sessionRenameCmd = &cobra.Command{
+	Use:   "rename [id] [title]",
+	Short: "Set the title of a conversation session",
+	Long: `Give a session a title. The title is shown instead of the initial query
+in 'pplx session list' and is included in searches.
+
+Pass an empty title to remove it.
+
+Examples:
+  pplx session rename a8x9k2 "Rust async runtimes comparison"
+  pplx session rename a8x9k2 ""`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		title := strings.Join(args[1:], " ")
+		return updateSession(args[0], func(s *session.Session) string {
+			s.SetTitle(title)
+			if s.Metadata.Title == "" {
+				return fmt.Sprintf("Removed title from [%s]", s.ShortID)
+			}
+			return fmt.Sprintf("Renamed [%s] to %q", s.ShortID, s.Metadata.Title)
+		})
+	},
+}
+
+func init() {
+	if sessionCmd != nil {
+		sessionCmd.AddCommand(sessionRenameCmd)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"perplexity-cli/pkg/session"
 )
 
+var searchTags []string
+
 // sessionSearchCmd searches through sessions
 var sessionSearchCmd = &cobra.Command{
 	Use:   "search [query]",
@@ -15,14 +17,19 @@ var sessionSearchCmd = &cobra.Command{
 
 The search is case-insensitive and matches against:
 - Short ID (exact match)
-- Initial query
+- Initial query, title and notes
+- Tags (exact match)
 - All conversation messages
 
+Use --tag (repeatable) to restrict results to sessions carrying all of the
+given tags.
+
 Examples:
   pplx session search "France"
   pplx session search "quantum computing"
   pplx session search "capital of"
-  pplx session search "a8x9k2"`,
+  pplx session search "a8x9k2"
+  pplx session search "deploy" --tag work`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		query := args[0]
@@ -42,28 +49,39 @@ Examples:
 			return fmt.Errorf("failed to search sessions: %w", err)
 		}
 
-		if len(results) == 0 {
-			fmt.Println("No sessions found matching your query.")
-			return nil
-		}
+		printSearchResults(query, session.FilterByTags(results, searchTags))
+		return nil
+	},
+}
 
-		// Display results
-		fmt.Printf("Found %d session(s) matching '%s':\n\n", len(results), query)
+// printSearchResults prints search results in the format used by 'session search' and 'pplx -s'
+func printSearchResults(query string, results []session.SessionInfo) {
+	if len(results) == 0 {
+		fmt.Println("No sessions found matching your query.")
+		return
+	}
 
-		for i, info := range results {
-			fmt.Printf("%d. [%s] %s\n", i+1, info.ShortID, session.FormatSessionTime(info.CreatedAt))
-			fmt.Printf("   Query: %s\n", session.TruncateQuery(info.InitialQuery, 60))
-			fmt.Printf("   Messages: %d\n", info.MessageCount)
-			fmt.Println()
-		}
+	// Display results
+	fmt.Printf("Found %d session(s) matching '%s':\n\n", len(results), query)
 
-		return nil
-	},
+	for i, info := range results {
+		fmt.Printf("%d. [%s]%s %s%s\n", i+1, info.ShortID, nameMarker(info), session.FormatSessionTime(info.CreatedAt), pinnedMarker(info))
+		if info.Title != "" {
+			fmt.Printf("   Title: %s\n", session.TruncateQuery(info.Title, 60))
+		}
+		fmt.Printf("   Query: %s\n", session.TruncateQuery(info.InitialQuery, 60))
+		if len(info.Tags) > 0 {
+			fmt.Printf("   Tags: %s\n", formatTags(info.Tags))
+		}
+		fmt.Printf("   Messages: %d\n", info.MessageCount)
+		fmt.Println()
+	}
 }
 
 func init() {
 	// Add search command to the parent session command
 	if sessionCmd != nil {
 		sessionCmd.AddCommand(sessionSearchCmd)
+		sessionSearchCmd.Flags().StringSliceVar(&searchTags, "tag", nil, "Only show sessions with this tag (repeatable)")
 	}
 }
@@ -7,18 +7,29 @@ import (
 	"perplexity-cli/pkg/session"
 )
 
+var showAlternates bool
+
 // sessionShowCmd displays a specific session by ID
 var sessionShowCmd = &cobra.Command{
 	Use:   "show [id]",
 	Short: "Show a specific conversation session",
 	Long: `Display a full conversation session by its ID.
 
-The ID can be either:
-- Short ID (e.g., a8x9k2) - the 6-7 character alphanumeric code shown in brackets
+The ID can be any of:
+- Short ID (e.g., a8x9k2) - the alphanumeric code shown in brackets, or a
+  unique prefix of at least 4 characters
+- Session name (e.g., deploy-research) - set with 'pplx session name'
+- latest, @-1, @-2, ... - the most recent, second most recent, ... session
 - Full timestamp ID (e.g., 20240115-103045.123) - for backward compatibility
 
+Responses regenerated with /retry and questions edited with /edit keep
+their earlier versions as alternates. Their number is shown after each
+message; --alternates prints them.
+
 Examples:
   pplx session show a8x9k2
+  pplx session show latest
+  pplx session show latest --alternates
   pplx session show 20240115-103045.123`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -30,24 +41,20 @@ Examples:
 			return fmt.Errorf("failed to create session manager: %w", err)
 		}
 
-		// Try to load by short ID first, then by full ID
-		var s *session.Session
-		s, err = sessionManager.LoadByShortID(id)
+		// Load by short ID first, then by full ID
+		s, err := sessionManager.Find(id)
 		if err != nil {
-			// Try loading as full timestamp ID
-			s, err = sessionManager.Load(id)
-			if err != nil {
-				return fmt.Errorf("session not found: %s", id)
-			}
+			return err
 		}
 
 		// Display the session using display utility
-		return session.DisplaySession(s)
+		return session.DisplaySessionWithOptions(s, session.DisplayOptions{Alternates: showAlternates})
 	},
 }
 
 func init() {
 	if sessionCmd != nil {
 		sessionCmd.AddCommand(sessionShowCmd)
+		sessionShowCmd.Flags().BoolVar(&showAlternates, "alternates", false, "Print earlier versions of regenerated and edited messages")
 	}
 }
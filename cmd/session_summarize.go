@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"perplexity-cli/pkg/config"
+	"perplexity-cli/pkg/perplexity"
+	"perplexity-cli/pkg/session"
+)
+
+var summarizeForce bool
+
+// sessionSummarizeCmd produces and caches a summary of a session
+var sessionSummarizeCmd = &cobra.Command{
+	Use:   "summarize [id]",
+	Short: "Summarize a conversation session",
+	Long: `Produce a one-paragraph summary of a whole conversation using the
+title_model from the configuration (default: sonar).
+
+The summary is cached in the session and reused until new messages are added;
+use --force to regenerate it anyway. Summaries are included in
+'pplx session search' and shown by 'pplx session list --long'.
+
+Examples:
+  pplx session summarize a8x9k2
+  pplx session summarize a8x9k2 --force`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+
+		sessionManager, err := session.NewManager()
+		if err != nil {
+			return fmt.Errorf("failed to create session manager: %w", err)
+		}
+
+		s, err := sessionManager.Find(args[0])
+		if err != nil {
+			return fmt.Errorf("%w\n\nRun 'pplx session list' to see available sessions", err)
+		}
+
+		if s.HasFreshSummary() && !summarizeForce {
+			fmt.Println(s.Metadata.Summary)
+			return nil
+		}
+
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("configuration error: %w", err)
+		}
+
+		summary, err := session.GenerateSummary(newTitleClient(cfg), cfg.TitleModel, s.Messages)
+		if err != nil {
+			return fmt.Errorf("failed to summarize session: %w", err)
+		}
+
+		s.SetSummary(summary)
+		if err := sessionManager.Save(s); err != nil {
+			return fmt.Errorf("failed to save session: %w", err)
+		}
+
+		fmt.Println(summary)
+		return nil
+	},
+}
+
+// newTitleClient creates an API client for the cheap model used for titles
+// and summaries
+func newTitleClient(cfg *config.Config) *perplexity.Client {
+	clientConfig := perplexity.DefaultConfig(cfg.APIKey)
+	clientConfig.Model = cfg.TitleModel
+	return perplexity.NewClientWithConfig(clientConfig)
+}
+
+// maybeAutoTitle titles the session after its first exchange when auto_title
+// is enabled
+func maybeAutoTitle(cfg *config.Config, s *session.Session) {
+	if !wantsTitle(cfg, s) {
+		return
+	}
+	if title := autoTitle(cfg, s.Messages); title != "" {
+		s.SetTitle(title)
+	}
+}
+
+// wantsTitle reports whether s should be titled automatically: auto_title is
+// enabled and s has no title and exactly one exchange
+func wantsTitle(cfg *config.Config, s *session.Session) bool {
+	return cfg.AutoTitle && s.Metadata.Title == "" && len(s.Messages) == 2
+}
+
+// autoTitle generates a title for a session's first exchange, returning ""
+// on failure. Failures are only logged; titling is best effort.
+func autoTitle(cfg *config.Config, messages []session.SessionMessage) string {
+	title, err := session.GenerateTitle(newTitleClient(cfg), cfg.TitleModel, messages)
+	if err != nil {
+		session.Debugf("Failed to generate title: %v", err)
+		return ""
+	}
+
+	session.Debugf("Session titled: %s", title)
+	return title
+}
+
+func init() {
+	if sessionCmd != nil {
+		sessionCmd.AddCommand(sessionSummarizeCmd)
+		sessionSummarizeCmd.Flags().BoolVar(&summarizeForce, "force", false, "Regenerate the summary even if a cached one is up to date")
+	}
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"perplexity-cli/pkg/session"
+)
+
+// sessionTagCmd adds tags to a session
+var sessionTagCmd = &cobra.Command{
+	Use:   "tag [id] [tag...]",
+	Short: "Add tags to a conversation session",
+	Long: `Add one or more tags to a session. Tags are case-insensitive and a
+leading # is ignored, so "#Work" and "work" are the same tag.
+
+Tagged sessions can be filtered with 'pplx session list --tag' and
+'pplx session search --tag'.
+
+Examples:
+  pplx session tag a8x9k2 work rust
+  pplx session tag a8x9k2 "#deploy"`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateSession(args[0], func(s *session.Session) string {
+			s.AddTags(args[1:]...)
+			return fmt.Sprintf("Tags for [%s]: %s", s.ShortID, formatTagsOrNone(s.Metadata.Tags))
+		})
+	},
+}
+
+// sessionUntagCmd removes tags from a session
+var sessionUntagCmd = &cobra.Command{
+	Use:   "untag [id] [tag...]",
+	Short: "Remove tags from a conversation session",
+	Long: `Remove one or more tags from a session.
+
+Examples:
+  pplx session untag a8x9k2 rust`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateSession(args[0], func(s *session.Session) string {
+			s.RemoveTags(args[1:]...)
+			return fmt.Sprintf("Tags for [%s]: %s", s.ShortID, formatTagsOrNone(s.Metadata.Tags))
+		})
+	},
+}
+
+// updateSession loads a session, applies fn and saves the result while
+// holding the session lock. The message fn returns is printed once the
+// session is saved.
+func updateSession(id string, fn func(s *session.Session) string) error {
+	sessionManager, err := session.NewManager()
+	if err != nil {
+		return fmt.Errorf("failed to create session manager: %w", err)
+	}
+	defer sessionManager.Close()
+
+	s, err := sessionManager.Find(id)
+	if err != nil {
+		return fmt.Errorf("%w\n\nRun 'pplx session list' to see available sessions", err)
+	}
+
+	var message string
+	_, err = sessionManager.Modify(s.ID, func(s *session.Session) error {
+		message = fn(s)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+
+	fmt.Println(message)
+	return nil
+}
+
+// formatTagsOrNone formats tags for display, or "(none)" when there are none
+func formatTagsOrNone(tags []string) string {
+	if len(tags) == 0 {
+		return "(none)"
+	}
+	return formatTags(tags)
+}
+
+func init() {
+	if sessionCmd != nil {
+		sessionCmd.AddCommand(sessionTagCmd)
+		sessionCmd.AddCommand(sessionUntagCmd)
+	}
+}
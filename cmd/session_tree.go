@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"perplexity-cli/pkg/session"
+)
+
+// sessionTreeCmd draws the fork structure around a session
+var sessionTreeCmd = &cobra.Command{
+	Use:   "tree [id]",
+	Short: "Show the fork tree of a conversation session",
+	Long: `Draw the branch structure of a session: its oldest ancestor and every
+session forked from it, directly or indirectly.
+
+Each fork is annotated with the message index it was forked at (e.g. @4),
+and the requested session is marked with *.
+
+Examples:
+  pplx session tree a8x9k2`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sessionManager, err := session.NewManager()
+		if err != nil {
+			return fmt.Errorf("failed to create session manager: %w", err)
+		}
+
+		s, err := sessionManager.Find(args[0])
+		if err != nil {
+			return fmt.Errorf("%w\n\nRun 'pplx session list' to see available sessions", err)
+		}
+
+		sessions, err := sessionManager.List()
+		if err != nil {
+			return fmt.Errorf("failed to list sessions: %w", err)
+		}
+
+		root, err := session.BuildTree(sessions, session.FindRoot(sessions, s.ID))
+		if err != nil {
+			return err
+		}
+
+		session.DisplayTree(root, s.ID)
+		return nil
+	},
+}
+
+func init() {
+	if sessionCmd != nil {
+		sessionCmd.AddCommand(sessionTreeCmd)
+	}
+}
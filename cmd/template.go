@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"perplexity-cli/pkg/lineedit"
+	"perplexity-cli/pkg/templates"
+	"perplexity-cli/pkg/ui"
+)
+
+var templateNoEdit bool
+
+// templateCmd is the parent command for prompt templates
+var templateCmd = &cobra.Command{
+	Use:   "template",
+	Short: "Manage prompt templates",
+	Long: `Manage prompt templates stored in ~/.pplx/templates/.
+
+A template is a Markdown file, <name>.md, whose text is the query. It uses
+Go text/template syntax, with variables written as {{.name}} and set with
+--var name=value when running it. Optional YAML front matter between ---
+lines describes the rest of the query:
+
+  ---
+  description: Summarize a CVE for an audience
+  model: sonar-pro
+  system_prompt: You are a security analyst. Be precise and cite advisories.
+  search_domain_filter: [nvd.nist.gov, cve.org, github.com]
+  search_recency_filter: month
+  format: markdown
+  vars:
+    audience: engineers
+  ---
+  Summarize {{.id}} for {{.audience}}: affected versions, impact and fixes.
+
+Front matter keys:
+  description            shown by 'pplx template list'
+  model                  model to use unless --model is given
+  system_prompt          replaces the configured system prompt
+  search_mode            web or academic
+  search_domain_filter   domains to search; -domain excludes one
+  search_recency_filter  hour, day, week, month or year
+  format                 markdown, plain or json, unless --format is given
+  vars                   default values of variables
+
+Every variable the template uses needs a value, from --var or vars; give
+optional variables an empty default.
+
+Examples:
+  pplx template new cve
+  pplx template list
+  pplx template show cve
+  pplx run -t cve --var id=CVE-2024-3094 --var audience=managers`,
+}
+
+// templateListCmd lists the templates
+var templateListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List prompt templates",
+	Long: `List the templates in ~/.pplx/templates/ with their descriptions and
+variables. Variables with a default value are shown as name=value.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := templates.Dir()
+		list, errs := templates.List(dir)
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "%s %v\n", ui.Yellow("Warning:"), err)
+		}
+
+		if len(list) == 0 {
+			fmt.Printf("No templates in %s.\n", dir)
+			fmt.Println("Create one with 'pplx template new <name>'")
+			return nil
+		}
+
+		for i, t := range list {
+			fmt.Printf("%s", ui.Cyan(t.Name))
+			if t.Description != "" {
+				fmt.Printf("  %s", t.Description)
+			}
+			fmt.Println()
+			if vars := templateVariables(t); vars != "" {
+				fmt.Printf("   Variables: %s\n", vars)
+			}
+			if i < len(list)-1 {
+				fmt.Println()
+			}
+		}
+		return nil
+	},
+}
+
+// templateShowCmd prints a template
+var templateShowCmd = &cobra.Command{
+	Use:   "show <name>",
+	Short: "Show a prompt template",
+	Long: `Show a template's file, the settings from its front matter, its variables
+and its text.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		t, err := templates.Load(templates.Dir(), args[0])
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s %s\n", ui.Bold(t.Name), t.Path)
+		if t.Description != "" {
+			fmt.Printf("  %s\n", t.Description)
+		}
+		fmt.Println()
+
+		for _, setting := range [][2]string{
+			{"Model", t.Model},
+			{"System prompt", strings.TrimSpace(t.SystemPrompt)},
+			{"Search mode", t.SearchMode},
+			{"Domains", strings.Join(t.SearchDomainFilter, ", ")},
+			{"Recency", t.SearchRecencyFilter},
+			{"Format", t.Format},
+			{"Variables", templateVariables(t)},
+		} {
+			if setting[1] != "" {
+				fmt.Printf("%-14s %s\n", setting[0]+":", setting[1])
+			}
+		}
+
+		fmt.Println()
+		ui.PrintSeparator(ui.Cyan)
+		fmt.Println(strings.TrimSpace(t.Body))
+		return nil
+	},
+}
+
+// templateNewCmd creates a template
+var templateNewCmd = &cobra.Command{
+	Use:   "new <name>",
+	Short: "Create a prompt template",
+	Long: `Create ~/.pplx/templates/<name>.md with an example front matter and open it
+in your editor ($VISUAL or $EDITOR). An existing template is not replaced.
+
+Examples:
+  pplx template new cve
+  pplx template new weekly-digest --no-edit`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := templates.New(templates.Dir(), args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s Created template %s: %s\n", ui.Green("✓"), args[0], path)
+
+		if templateNoEdit || !term.IsTerminal(int(os.Stdin.Fd())) {
+			return nil
+		}
+		if err := lineedit.OpenEditor(path); err != nil {
+			return err
+		}
+
+		// Report mistakes now rather than on the first run
+		if _, err := templates.Load(templates.Dir(), args[0]); err != nil {
+			return fmt.Errorf("the template was saved but cannot be used yet: %w", err)
+		}
+		return nil
+	},
+}
+
+// templateVariables lists the variables of t, with their defaults
+func templateVariables(t *templates.Template) string {
+	names := t.Variables()
+	for name := range t.Vars {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	formatted := make([]string, len(names))
+	for i, name := range names {
+		formatted[i] = name
+		if value, ok := t.Vars[name]; ok {
+			formatted[i] = fmt.Sprintf("%s=%q", name, value)
+		}
+	}
+	return strings.Join(formatted, " ")
+}
+
+func init() {
+	rootCmd.AddCommand(templateCmd)
+	templateCmd.AddCommand(templateListCmd)
+	templateCmd.AddCommand(templateShowCmd)
+	templateCmd.AddCommand(templateNewCmd)
+	templateNewCmd.Flags().BoolVar(&templateNoEdit, "no-edit", false, "Create the template without opening an editor")
+}
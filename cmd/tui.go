@@ -0,0 +1,704 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/glamour"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"perplexity-cli/pkg/config"
+	"perplexity-cli/pkg/perplexity"
+	"perplexity-cli/pkg/session"
+	"perplexity-cli/pkg/ui"
+)
+
+var tuiCmd = &cobra.Command{
+	Use:   "tui [session]",
+	Short: "Chat in a full-screen terminal UI",
+	Long: `Open a full-screen chat with a scrollable transcript, an input box, a
+sidebar of saved sessions and a status bar showing the model, token usage
+and request latency. Responses stream into the transcript as they arrive.
+
+Conversations are saved like interactive mode's. Give a session ID, name or
+reference such as 'latest' to open it on start.
+
+Keys:
+  Enter          Send the message (Alt+Enter or Ctrl+J for a newline)
+  PgUp/PgDn      Scroll the transcript (the mouse wheel works too)
+  Tab            Switch between the input box and the session sidebar
+  Ctrl+F         Search sessions
+  Ctrl+N         Start a new conversation
+  Ctrl+B         Show or hide the sidebar
+  Ctrl+C         Quit; while a response streams, stop it and keep what
+                 has arrived first (press again to quit at once)
+
+In the sidebar, Up/Down select a session, Enter opens it and / searches.
+
+Examples:
+  pplx tui
+  pplx tui latest
+  pplx tui --model sonar-pro`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+			return fmt.Errorf("pplx tui needs a terminal; use 'pplx run' or 'pplx session continue' in scripts")
+		}
+
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("configuration error: %w", err)
+		}
+
+		sessionManager, err := session.NewManager()
+		if err != nil {
+			return fmt.Errorf("failed to create session manager: %w", err)
+		}
+		defer sessionManager.Close()
+
+		is := newInteractiveSession(cfg, sessionManager, cfg.Model)
+		if len(args) > 0 {
+			s, err := sessionManager.Find(args[0])
+			if err != nil {
+				return fmt.Errorf("%w\n\nRun 'pplx session list' to see available sessions", err)
+			}
+			is = ResumeInteractiveSession(cfg, sessionManager, s)
+		}
+
+		model := newTUIModel(cfg, sessionManager, is)
+		program := tea.NewProgram(model, tea.WithAltScreen(), tea.WithMouseCellMotion())
+		final, err := program.Run()
+		if err != nil {
+			return fmt.Errorf("terminal UI failed: %w", err)
+		}
+
+		// Save anything left unsaved, such as a session switched away from
+		// while its save failed, and print the notices not shown yet now
+		// that the screen is restored
+		if m, ok := final.(*tuiModel); ok {
+			err := m.is.save(nil)
+			for _, notice := range m.notices.take() {
+				fmt.Fprintln(os.Stderr, ui.Yellow(notice))
+			}
+			return err
+		}
+		return nil
+	},
+}
+
+// tuiFocus is the part of the TUI receiving keys
+type tuiFocus int
+
+const (
+	focusInput tuiFocus = iota
+	focusSidebar
+	focusSearch
+)
+
+const (
+	// sidebarWidth is the width of the session sidebar, including its border
+	sidebarWidth = 32
+	// minSidebarTerminalWidth is the narrowest terminal the sidebar is shown in
+	minSidebarTerminalWidth = 80
+	// inputHeight is the number of text lines in the input box
+	inputHeight = 3
+)
+
+// tuiEntry is a message in the transcript. rendered caches the content
+// rendered for width columns.
+type tuiEntry struct {
+	role    string
+	content string
+	// reasoning is the reasoning of a completed response; while a
+	// response streams it is still part of content
+	reasoning string
+	failed    bool
+	rendered  string
+	width     int
+}
+
+// Messages sent to the TUI by commands running in the background
+type (
+	// streamDeltaMsg is a piece of a streamed response
+	streamDeltaMsg string
+
+	// streamDoneMsg ends a request. On success the exchange has been
+	// recorded in the session and saved, and saveErr is any save failure.
+	// notices are those reported while building the request and saving.
+	streamDoneMsg struct {
+		parsed  *perplexity.ParsedResponse
+		usage   perplexity.Usage
+		err     error
+		saveErr error
+		latency time.Duration
+		notices []string
+	}
+
+	// sessionsMsg holds the sessions listed in the sidebar; query is the
+	// search they were found with
+	sessionsMsg struct {
+		query    string
+		sessions []session.SessionInfo
+		err      error
+	}
+)
+
+// tuiModel is the state of the terminal UI
+type tuiModel struct {
+	config         *config.Config
+	sessionManager *session.Manager
+	is             *InteractiveSession
+
+	transcript viewport.Model
+	input      textarea.Model
+	search     textinput.Model
+	spinner    spinner.Model
+	focus      tuiFocus
+
+	width, height int
+	showSidebar   bool
+
+	// style is the resolved markdown style; renderer wraps at the transcript
+	// width
+	style    string
+	renderer *glamour.TermRenderer
+
+	entries []tuiEntry
+	// sessionLabel names the current session in the status bar. It is
+	// updated between requests, since the session is modified in the
+	// background while a request is in flight.
+	sessionLabel string
+
+	sessions []session.SessionInfo
+	selected int
+
+	// stream delivers the messages of the request in flight; streaming is
+	// set until it is done, and dirty when the response grew since the
+	// transcript was last drawn. cancel stops the response, and quitting
+	// is set when the TUI quits once it has been recorded.
+	stream    chan tea.Msg
+	streaming bool
+	dirty     bool
+	started   time.Time
+	firstByte time.Duration
+	cancel    context.CancelFunc
+	quitting  bool
+
+	// usage and requests total the requests made in this run; latency and
+	// firstToken are those of the latest request
+	usage      perplexity.Usage
+	requests   int
+	latency    time.Duration
+	firstToken time.Duration
+
+	// status is a message shown in the status bar until the next action.
+	// notices collects the session's notices, which would corrupt the
+	// screen if printed, for the status bar.
+	status      string
+	statusError bool
+	notices     *noticeLog
+}
+
+// noticeLog collects notices reported by a session
+type noticeLog struct {
+	mu      sync.Mutex
+	notices []string
+}
+
+// add records a notice
+func (l *noticeLog) add(notice string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.notices = append(l.notices, notice)
+}
+
+// take returns the notices recorded since the last call
+func (l *noticeLog) take() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	notices := l.notices
+	l.notices = nil
+	return notices
+}
+
+// newTUIModel returns the TUI showing the conversation of is
+func newTUIModel(cfg *config.Config, sessionManager *session.Manager, is *InteractiveSession) *tuiModel {
+	input := textarea.New()
+	input.Placeholder = "Ask anything..."
+	input.Prompt = ""
+	input.ShowLineNumbers = false
+	input.CharLimit = 0
+	input.SetHeight(inputHeight)
+	input.KeyMap.InsertNewline = key.NewBinding(key.WithKeys("alt+enter", "ctrl+j"))
+	input.Focus()
+
+	search := textinput.New()
+	search.Prompt = "/ "
+	search.Placeholder = "search"
+
+	// Only keys the input box does not use scroll the transcript
+	transcript := viewport.New(0, 0)
+	transcript.KeyMap = viewport.KeyMap{
+		PageUp:   key.NewBinding(key.WithKeys("pgup")),
+		PageDown: key.NewBinding(key.WithKeys("pgdown")),
+	}
+
+	m := &tuiModel{
+		config:         cfg,
+		sessionManager: sessionManager,
+		transcript:     transcript,
+		input:          input,
+		search:         search,
+		spinner:        spinner.New(spinner.WithSpinner(spinner.MiniDot)),
+		showSidebar:    true,
+		style:          ui.ResolveStyle(cfg),
+		notices:        &noticeLog{},
+	}
+	m.setSession(is)
+	m.loadTranscript()
+	return m
+}
+
+// Init loads the session list
+func (m *tuiModel) Init() tea.Cmd {
+	return tea.Batch(textarea.Blink, m.listSessions(""))
+}
+
+// Update handles a message and returns the commands it starts
+func (m *tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.layout()
+		return m, nil
+
+	case tea.KeyMsg:
+		return m, m.handleKey(msg)
+
+	case tea.MouseMsg:
+		var cmd tea.Cmd
+		m.transcript, cmd = m.transcript.Update(msg)
+		return m, cmd
+
+	case streamDeltaMsg:
+		if m.firstByte == 0 {
+			m.firstByte = time.Since(m.started)
+		}
+		last := &m.entries[len(m.entries)-1]
+		last.content += string(msg)
+		last.width = 0
+		m.dirty = true
+		return m, waitForStream(m.stream)
+
+	case streamDoneMsg:
+		m.finishRequest(msg)
+		if m.quitting {
+			return m, tea.Quit
+		}
+		return m, m.listSessions(m.search.Value())
+
+	case sessionsMsg:
+		// Drop results of a search that has since changed
+		if msg.query != m.search.Value() {
+			return m, nil
+		}
+		if msg.err != nil {
+			m.setStatus(fmt.Sprintf("Failed to list sessions: %v", msg.err), true)
+			return m, nil
+		}
+		m.sessions = msg.sessions
+		m.selected = min(m.selected, max(len(m.sessions)-1, 0))
+		return m, nil
+
+	case spinner.TickMsg:
+		if !m.streaming {
+			return m, nil
+		}
+		// Redraw the growing response at most once per tick
+		if m.dirty {
+			m.dirty = false
+			m.refreshTranscript()
+		}
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+// handleKey handles a keypress for the focused part of the UI
+func (m *tuiModel) handleKey(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "ctrl+c":
+		if m.streaming && !m.quitting {
+			// Quit once the part of the response that has arrived is
+			// recorded and saved
+			m.cancel()
+			m.quitting = true
+			m.setStatus("Stopping the response; press Ctrl+C again to quit at once", false)
+			return nil
+		}
+		return tea.Quit
+	case "ctrl+n":
+		m.newConversation()
+		return nil
+	case "ctrl+b":
+		m.showSidebar = !m.showSidebar
+		if !m.showSidebar {
+			m.setFocus(focusInput)
+		}
+		m.layout()
+		return nil
+	case "ctrl+f":
+		m.showSidebar = true
+		m.layout()
+		m.setFocus(focusSearch)
+		return textinput.Blink
+	case "tab":
+		if m.focus == focusInput && m.sidebarVisible() {
+			m.setFocus(focusSidebar)
+		} else {
+			m.setFocus(focusInput)
+		}
+		return nil
+	case "pgup", "pgdown":
+		var cmd tea.Cmd
+		m.transcript, cmd = m.transcript.Update(msg)
+		return cmd
+	}
+
+	switch m.focus {
+	case focusSidebar:
+		return m.handleSidebarKey(msg)
+	case focusSearch:
+		return m.handleSearchKey(msg)
+	}
+
+	if msg.Type == tea.KeyEnter {
+		return m.submit()
+	}
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return cmd
+}
+
+// handleSidebarKey moves through and opens sessions in the sidebar
+func (m *tuiModel) handleSidebarKey(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "up", "k":
+		m.selected = max(m.selected-1, 0)
+	case "down", "j":
+		m.selected = min(m.selected+1, max(len(m.sessions)-1, 0))
+	case "home", "g":
+		m.selected = 0
+	case "end", "G":
+		m.selected = max(len(m.sessions)-1, 0)
+	case "/":
+		m.setFocus(focusSearch)
+		return textinput.Blink
+	case "esc":
+		m.setFocus(focusInput)
+	case "enter":
+		if m.selected < len(m.sessions) {
+			m.openSession(m.sessions[m.selected].ID)
+		}
+	}
+	return nil
+}
+
+// handleSearchKey edits the sidebar search, listing matches as it changes
+func (m *tuiModel) handleSearchKey(msg tea.KeyMsg) tea.Cmd {
+	switch msg.Type {
+	case tea.KeyEnter, tea.KeyDown:
+		m.setFocus(focusSidebar)
+		return nil
+	case tea.KeyEsc:
+		m.search.SetValue("")
+		m.setFocus(focusSidebar)
+		return m.listSessions("")
+	}
+
+	query := m.search.Value()
+	var cmd tea.Cmd
+	m.search, cmd = m.search.Update(msg)
+	if m.search.Value() == query {
+		return cmd
+	}
+	m.selected = 0
+	return tea.Batch(cmd, m.listSessions(m.search.Value()))
+}
+
+// setFocus moves keyboard focus
+func (m *tuiModel) setFocus(focus tuiFocus) {
+	m.focus = focus
+	m.input.Blur()
+	m.search.Blur()
+	switch focus {
+	case focusInput:
+		m.input.Focus()
+	case focusSearch:
+		m.search.Focus()
+	}
+}
+
+// submit sends the message in the input box, or runs it if it is one of
+// the few slash commands the TUI supports
+func (m *tuiModel) submit() tea.Cmd {
+	input := strings.TrimSpace(m.input.Value())
+	if input == "" || m.streaming {
+		return nil
+	}
+	m.input.Reset()
+
+	if strings.HasPrefix(input, "//") {
+		input = input[1:]
+	} else if strings.HasPrefix(input, "/") {
+		return m.runCommand(input)
+	}
+
+	if err := m.is.editor.History.Add(input); err != nil {
+		session.Debugf("Failed to record input history: %v", err)
+	}
+
+	m.entries = append(m.entries,
+		tuiEntry{role: "user", content: input},
+		tuiEntry{role: "assistant"},
+	)
+	m.setStatus("", false)
+	m.streaming = true
+	m.dirty = false
+	m.started = time.Now()
+	m.firstByte = 0
+	m.refreshTranscript()
+	m.transcript.GotoBottom()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	m.stream = make(chan tea.Msg, 64)
+	go streamResponse(ctx, m.is, input, m.notices, m.stream)
+	return tea.Batch(waitForStream(m.stream), m.spinner.Tick)
+}
+
+// runCommand runs a slash command typed in the input box
+func (m *tuiModel) runCommand(input string) tea.Cmd {
+	fields := strings.Fields(input)
+	switch fields[0] {
+	case ExitCommand, "/quit", "/exit":
+		return tea.Quit
+	case "/new":
+		m.newConversation()
+	case "/reasoning":
+		status, err := setShowReasoning(m.config, fields[1:min(len(fields), 2)])
+		if err != nil {
+			m.setStatus(err.Error(), true)
+			return nil
+		}
+		for i := range m.entries {
+			m.entries[i].width = 0
+		}
+		m.refreshTranscript()
+		m.setStatus(status, false)
+	case "/model":
+		if len(fields) == 1 {
+			m.setStatus(fmt.Sprintf("Model: %s", m.is.model), false)
+			return nil
+		}
+		m.is.setModel(fields[1])
+		if err := m.is.store(nil); err != nil {
+			m.setStatus(fmt.Sprintf("Failed to save session: %v", err), true)
+			return nil
+		}
+		m.setStatus(fmt.Sprintf("Model set to %s", fields[1]), false)
+	default:
+		m.setStatus(fmt.Sprintf("%s is not available here; the TUI supports /new, /model, /reasoning and /q (start the message with // to send it)", fields[0]), true)
+	}
+	return nil
+}
+
+// streamResponse sends input and delivers the response on out as it
+// arrives. The exchange is then recorded and saved before a streamDoneMsg
+// ends the stream with the notices reported meanwhile, and the session is
+// titled afterwards so the response is not held up. If ctx is cancelled, the
+// part of the response that has arrived is recorded.
+func streamResponse(ctx context.Context, is *InteractiveSession, input string, notices *noticeLog, out chan<- tea.Msg) {
+	started := time.Now()
+	resp, err := is.client.CreateCompletionStreamContext(ctx, is.newRequest(input), func(delta string) {
+		out <- streamDeltaMsg(delta)
+	})
+	if errors.Is(err, context.Canceled) && resp != nil && resp.Choices[0].Message.Content != "" {
+		err = nil
+	}
+	done := streamDoneMsg{err: err, latency: time.Since(started)}
+	if err == nil {
+		is.addUsage(resp.Usage)
+		done.usage = resp.Usage
+		done.parsed = perplexity.ParseResponse(resp)
+		is.recordExchange(input, done.parsed)
+		done.saveErr = is.store(nil)
+	}
+	done.notices = notices.take()
+	out <- done
+
+	if err == nil {
+		is.titleSession()
+	}
+}
+
+// waitForStream returns a command receiving the next message of a request
+func waitForStream(stream <-chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		return <-stream
+	}
+}
+
+// finishRequest shows the completed response and its usage
+func (m *tuiModel) finishRequest(msg streamDoneMsg) {
+	m.cancel()
+	m.streaming = false
+	m.stream = nil
+	m.latency = msg.latency
+	m.firstToken = m.firstByte
+	last := &m.entries[len(m.entries)-1]
+	last.width = 0
+
+	if msg.err != nil {
+		last.content = fmt.Sprintf("API request failed: %v", msg.err)
+		last.failed = true
+		m.setStatus("Request failed", true)
+		m.refreshTranscript()
+		return
+	}
+
+	m.usage.Add(msg.usage)
+	m.requests++
+
+	last.content = perplexity.FormatWithReferences(msg.parsed)
+	last.reasoning = msg.parsed.Reasoning
+	if msg.saveErr != nil {
+		m.setStatus(fmt.Sprintf("Failed to save session: %v", msg.saveErr), true)
+	} else if len(msg.notices) > 0 {
+		m.setStatus(strings.Join(msg.notices, " "), false)
+	}
+	m.updateSessionLabel()
+	m.refreshTranscript()
+}
+
+// newConversation saves the current conversation and starts an empty one
+func (m *tuiModel) newConversation() {
+	if m.streaming {
+		m.setStatus("Wait for the response to finish first", true)
+		return
+	}
+	if err := m.is.store(nil); err != nil {
+		m.setStatus(fmt.Sprintf("Failed to save session: %v", err), true)
+		return
+	}
+
+	m.setSession(newInteractiveSession(m.config, m.sessionManager, m.is.model))
+	m.loadTranscript()
+	m.setFocus(focusInput)
+	m.setStatus("New conversation", false)
+}
+
+// openSession saves the current conversation and switches to the session
+// with the given ID
+func (m *tuiModel) openSession(id string) {
+	if m.streaming {
+		m.setStatus("Wait for the response to finish first", true)
+		return
+	}
+	if err := m.is.store(nil); err != nil {
+		m.setStatus(fmt.Sprintf("Failed to save session: %v", err), true)
+		return
+	}
+
+	s, err := m.sessionManager.Load(id)
+	if err != nil {
+		m.setStatus(fmt.Sprintf("Failed to open session: %v", err), true)
+		return
+	}
+
+	m.setSession(ResumeInteractiveSession(m.config, m.sessionManager, s))
+	m.loadTranscript()
+	m.setFocus(focusInput)
+	m.setStatus(fmt.Sprintf("Opened [%s]", s.ShortID), false)
+}
+
+// setSession makes is the conversation shown, with its notices collected
+// for the status bar
+func (m *tuiModel) setSession(is *InteractiveSession) {
+	is.notify = m.notices.add
+	m.is = is
+}
+
+// updateSessionLabel names the current session for the status bar
+func (m *tuiModel) updateSessionLabel() {
+	s := m.is.session
+	switch {
+	case s == nil:
+		m.sessionLabel = "new conversation"
+	case s.Metadata.Title != "":
+		m.sessionLabel = fmt.Sprintf("[%s] %s", s.ShortID, s.Metadata.Title)
+	default:
+		m.sessionLabel = fmt.Sprintf("[%s]", s.ShortID)
+	}
+}
+
+// loadTranscript shows the messages of the current session
+func (m *tuiModel) loadTranscript() {
+	m.updateSessionLabel()
+	m.entries = nil
+	if m.is.session != nil {
+		for _, msg := range m.is.session.Messages {
+			m.entries = append(m.entries, tuiEntry{role: msg.Role, content: msg.Content, reasoning: msg.Reasoning})
+		}
+	}
+	m.refreshTranscript()
+	m.transcript.GotoBottom()
+}
+
+// listSessions returns a command listing the sessions for the sidebar,
+// newest first with pinned sessions on top, or those matching query
+func (m *tuiModel) listSessions(query string) tea.Cmd {
+	sessionManager := m.sessionManager
+	return func() tea.Msg {
+		var sessions []session.SessionInfo
+		var err error
+		if query == "" {
+			sessions, err = sessionManager.List()
+			session.SortPinnedFirst(sessions)
+		} else {
+			sessions, err = sessionManager.Search(query)
+		}
+		return sessionsMsg{query: query, sessions: sessions, err: err}
+	}
+}
+
+// setStatus shows a message in the status bar, after the notices reported
+// since the last one, such as how a save conflict was resolved
+func (m *tuiModel) setStatus(status string, isError bool) {
+	m.status = strings.TrimSpace(strings.Join(append(m.notices.take(), status), " "))
+	m.statusError = isError
+}
+
+func init() {
+	rootCmd.AddCommand(tuiCmd)
+}
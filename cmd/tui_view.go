@@ -0,0 +1,265 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
+	"perplexity-cli/pkg/perplexity"
+	"perplexity-cli/pkg/session"
+	"perplexity-cli/pkg/ui"
+)
+
+var (
+	tuiUserStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("6")).Bold(true)
+	tuiAssistantStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("5")).Bold(true)
+	tuiErrorStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+	tuiFaintStyle     = lipgloss.NewStyle().Faint(true)
+	tuiTitleStyle     = lipgloss.NewStyle().Bold(true)
+	tuiSelectedStyle  = lipgloss.NewStyle().Reverse(true)
+	tuiStatusStyle    = lipgloss.NewStyle().Background(lipgloss.Color("236")).Foreground(lipgloss.Color("252"))
+	tuiStatusError    = tuiStatusStyle.Foreground(lipgloss.Color("9"))
+
+	tuiInputStyle = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("8"))
+	tuiSidebar    = lipgloss.NewStyle().Border(lipgloss.NormalBorder(), false, true, false, false).BorderForeground(lipgloss.Color("8"))
+	// tuiFocusColor marks the border of the focused part
+	tuiFocusColor = lipgloss.Color("6")
+)
+
+// sidebarVisible reports whether the sidebar is shown; it is hidden in
+// narrow terminals
+func (m *tuiModel) sidebarVisible() bool {
+	return m.showSidebar && m.width >= minSidebarTerminalWidth
+}
+
+// mainWidth returns the width of the transcript and input box
+func (m *tuiModel) mainWidth() int {
+	width := m.width
+	if m.sidebarVisible() {
+		width -= sidebarWidth
+	}
+	return max(width, 20)
+}
+
+// layout sizes the parts of the UI for the terminal and redraws the
+// transcript
+func (m *tuiModel) layout() {
+	if !m.sidebarVisible() && m.focus != focusInput {
+		m.setFocus(focusInput)
+	}
+
+	width := m.mainWidth()
+	m.input.SetWidth(width - 2)
+	m.search.Width = sidebarWidth - 4 - len(m.search.Prompt)
+
+	// The input box has a border above and below, and the status bar takes
+	// the last line
+	m.transcript.Width = width
+	m.transcript.Height = max(m.height-inputHeight-3, 1)
+
+	renderer, err := ui.NewRenderer(m.style, width-2)
+	if err != nil {
+		renderer = nil
+	}
+	m.renderer = renderer
+	m.refreshTranscript()
+}
+
+// refreshTranscript redraws the transcript, following the end of the
+// conversation unless it was scrolled up
+func (m *tuiModel) refreshTranscript() {
+	if m.transcript.Width == 0 {
+		return
+	}
+
+	if len(m.entries) == 0 {
+		m.transcript.SetContent(tuiFaintStyle.Render("\n  Type a message below and press Enter to send it.\n  Tab moves to the session list."))
+		return
+	}
+
+	atBottom := m.transcript.AtBottom()
+	var b strings.Builder
+	for i := range m.entries {
+		b.WriteString(m.renderEntry(&m.entries[i]))
+		b.WriteString("\n")
+	}
+	m.transcript.SetContent(b.String())
+	if atBottom {
+		m.transcript.GotoBottom()
+	}
+}
+
+// renderEntry renders a transcript entry for the transcript width, caching
+// the result
+func (m *tuiModel) renderEntry(e *tuiEntry) string {
+	width := m.transcript.Width
+	if e.width == width {
+		return e.rendered
+	}
+
+	var header, body string
+	plain := lipgloss.NewStyle().Width(width - 2).MarginLeft(2)
+	switch e.role {
+	case "user":
+		header = tuiUserStyle.Render("You")
+		body = plain.Render(e.content)
+	case "assistant":
+		header = tuiAssistantStyle.Render("PPLX")
+		body = m.renderAnswer(e, plain)
+	default:
+		header = tuiTitleStyle.Render(e.role)
+		body = plain.Render(e.content)
+	}
+
+	switch {
+	case e.failed:
+		body = plain.Inherit(tuiErrorStyle).Render(e.content)
+	case e.content == "":
+		body = plain.Inherit(tuiFaintStyle).Render("...")
+	}
+
+	e.rendered = header + "\n" + body + "\n"
+	e.width = width
+	return e.rendered
+}
+
+// renderAnswer renders a response with its reasoning dimmed before it when
+// show_reasoning is on. While the reasoning of a streaming response is
+// hidden, the answer is replaced by a note that the model is thinking.
+func (m *tuiModel) renderAnswer(e *tuiEntry, plain lipgloss.Style) string {
+	reasoning, answer := perplexity.SplitReasoning(m.is.model, e.content)
+	if e.reasoning != "" {
+		reasoning = e.reasoning
+	}
+	// A stream may stop partway through the opening tag
+	if perplexity.IsReasoningModel(m.is.model) && strings.HasPrefix("<think>", answer) {
+		answer = ""
+	}
+
+	var parts []string
+	if reasoning != "" && m.config.ShowReasoning {
+		parts = append(parts, plain.Inherit(tuiFaintStyle).Render(reasoning))
+	}
+	switch {
+	case answer != "":
+		parts = append(parts, m.renderMarkdown(answer, plain))
+	case reasoning != "" && !m.config.ShowReasoning:
+		parts = append(parts, plain.Inherit(tuiFaintStyle).Render("Thinking..."))
+	case reasoning == "":
+		parts = append(parts, plain.Inherit(tuiFaintStyle).Render("..."))
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// renderMarkdown renders content as markdown, or wrapped with plain if the
+// renderer is unavailable or fails
+func (m *tuiModel) renderMarkdown(content string, plain lipgloss.Style) string {
+	if m.renderer == nil || !m.config.UseGlow {
+		return plain.Render(content)
+	}
+
+	rendered, err := m.renderer.Render(content)
+	if err != nil {
+		return plain.Render(content)
+	}
+	return strings.Trim(rendered, "\n")
+}
+
+// View draws the UI
+func (m *tuiModel) View() string {
+	if m.width == 0 {
+		return ""
+	}
+
+	inputStyle := tuiInputStyle
+	if m.focus == focusInput {
+		inputStyle = inputStyle.BorderForeground(tuiFocusColor)
+	}
+	main := lipgloss.JoinVertical(lipgloss.Left, m.transcript.View(), inputStyle.Render(m.input.View()))
+
+	body := main
+	if m.sidebarVisible() {
+		body = lipgloss.JoinHorizontal(lipgloss.Top, m.viewSidebar(), main)
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, body, m.viewStatus())
+}
+
+// viewSidebar draws the session list with the search box above it. Each
+// session takes two lines: its short ID and name, then its title.
+func (m *tuiModel) viewSidebar() string {
+	height := m.height - 1
+	width := sidebarWidth - 1
+	inner := width - 2
+
+	style := tuiSidebar
+	if m.focus != focusInput {
+		style = style.BorderForeground(tuiFocusColor)
+	}
+
+	lines := []string{tuiTitleStyle.Render(fmt.Sprintf("Sessions (%d)", len(m.sessions))), m.search.View(), ""}
+
+	visible := max((height-len(lines))/2, 1)
+	offset := max(m.selected-visible+1, 0)
+	current := ""
+	if m.is.session != nil && !m.streaming {
+		current = m.is.session.ID
+	}
+
+	for i := offset; i < len(m.sessions) && i < offset+visible; i++ {
+		info := m.sessions[i]
+		marker := "  "
+		if info.ID == current {
+			marker = "● "
+		}
+
+		head := marker + info.ShortID
+		if info.Name != "" {
+			head += " " + info.Name
+		}
+		head = runewidth.Truncate(head, inner, "…")
+		title := "  " + runewidth.Truncate(session.TruncateQuery(info.DisplayTitle(), 200), inner-2, "…")
+
+		if i == m.selected && m.focus != focusInput {
+			head = tuiSelectedStyle.Render(runewidth.FillRight(head, inner))
+		} else {
+			head = tuiTitleStyle.Render(head)
+		}
+		lines = append(lines, head, tuiFaintStyle.Render(title))
+	}
+	if len(m.sessions) == 0 {
+		lines = append(lines, tuiFaintStyle.Render("No sessions found."))
+	}
+
+	return style.Width(width).Height(height).MaxHeight(height).Padding(0, 1).Render(strings.Join(lines, "\n"))
+}
+
+// viewStatus draws the status bar: the model and session on the left, and
+// progress, token usage and latency on the right
+func (m *tuiModel) viewStatus() string {
+	left := fmt.Sprintf(" %s │ %s", m.is.model, m.sessionLabel)
+
+	var right string
+	switch {
+	case m.streaming:
+		right = fmt.Sprintf("%s %s ", m.spinner.View(), formatLatency(time.Since(m.started)))
+	case m.requests > 0:
+		right = fmt.Sprintf("tokens %d in / %d out │ %s (first token %s) ",
+			m.usage.PromptTokens, m.usage.CompletionTokens, formatLatency(m.latency), formatLatency(m.firstToken))
+	case m.latency > 0:
+		right = fmt.Sprintf("%s ", formatLatency(m.latency))
+	}
+
+	if m.status != "" {
+		left += " │ " + m.status
+	}
+	space := m.width - runewidth.StringWidth(right)
+	left = runewidth.FillRight(runewidth.Truncate(left, max(space, 0), "…"), max(space, 0))
+
+	style := tuiStatusStyle
+	if m.statusError {
+		style = tuiStatusError
+	}
+	return style.Render(left) + tuiStatusStyle.Render(right)
+}
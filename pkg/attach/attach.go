@@ -0,0 +1,305 @@
+// Package attach reads local files to include in a message as fenced code
+// blocks. Patterns may name files, globs or directories; directories are
+// expanded recursively, skipping what .gitignore files exclude.
+package attach
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"perplexity-cli/pkg/conversation"
+)
+
+const (
+	// DefaultMaxFileSize is the largest file attached by default, in bytes
+	DefaultMaxFileSize = 256 * 1024
+	// DefaultMaxTokens is the default budget for all attached files, in
+	// estimated tokens
+	DefaultMaxTokens = 32000
+
+	// sniffLength is how much of a file is checked for NUL bytes
+	sniffLength = 8000
+)
+
+var (
+	// ErrBinary is returned for files that are not text
+	ErrBinary = errors.New("binary file")
+	// ErrTooLarge is returned for files over the size limit
+	ErrTooLarge = errors.New("file too large")
+	// ErrOverBudget is returned when the files exceed the token budget
+	ErrOverBudget = errors.New("attachments over token budget")
+)
+
+// File is an attached file
+type File struct {
+	// Path is the path as given or found, used as the label in messages
+	Path string
+	// AbsPath is the absolute path, recorded in the session
+	AbsPath string
+	Content string
+	Size    int64
+}
+
+// Tokens estimates the tokens the file takes in a message
+func (f File) Tokens() int {
+	return conversation.EstimateTokens(f.Content)
+}
+
+// Skipped is a file found in a directory that was not attached
+type Skipped struct {
+	Path   string
+	Reason string
+}
+
+// Limits bounds what can be attached; zero values use the defaults
+type Limits struct {
+	// MaxFileSize is the largest file attached, in bytes
+	MaxFileSize int64
+	// MaxTokens is the budget for all attached files, in estimated tokens
+	MaxTokens int
+}
+
+func (l Limits) maxFileSize() int64 {
+	if l.MaxFileSize > 0 {
+		return l.MaxFileSize
+	}
+	return DefaultMaxFileSize
+}
+
+func (l Limits) maxTokens() int {
+	if l.MaxTokens > 0 {
+		return l.MaxTokens
+	}
+	return DefaultMaxTokens
+}
+
+// Collect reads the files matching patterns. A pattern is a file, a glob or
+// a directory. Files named directly or matched by a glob must be readable
+// text within the size limit; files found by expanding a directory are
+// skipped when ignored by .gitignore, binary or too large. The token budget
+// is not checked, since callers may add to earlier attachments; see
+// CheckBudget.
+func Collect(patterns []string, limits Limits) ([]File, []Skipped, error) {
+	var files []File
+	var skipped []Skipped
+	seen := make(map[string]bool)
+
+	add := func(path string, fromDir bool) error {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if seen[abs] {
+			return nil
+		}
+		seen[abs] = true
+
+		file, err := readFile(path, abs, limits)
+		if err != nil {
+			if fromDir && (errors.Is(err, ErrBinary) || errors.Is(err, ErrTooLarge)) {
+				skipped = append(skipped, Skipped{Path: path, Reason: reason(err)})
+				return nil
+			}
+			return err
+		}
+		files = append(files, file)
+		return nil
+	}
+
+	for _, pattern := range patterns {
+		paths, err := expand(pattern)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, nil, fmt.Errorf("cannot attach %s: %w", path, err)
+			}
+			if !info.IsDir() {
+				if err := add(path, false); err != nil {
+					return nil, nil, err
+				}
+				continue
+			}
+
+			found, err := walkDir(path)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, p := range found {
+				if err := add(p, true); err != nil {
+					return nil, nil, err
+				}
+			}
+		}
+	}
+
+	return files, skipped, nil
+}
+
+// expand returns the paths a pattern names: the matches of a glob, or the
+// pattern itself
+func expand(pattern string) ([]string, error) {
+	if !strings.ContainsAny(pattern, "*?[") {
+		return []string{pattern}, nil
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no files match %s", pattern)
+	}
+	return matches, nil
+}
+
+// walkDir returns the files below dir in lexical order, leaving out the
+// .git directory and paths excluded by .gitignore files in dir, below it,
+// or above it within the same repository
+func walkDir(dir string) ([]string, error) {
+	lists := ancestorIgnoreLists(dir)
+	// Directories are visited before their contents, so each directory's
+	// rules are loaded before they are needed
+	active := make(map[string]*ignoreList)
+
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		if path != dir {
+			if d.IsDir() && d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			if ignored(applicable(lists, active, abs), abs, d.IsDir()) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		if d.IsDir() {
+			if list := loadIgnoreList(abs); list != nil {
+				active[abs] = list
+			}
+			return nil
+		}
+		if d.Type().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory %s: %w", dir, err)
+	}
+	return files, nil
+}
+
+// applicable returns the ignore lists that apply to path: those above the
+// expanded directory, then those of the directories containing path, outermost
+// first
+func applicable(lists []*ignoreList, active map[string]*ignoreList, path string) []*ignoreList {
+	var dirs []string
+	for d := filepath.Dir(path); ; d = filepath.Dir(d) {
+		if _, ok := active[d]; ok {
+			dirs = append(dirs, d)
+		}
+		if d == filepath.Dir(d) {
+			break
+		}
+	}
+	sort.Slice(dirs, func(i, j int) bool { return len(dirs[i]) < len(dirs[j]) })
+
+	result := append([]*ignoreList(nil), lists...)
+	for _, d := range dirs {
+		result = append(result, active[d])
+	}
+	return result
+}
+
+// readFile reads a text file within the size limit
+func readFile(path, abs string, limits Limits) (File, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return File{}, fmt.Errorf("cannot attach %s: %w", path, err)
+	}
+	if info.Size() > limits.maxFileSize() {
+		return File{}, fmt.Errorf("cannot attach %s: %w: %s is over the %s limit (attach_max_file_size)",
+			path, ErrTooLarge, FormatSize(info.Size()), FormatSize(limits.maxFileSize()))
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return File{}, fmt.Errorf("cannot attach %s: %w", path, err)
+	}
+	if isBinary(data) {
+		return File{}, fmt.Errorf("cannot attach %s: %w; only text files can be attached", path, ErrBinary)
+	}
+
+	return File{Path: filepath.ToSlash(path), AbsPath: abs, Content: string(data), Size: int64(len(data))}, nil
+}
+
+// isBinary reports whether data looks like a binary file: it contains a NUL
+// byte near the start or is not valid UTF-8
+func isBinary(data []byte) bool {
+	if bytes.IndexByte(data[:min(len(data), sniffLength)], 0) >= 0 {
+		return true
+	}
+	return !utf8.Valid(data)
+}
+
+// reason describes why a file found in a directory was skipped
+func reason(err error) string {
+	if errors.Is(err, ErrBinary) {
+		return "binary"
+	}
+	return "too large"
+}
+
+// CheckBudget returns an error if files together exceed the token budget
+func CheckBudget(files []File, limits Limits) error {
+	total := 0
+	for _, f := range files {
+		total += f.Tokens()
+	}
+	if total <= limits.maxTokens() {
+		return nil
+	}
+
+	// Name the largest files, which are the ones worth leaving out
+	sorted := append([]File(nil), files...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Size > sorted[j].Size })
+	var largest []string
+	for _, f := range sorted[:min(len(sorted), 3)] {
+		largest = append(largest, fmt.Sprintf("%s (~%d tokens)", f.Path, f.Tokens()))
+	}
+	return fmt.Errorf("%w: %d files take ~%d tokens, over the budget of %d (attach_max_tokens); largest: %s",
+		ErrOverBudget, len(files), total, limits.maxTokens(), strings.Join(largest, ", "))
+}
+
+// FormatSize formats a byte count for messages
+func FormatSize(n int64) string {
+	switch {
+	case n >= 1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1024*1024))
+	case n >= 1024:
+		return fmt.Sprintf("%.1f KB", float64(n)/1024)
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
@@ -0,0 +1,208 @@
+package attach
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFiles creates files below dir from a map of slash-separated paths to
+// contents
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("MkdirAll() failed: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile() failed: %v", err)
+		}
+	}
+}
+
+// paths returns the paths of files relative to dir
+func paths(t *testing.T, dir string, files []File) []string {
+	t.Helper()
+	var result []string
+	for _, f := range files {
+		rel, err := filepath.Rel(dir, f.AbsPath)
+		if err != nil {
+			t.Fatalf("Rel() failed: %v", err)
+		}
+		result = append(result, filepath.ToSlash(rel))
+	}
+	return result
+}
+
+func TestCollect(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		".git/HEAD":               "ref: refs/heads/main\n",
+		".gitignore":              "*.log\nbuild/\n!keep.log\n",
+		"main.go":                 "package main\n",
+		"docs/a.md":               "# A\n",
+		"docs/b.md":               "# B\n",
+		"docs/notes.txt":          "notes\n",
+		"src/app.go":              "package app\n",
+		"src/debug.log":           "noise\n",
+		"src/keep.log":            "kept\n",
+		"src/build/out.go":        "package out\n",
+		"src/gen/.gitignore":      "*.pb.go\n",
+		"src/gen/api.pb.go":       "package gen\n",
+		"src/gen/api.go":          "package gen\n",
+		"src/gen/trace.log":       "noise\n",
+		"src/image.png":           "\x89PNG\x00\x00",
+		"src/vendor/deep/lib.go":  "package lib\n",
+		"src/vendor/deep/lib.bin": "\xff\xfe",
+	})
+
+	tests := []struct {
+		name     string
+		patterns []string
+		expected []string
+		skipped  []string
+	}{
+		{
+			name:     "file and glob",
+			patterns: []string{filepath.Join(dir, "main.go"), filepath.Join(dir, "docs", "*.md")},
+			expected: []string{"main.go", "docs/a.md", "docs/b.md"},
+		},
+		{
+			name:     "directory respects gitignore",
+			patterns: []string{filepath.Join(dir, "src")},
+			expected: []string{"src/app.go", "src/gen/.gitignore", "src/gen/api.go", "src/keep.log", "src/vendor/deep/lib.go"},
+			skipped:  []string{"image.png", "lib.bin"},
+		},
+		{
+			name:     "subdirectory uses rules above it",
+			patterns: []string{filepath.Join(dir, "src", "gen")},
+			expected: []string{"src/gen/.gitignore", "src/gen/api.go"},
+		},
+		{
+			name:     "duplicates attached once",
+			patterns: []string{filepath.Join(dir, "main.go"), filepath.Join(dir, "*.go")},
+			expected: []string{"main.go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, skipped, err := Collect(tt.patterns, Limits{})
+			if err != nil {
+				t.Fatalf("Collect() failed: %v", err)
+			}
+			if got := paths(t, dir, files); strings.Join(got, " ") != strings.Join(tt.expected, " ") {
+				t.Errorf("Collect() = %q, expected %q", got, tt.expected)
+			}
+
+			var names []string
+			for _, s := range skipped {
+				names = append(names, filepath.Base(s.Path))
+			}
+			if strings.Join(names, " ") != strings.Join(tt.skipped, " ") {
+				t.Errorf("skipped = %q, expected %q", names, tt.skipped)
+			}
+		})
+	}
+}
+
+func TestCollectErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"image.png": "\x89PNG\x00\x00",
+		"big.txt":   strings.Repeat("x", 200),
+		"dir/big":   strings.Repeat("y", 200),
+	})
+
+	tests := []struct {
+		name    string
+		pattern string
+		target  error
+		message string
+	}{
+		{"binary", filepath.Join(dir, "image.png"), ErrBinary, "only text files"},
+		{"too large", filepath.Join(dir, "big.txt"), ErrTooLarge, "over the 100 bytes limit"},
+		{"missing", filepath.Join(dir, "missing.go"), os.ErrNotExist, "missing.go"},
+		{"no matches", filepath.Join(dir, "*.go"), nil, "no files match"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Collect([]string{tt.pattern}, Limits{MaxFileSize: 100})
+			if err == nil {
+				t.Fatal("Collect() succeeded, expected an error")
+			}
+			if tt.target != nil && !errors.Is(err, tt.target) {
+				t.Errorf("Collect() error = %v, expected %v", err, tt.target)
+			}
+			if !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("Collect() error = %q, expected it to contain %q", err, tt.message)
+			}
+		})
+	}
+
+	// Files over the limit found in a directory are skipped, not refused
+	files, skipped, err := Collect([]string{filepath.Join(dir, "dir")}, Limits{MaxFileSize: 100})
+	if err != nil || len(files) != 0 || len(skipped) != 1 || skipped[0].Reason != "too large" {
+		t.Errorf("Collect(dir) = %v, %v, %v; expected the file skipped as too large", files, skipped, err)
+	}
+}
+
+func TestCheckBudget(t *testing.T) {
+	files := []File{
+		{Path: "small.go", Content: strings.Repeat("a", 40), Size: 40},
+		{Path: "large.go", Content: strings.Repeat("b", 400), Size: 400},
+	}
+
+	if err := CheckBudget(files, Limits{MaxTokens: 1000}); err != nil {
+		t.Errorf("CheckBudget() within budget failed: %v", err)
+	}
+
+	err := CheckBudget(files, Limits{MaxTokens: 50})
+	if !errors.Is(err, ErrOverBudget) {
+		t.Fatalf("CheckBudget() = %v, expected ErrOverBudget", err)
+	}
+	if !strings.Contains(err.Error(), "largest: large.go") {
+		t.Errorf("CheckBudget() error = %q, expected it to name the largest file first", err)
+	}
+}
+
+func TestMessage(t *testing.T) {
+	files := []File{
+		{Path: "main.go", Content: "package main\n", Size: 13},
+		{Path: "README.md", Content: "Run:\n```sh\nmake\n```", Size: 20},
+	}
+
+	expected := "File: main.go\n```go\npackage main\n```\n\n" +
+		"File: README.md\n````markdown\nRun:\n```sh\nmake\n```\n````\n\n" +
+		"Explain the flow"
+	if got := Message(files, "Explain the flow"); got != expected {
+		t.Errorf("Message() = %q, expected %q", got, expected)
+	}
+	if got := Message(nil, "plain"); got != "plain" {
+		t.Errorf("Message(nil) = %q, expected the text unchanged", got)
+	}
+
+	expected = "[Attached main.go (13 bytes), contents not stored]\n" +
+		"[Attached README.md (20 bytes), contents not stored]\n\nExplain the flow"
+	if got := Placeholder(files, "Explain the flow"); got != expected {
+		t.Errorf("Placeholder() = %q, expected %q", got, expected)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	earlier := []File{{AbsPath: "/a", Content: "old"}, {AbsPath: "/b"}}
+	added := []File{{AbsPath: "/a", Content: "new"}, {AbsPath: "/c"}}
+
+	merged := Merge(earlier, added)
+	var got []string
+	for _, f := range merged {
+		got = append(got, f.AbsPath+":"+f.Content)
+	}
+	if expected := "/b: /a:new /c:"; strings.Join(got, " ") != expected {
+		t.Errorf("Merge() = %q, expected %q", strings.Join(got, " "), expected)
+	}
+}
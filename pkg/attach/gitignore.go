@@ -0,0 +1,170 @@
+package attach
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignoreRule is a pattern from a .gitignore file
+type ignoreRule struct {
+	re *regexp.Regexp
+	// negate re-includes paths matched by earlier rules
+	negate bool
+	// dirOnly matches only directories
+	dirOnly bool
+	// basename matches the last path element at any depth, for patterns
+	// without a slash
+	basename bool
+}
+
+// ignoreList is the rules of one .gitignore file, which apply to paths
+// below dir
+type ignoreList struct {
+	dir   string
+	rules []ignoreRule
+}
+
+// loadIgnoreList reads the .gitignore file in dir, returning nil if there
+// is none
+func loadIgnoreList(dir string) *ignoreList {
+	data, err := os.ReadFile(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return nil
+	}
+	return &ignoreList{dir: dir, rules: parseIgnore(string(data))}
+}
+
+// parseIgnore parses the lines of a .gitignore file
+func parseIgnore(data string) []ignoreRule {
+	var rules []ignoreRule
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimRight(line, " ")
+
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimPrefix(line, `\`)
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		rule.basename = !strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		if line == "" {
+			continue
+		}
+
+		re, err := regexp.Compile("^" + globRegexp(line) + "$")
+		if err != nil {
+			continue
+		}
+		rule.re = re
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// globRegexp translates a gitignore glob to a regular expression: * and ?
+// do not match a slash, and ** matches any number of directories
+func globRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			b.WriteString("(/.*)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// ignored reports whether path is ignored by the lists, which are ordered
+// from the outermost directory in; later rules override earlier ones
+func ignored(lists []*ignoreList, path string, isDir bool) bool {
+	result := false
+	for _, list := range lists {
+		rel, err := filepath.Rel(list.dir, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		name := filepath.Base(path)
+
+		for _, rule := range list.rules {
+			if rule.dirOnly && !isDir {
+				continue
+			}
+			target := rel
+			if rule.basename {
+				target = name
+			}
+			if rule.re.MatchString(target) {
+				result = !rule.negate
+			}
+		}
+	}
+	return result
+}
+
+// ancestorIgnoreLists returns the .gitignore lists of the directories from
+// the root of the git repository containing dir down to dir's parent, so
+// rules set higher up apply when a subdirectory is expanded
+func ancestorIgnoreLists(dir string) []*ignoreList {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil
+	}
+
+	var dirs []string
+	for d := filepath.Dir(abs); ; d = filepath.Dir(d) {
+		dirs = append(dirs, d)
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			break
+		}
+		if d == filepath.Dir(d) {
+			// Not in a repository; only the directory's own rules apply
+			return nil
+		}
+	}
+
+	var lists []*ignoreList
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if list := loadIgnoreList(dirs[i]); list != nil {
+			lists = append(lists, list)
+		}
+	}
+	return lists
+}
@@ -0,0 +1,127 @@
+package attach
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// languages maps file extensions to the info string of their code blocks
+var languages = map[string]string{
+	".go":    "go",
+	".py":    "python",
+	".js":    "javascript",
+	".jsx":   "jsx",
+	".ts":    "typescript",
+	".tsx":   "tsx",
+	".rs":    "rust",
+	".java":  "java",
+	".kt":    "kotlin",
+	".c":     "c",
+	".h":     "c",
+	".cc":    "cpp",
+	".cpp":   "cpp",
+	".hpp":   "cpp",
+	".cs":    "csharp",
+	".rb":    "ruby",
+	".php":   "php",
+	".swift": "swift",
+	".sh":    "bash",
+	".bash":  "bash",
+	".zsh":   "zsh",
+	".sql":   "sql",
+	".html":  "html",
+	".css":   "css",
+	".json":  "json",
+	".yaml":  "yaml",
+	".yml":   "yaml",
+	".toml":  "toml",
+	".xml":   "xml",
+	".md":    "markdown",
+	".proto": "protobuf",
+}
+
+// Message returns text with the files before it, each as a fenced code
+// block labelled with its path
+func Message(files []File, text string) string {
+	if len(files) == 0 {
+		return text
+	}
+
+	var b strings.Builder
+	for _, f := range files {
+		fmt.Fprintf(&b, "File: %s\n%s\n\n", f.Path, CodeBlock(f.Content, Language(f.Path)))
+	}
+	b.WriteString(text)
+	return b.String()
+}
+
+// CodeBlock returns content as a fenced code block with the info string
+// info, fenced so that backticks in content cannot close it
+func CodeBlock(content, info string) string {
+	fence := fenceFor(content)
+	if !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return fence + info + "\n" + content + fence
+}
+
+// Placeholder returns text with a line naming each file in place of its
+// contents, for storing a message without the attached files
+func Placeholder(files []File, text string) string {
+	if len(files) == 0 {
+		return text
+	}
+
+	var b strings.Builder
+	for _, f := range files {
+		fmt.Fprintf(&b, "[Attached %s (%s), contents not stored]\n", f.Path, FormatSize(f.Size))
+	}
+	b.WriteString("\n" + text)
+	return b.String()
+}
+
+// fenceFor returns a backtick fence longer than any backtick run in content
+func fenceFor(content string) string {
+	longest, run := 0, 0
+	for _, r := range content {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+// Language returns the code block info string for a path
+func Language(path string) string {
+	return languages[strings.ToLower(filepath.Ext(path))]
+}
+
+// Paths returns the absolute paths of files
+func Paths(files []File) []string {
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.AbsPath
+	}
+	return paths
+}
+
+// Merge returns files followed by added, with a file attached again
+// replacing its earlier copy
+func Merge(files, added []File) []File {
+	replaced := make(map[string]bool, len(added))
+	for _, f := range added {
+		replaced[f.AbsPath] = true
+	}
+
+	var merged []File
+	for _, f := range files {
+		if !replaced[f.AbsPath] {
+			merged = append(merged, f)
+		}
+	}
+	return append(merged, added...)
+}
@@ -0,0 +1,348 @@
+// Package batch answers many independent queries read from a file, with a
+// bounded number of concurrent requests and a client-side rate limit. Results
+// are written as JSON lines in input order, and a run can be resumed from
+// the results of an interrupted one.
+package batch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"perplexity-cli/pkg/perplexity"
+)
+
+// maxLineSize is the longest input or result line read
+const maxLineSize = 4 * 1024 * 1024
+
+// Item is a query read from the input
+type Item struct {
+	// Index is the position of the item among the queries, from 0
+	Index int
+	// ID is the id given in JSONL input, or the line number
+	ID    string
+	Query string
+}
+
+// Result is the outcome of one item, written as a line of the output
+type Result struct {
+	Index int    `json:"index"`
+	ID    string `json:"id"`
+	Query string `json:"query"`
+	// Answer is the response content; its citation markers such as [1]
+	// refer to Citations by position
+	Answer    string                    `json:"answer,omitempty"`
+	Citations []perplexity.SearchResult `json:"citations,omitempty"`
+	Usage     *perplexity.Usage         `json:"usage,omitempty"`
+	Error     string                    `json:"error,omitempty"`
+}
+
+// Failed reports whether the item was not answered
+func (r Result) Failed() bool {
+	return r.Error != ""
+}
+
+// jsonItem is a line of JSONL input
+type jsonItem struct {
+	ID    json.RawMessage `json:"id"`
+	Query string          `json:"query"`
+}
+
+// ReadItems reads the queries in path. Files ending in .jsonl or .ndjson
+// hold a JSON object per line with a "query" and an optional "id", or a
+// JSON string; other files hold a query per line. Blank lines and, in text
+// files, lines starting with # are skipped.
+func ReadItems(path string) ([]Item, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open queries: %w", err)
+	}
+	defer file.Close()
+
+	ext := strings.ToLower(filepath.Ext(path))
+	items, err := parseItems(file, ext == ".jsonl" || ext == ".ndjson")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("%s: no queries found", path)
+	}
+	return items, nil
+}
+
+// parseItems reads queries from r, as JSON lines when jsonLines is set
+func parseItems(r io.Reader, jsonLines bool) ([]Item, error) {
+	var items []Item
+	// seen maps ids to the line they were first used on
+	seen := make(map[string]int)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || (!jsonLines && strings.HasPrefix(text, "#")) {
+			continue
+		}
+
+		item := Item{Index: len(items), ID: strconv.Itoa(line), Query: text}
+		if jsonLines {
+			var err error
+			if item.ID, item.Query, err = parseJSONItem(text); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			if item.ID == "" {
+				item.ID = strconv.Itoa(line)
+			}
+		}
+
+		if first, ok := seen[item.ID]; ok {
+			return nil, fmt.Errorf("line %d: id %q is already used on line %d", line, item.ID, first)
+		}
+		seen[item.ID] = line
+		items = append(items, item)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// parseJSONItem parses a JSONL line into an id, which may be empty, and a
+// query
+func parseJSONItem(text string) (string, string, error) {
+	if strings.HasPrefix(text, `"`) {
+		var query string
+		if err := json.Unmarshal([]byte(text), &query); err != nil {
+			return "", "", fmt.Errorf("invalid JSON: %w", err)
+		}
+		return "", strings.TrimSpace(query), nil
+	}
+
+	var item jsonItem
+	if err := json.Unmarshal([]byte(text), &item); err != nil {
+		return "", "", fmt.Errorf("invalid JSON: %w", err)
+	}
+	if strings.TrimSpace(item.Query) == "" {
+		return "", "", fmt.Errorf(`missing "query"`)
+	}
+
+	// Accept numeric ids as well as strings
+	id := strings.Trim(string(item.ID), `"`)
+	if id == "null" {
+		id = ""
+	}
+	return id, strings.TrimSpace(item.Query), nil
+}
+
+// LoadResults reads the results written by an earlier run to path, keyed
+// by index; when an item has several, the last one wins. A missing file has
+// no results, and lines that cannot be parsed, such as one cut short by an
+// interruption, are ignored.
+func LoadResults(path string) (map[int]Result, error) {
+	results := make(map[int]Result)
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return results, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open results: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		var result Result
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			continue
+		}
+		results[result.Index] = result
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read results: %w", err)
+	}
+	return results, nil
+}
+
+// Pending returns the items without a successful result for the same query
+// in done
+func Pending(items []Item, done map[int]Result) []Item {
+	var pending []Item
+	for _, item := range items {
+		if result, ok := done[item.Index]; ok && !result.Failed() && result.Query == item.Query {
+			continue
+		}
+		pending = append(pending, item)
+	}
+	return pending
+}
+
+// WriteResults replaces path with results sorted by index, writing to a
+// temporary file first so an interruption cannot lose them
+func WriteResults(path string, results []Result) error {
+	sorted := append([]Result(nil), results...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Index < sorted[j].Index })
+
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to write results: %w", err)
+	}
+
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	for _, result := range sorted {
+		if err := enc.Encode(result); err != nil {
+			file.Close()
+			os.Remove(tmp)
+			return fmt.Errorf("failed to write results: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write results: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write results: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write results: %w", err)
+	}
+	return nil
+}
+
+// Options controls a run
+type Options struct {
+	// Workers is the number of requests in flight at once; at least one
+	Workers int
+	// Rate caps the requests started per minute; 0 means no limit
+	Rate int
+	// Progress is called after each result with the counts so far
+	Progress func(Progress)
+}
+
+// Progress counts the results of a run
+type Progress struct {
+	Total  int
+	Done   int
+	Failed int
+}
+
+// Run answers items with ask, using up to opts.Workers goroutines, and
+// writes each result to w as a JSON line in the order of items. When ctx is
+// cancelled no further items are started; those in flight are finished and
+// written. It returns the results written.
+func Run(ctx context.Context, items []Item, ask func(Item) Result, w io.Writer, opts Options) ([]Result, error) {
+	workers := max(opts.Workers, 1)
+	jobs := make(chan Item)
+	answers := make(chan Result)
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range jobs {
+				answers <- ask(item)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		dispatch(ctx, items, jobs, opts.Rate)
+	}()
+	go func() {
+		wg.Wait()
+		close(answers)
+	}()
+
+	// Results arrive in any order; hold them until those before have been
+	// written
+	enc := json.NewEncoder(w)
+	var written []Result
+	var writeErr error
+	held := make(map[int]Result)
+	next := 0
+	progress := Progress{Total: len(items)}
+
+	write := func(result Result) {
+		if writeErr == nil {
+			writeErr = enc.Encode(result)
+		}
+		written = append(written, result)
+	}
+
+	for result := range answers {
+		held[result.Index] = result
+		progress.Done++
+		if result.Failed() {
+			progress.Failed++
+		}
+
+		for next < len(items) {
+			result, ok := held[items[next].Index]
+			if !ok {
+				break
+			}
+			delete(held, items[next].Index)
+			write(result)
+			next++
+		}
+
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
+	}
+
+	// After an interruption, results may be held behind items never started
+	for ; next < len(items); next++ {
+		if result, ok := held[items[next].Index]; ok {
+			write(result)
+		}
+	}
+
+	if writeErr != nil {
+		return written, fmt.Errorf("failed to write results: %w", writeErr)
+	}
+	return written, nil
+}
+
+// dispatch sends items to jobs, no more than rate per minute, until ctx is
+// cancelled
+func dispatch(ctx context.Context, items []Item, jobs chan<- Item, rate int) {
+	var limiter <-chan time.Time
+	if rate > 0 {
+		ticker := time.NewTicker(time.Minute / time.Duration(rate))
+		defer ticker.Stop()
+		limiter = ticker.C
+	}
+
+	for i, item := range items {
+		if limiter != nil && i > 0 {
+			select {
+			case <-limiter:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case jobs <- item:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadItems(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name     string
+		file     string
+		content  string
+		expected []Item
+		err      string
+	}{
+		{
+			name:    "text",
+			file:    "queries.txt",
+			content: "# packages\nWhat is cobra?\n\n  What is viper?  \n",
+			expected: []Item{
+				{Index: 0, ID: "2", Query: "What is cobra?"},
+				{Index: 1, ID: "4", Query: "What is viper?"},
+			},
+		},
+		{
+			name:    "jsonl",
+			file:    "queries.jsonl",
+			content: `{"id": "cobra", "query": "What is cobra?"}` + "\n" + `{"id": 7, "query": "What is viper?"}` + "\n" + `"What is glamour?"` + "\n",
+			expected: []Item{
+				{Index: 0, ID: "cobra", Query: "What is cobra?"},
+				{Index: 1, ID: "7", Query: "What is viper?"},
+				{Index: 2, ID: "3", Query: "What is glamour?"},
+			},
+		},
+		{
+			name:    "missing query",
+			file:    "bad.jsonl",
+			content: `{"id": "a"}`,
+			err:     `line 1: missing "query"`,
+		},
+		{
+			name:    "invalid json",
+			file:    "bad2.jsonl",
+			content: `{"query": `,
+			err:     "line 1: invalid JSON",
+		},
+		{
+			name:    "duplicate id",
+			file:    "dup.jsonl",
+			content: `{"id": "a", "query": "one"}` + "\n\n" + `{"id": "a", "query": "two"}`,
+			err:     `line 3: id "a" is already used on line 1`,
+		},
+		{
+			name:    "empty",
+			file:    "empty.txt",
+			content: "# nothing\n\n",
+			err:     "no queries found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("WriteFile() failed: %v", err)
+			}
+
+			items, err := ReadItems(path)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("ReadItems() error = %v, expected %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadItems() failed: %v", err)
+			}
+			if len(items) != len(tt.expected) {
+				t.Fatalf("ReadItems() = %+v, expected %+v", items, tt.expected)
+			}
+			for i := range items {
+				if items[i] != tt.expected[i] {
+					t.Errorf("item %d = %+v, expected %+v", i, items[i], tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRunWritesInOrder(t *testing.T) {
+	var items []Item
+	for i := range 20 {
+		items = append(items, Item{Index: i, ID: string(rune('a' + i)), Query: strings.Repeat("q", i+1)})
+	}
+
+	var inFlight, most atomic.Int32
+	ask := func(item Item) Result {
+		n := inFlight.Add(1)
+		for {
+			m := most.Load()
+			if n <= m || most.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		// Later items finish first, so results arrive out of order
+		time.Sleep(time.Duration(20-item.Index) * time.Millisecond)
+		inFlight.Add(-1)
+
+		result := Result{Index: item.Index, ID: item.ID, Query: item.Query, Answer: "answer " + item.ID}
+		if item.Index%5 == 0 {
+			result = Result{Index: item.Index, ID: item.ID, Query: item.Query, Error: "rate limited"}
+		}
+		return result
+	}
+
+	var progress []Progress
+	var out bytes.Buffer
+	results, err := Run(context.Background(), items, ask, &out, Options{
+		Workers:  4,
+		Progress: func(p Progress) { progress = append(progress, p) },
+	})
+	if err != nil {
+		t.Fatalf("Run() failed: %v", err)
+	}
+
+	if m := most.Load(); m > 4 || m < 2 {
+		t.Errorf("at most %d requests ran at once, expected 2 to 4", m)
+	}
+	if len(results) != len(items) {
+		t.Fatalf("Run() returned %d results, expected %d", len(results), len(items))
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != len(items) {
+		t.Fatalf("wrote %d lines, expected %d", len(lines), len(items))
+	}
+	for i, line := range lines {
+		var result Result
+		if err := json.Unmarshal([]byte(line), &result); err != nil {
+			t.Fatalf("line %d is not JSON: %v", i, err)
+		}
+		if result.Index != i {
+			t.Errorf("line %d has index %d, expected input order", i, result.Index)
+		}
+	}
+
+	last := progress[len(progress)-1]
+	if last != (Progress{Total: 20, Done: 20, Failed: 4}) {
+		t.Errorf("last progress = %+v, expected 20 done and 4 failed", last)
+	}
+}
+
+func TestRunRateLimit(t *testing.T) {
+	items := []Item{{Index: 0}, {Index: 1}, {Index: 2}}
+	ask := func(item Item) Result { return Result{Index: item.Index} }
+
+	// 1200 per minute starts one request every 50ms; the first starts at once
+	started := time.Now()
+	if _, err := Run(context.Background(), items, ask, &bytes.Buffer{}, Options{Workers: 3, Rate: 1200}); err != nil {
+		t.Fatalf("Run() failed: %v", err)
+	}
+	if elapsed := time.Since(started); elapsed < 90*time.Millisecond {
+		t.Errorf("Run() took %s, expected the rate limit to space requests 50ms apart", elapsed)
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	var items []Item
+	for i := range 10 {
+		items = append(items, Item{Index: i})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ask := func(item Item) Result {
+		if item.Index == 2 {
+			cancel()
+		}
+		return Result{Index: item.Index}
+	}
+
+	var out bytes.Buffer
+	results, err := Run(ctx, items, ask, &out, Options{Workers: 1})
+	if err != nil {
+		t.Fatalf("Run() failed: %v", err)
+	}
+	if len(results) < 3 || len(results) > 4 {
+		t.Errorf("Run() answered %d items after cancelling on the third, expected the started ones only", len(results))
+	}
+	if lines := strings.Count(out.String(), "\n"); lines != len(results) {
+		t.Errorf("wrote %d lines for %d results", lines, len(results))
+	}
+}
+
+func TestResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.jsonl")
+	items := []Item{
+		{Index: 0, ID: "1", Query: "one"},
+		{Index: 1, ID: "2", Query: "two"},
+		{Index: 2, ID: "3", Query: "three"},
+		{Index: 3, ID: "4", Query: "four"},
+	}
+
+	// An earlier run answered item 2, failed item 0, answered an older
+	// version of item 1 and was cut off while writing
+	earlier := `{"index":2,"id":"3","query":"three","answer":"3"}
+{"index":0,"id":"1","query":"one","error":"timeout"}
+{"index":1,"id":"2","query":"old two","answer":"old"}
+{"index":3,"id":"4","qu`
+	if err := os.WriteFile(path, []byte(earlier), 0644); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+
+	done, err := LoadResults(path)
+	if err != nil {
+		t.Fatalf("LoadResults() failed: %v", err)
+	}
+	if len(done) != 3 {
+		t.Errorf("LoadResults() = %d results, expected 3 ignoring the cut-off line", len(done))
+	}
+
+	var pending []string
+	for _, item := range Pending(items, done) {
+		pending = append(pending, item.Query)
+	}
+	if strings.Join(pending, ",") != "one,two,four" {
+		t.Errorf("Pending() = %q, expected the failed, changed and missing items", pending)
+	}
+
+	// Rewriting sorts the results by index
+	results := []Result{done[2], {Index: 0, ID: "1", Query: "one", Answer: "1"}}
+	if err := WriteResults(path, results); err != nil {
+		t.Fatalf("WriteResults() failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() failed: %v", err)
+	}
+	expected := `{"index":0,"id":"1","query":"one","answer":"1"}` + "\n" + `{"index":2,"id":"3","query":"three","answer":"3"}` + "\n"
+	if string(data) != expected {
+		t.Errorf("WriteResults() wrote %q, expected %q", data, expected)
+	}
+
+	if missing, err := LoadResults(filepath.Join(t.TempDir(), "missing.jsonl")); err != nil || len(missing) != 0 {
+		t.Errorf("LoadResults(missing) = %v, %v; expected no results", missing, err)
+	}
+}
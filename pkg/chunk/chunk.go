@@ -0,0 +1,153 @@
+// Package chunk splits input too large for one request into token-bounded
+// chunks, breaking between paragraphs and fenced code blocks where it can.
+package chunk
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"perplexity-cli/pkg/conversation"
+)
+
+// Split splits text into chunks of at most maxTokens estimated tokens. It
+// breaks between paragraphs and keeps fenced code blocks whole; a block too
+// large on its own is broken between lines, and a line too large on its own
+// is broken wherever the limit falls. A maxTokens of zero or less returns
+// text as a single chunk.
+func Split(text string, maxTokens int) []string {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	if maxTokens <= 0 || conversation.EstimateTokens(text) <= maxTokens {
+		return []string{text}
+	}
+
+	var pieces []string
+	for _, block := range blocks(text) {
+		if conversation.EstimateTokens(block) <= maxTokens {
+			pieces = append(pieces, block)
+			continue
+		}
+		pieces = append(pieces, splitLines(block, maxTokens)...)
+	}
+	return Pack(pieces, maxTokens)
+}
+
+// Pack joins consecutive blocks with blank lines into as few chunks of at
+// most maxTokens estimated tokens as their order allows. A block over the
+// limit becomes a chunk of its own.
+func Pack(blocks []string, maxTokens int) []string {
+	var chunks []string
+	var current strings.Builder
+	for _, block := range blocks {
+		if current.Len() > 0 && conversation.EstimateTokens(current.String()+"\n\n"+block) > maxTokens {
+			chunks = append(chunks, current.String())
+			current.Reset()
+		}
+		if current.Len() > 0 {
+			current.WriteString("\n\n")
+		}
+		current.WriteString(block)
+	}
+	if current.Len() > 0 {
+		chunks = append(chunks, current.String())
+	}
+	return chunks
+}
+
+// blocks returns the paragraphs and fenced code blocks of text, without
+// the blank lines between them. Blank lines inside a code block do not end
+// it.
+func blocks(text string) []string {
+	var result, lines []string
+	fence := ""
+
+	flush := func() {
+		if len(lines) > 0 {
+			result = append(result, strings.Join(lines, "\n"))
+			lines = nil
+		}
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence != "":
+			lines = append(lines, line)
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+				flush()
+			}
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			// A code block starts a new block, even without a blank line
+			// before it
+			flush()
+			fence = openingFence(trimmed)
+			lines = append(lines, line)
+		case trimmed == "":
+			flush()
+		default:
+			lines = append(lines, line)
+		}
+	}
+	flush()
+	return result
+}
+
+// openingFence returns the run of backticks or tildes that opens a code
+// block, which the closing fence must be at least as long as
+func openingFence(line string) string {
+	n := 0
+	for n < len(line) && line[n] == line[0] {
+		n++
+	}
+	return line[:n]
+}
+
+// splitLines breaks block between lines into pieces of at most maxTokens,
+// breaking inside lines that are too large on their own
+func splitLines(block string, maxTokens int) []string {
+	var lines []string
+	for _, line := range strings.Split(block, "\n") {
+		if conversation.EstimateTokens(line) <= maxTokens {
+			lines = append(lines, line)
+			continue
+		}
+		lines = append(lines, splitBytes(line, maxTokens*4)...)
+	}
+
+	var pieces []string
+	var current strings.Builder
+	for _, line := range lines {
+		if current.Len() > 0 && conversation.EstimateTokens(current.String()+"\n"+line) > maxTokens {
+			pieces = append(pieces, current.String())
+			current.Reset()
+		}
+		if current.Len() > 0 {
+			current.WriteString("\n")
+		}
+		current.WriteString(line)
+	}
+	if current.Len() > 0 {
+		pieces = append(pieces, current.String())
+	}
+	return pieces
+}
+
+// splitBytes breaks s into pieces of at most size bytes without splitting
+// a UTF-8 sequence
+func splitBytes(s string, size int) []string {
+	var pieces []string
+	for len(s) > size {
+		end := size
+		for end > 0 && !utf8.RuneStart(s[end]) {
+			end--
+		}
+		if end == 0 {
+			end = size
+		}
+		pieces = append(pieces, s[:end])
+		s = s[end:]
+	}
+	return append(pieces, s)
+}
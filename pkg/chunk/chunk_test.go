@@ -0,0 +1,102 @@
+package chunk
+
+import (
+	"strings"
+	"testing"
+
+	"perplexity-cli/pkg/conversation"
+)
+
+func TestSplit(t *testing.T) {
+	paragraph := func(word string) string {
+		return strings.TrimSpace(strings.Repeat(word+" ", 20))
+	}
+	code := "```go\nfunc main() {\n\n\tprintln(\"hi\")\n}\n```"
+
+	tests := []struct {
+		name      string
+		text      string
+		maxTokens int
+		expected  []string
+	}{
+		{
+			name:      "fits in one chunk",
+			text:      "short\n\ntext",
+			maxTokens: 100,
+			expected:  []string{"short\n\ntext"},
+		},
+		{
+			name:      "no limit",
+			text:      paragraph("aaaa"),
+			maxTokens: 0,
+			expected:  []string{paragraph("aaaa")},
+		},
+		{
+			name:      "empty",
+			text:      "\n \n",
+			maxTokens: 10,
+			expected:  nil,
+		},
+		{
+			name:      "between paragraphs",
+			text:      paragraph("aaaa") + "\n\n" + paragraph("bbbb") + "\n\n\n" + paragraph("cccc"),
+			maxTokens: 40,
+			expected:  []string{paragraph("aaaa"), paragraph("bbbb"), paragraph("cccc")},
+		},
+		{
+			name:      "code block kept whole",
+			text:      paragraph("aaaa") + "\n" + code + "\n" + paragraph("bbbb"),
+			maxTokens: 30,
+			expected:  []string{paragraph("aaaa"), code, paragraph("bbbb")},
+		},
+		{
+			name:      "large paragraph broken between lines",
+			text:      "one one one\ntwo two two\nthree three",
+			maxTokens: 7,
+			expected:  []string{"one one one\ntwo two two", "three three"},
+		},
+		{
+			name:      "long line broken at the limit",
+			text:      strings.Repeat("x", 30),
+			maxTokens: 3,
+			expected:  []string{strings.Repeat("x", 12), strings.Repeat("x", 12), strings.Repeat("x", 6)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Split(tt.text, tt.maxTokens)
+			if strings.Join(got, "|") != strings.Join(tt.expected, "|") || len(got) != len(tt.expected) {
+				t.Errorf("Split() = %q, expected %q", got, tt.expected)
+			}
+			for _, c := range got {
+				if tt.maxTokens > 0 && conversation.EstimateTokens(c) > tt.maxTokens {
+					t.Errorf("chunk %q is over %d tokens", c, tt.maxTokens)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitKeepsRunes(t *testing.T) {
+	text := strings.Repeat("é", 50)
+	chunks := Split(text, 5)
+	if strings.Join(chunks, "") != text {
+		t.Errorf("Split() lost text: %q", chunks)
+	}
+	for _, c := range chunks {
+		if !strings.HasPrefix(c, "é") {
+			t.Errorf("chunk %q starts inside a character", c)
+		}
+	}
+}
+
+func TestPack(t *testing.T) {
+	blocks := []string{"aaaa", "bbbb", "cccc", strings.Repeat("d", 40), "eeee"}
+	expected := []string{"aaaa\n\nbbbb", "cccc", strings.Repeat("d", 40), "eeee"}
+
+	got := Pack(blocks, 3)
+	if strings.Join(got, "|") != strings.Join(expected, "|") {
+		t.Errorf("Pack() = %q, expected %q", got, expected)
+	}
+}
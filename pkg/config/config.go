@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/spf13/viper"
 )
@@ -17,10 +18,27 @@ type Config struct {
 	TopP              float64 `mapstructure:"top_p"`
 	SearchContextSize string  `mapstructure:"search_context_size"`
 	SearchMode        string  `mapstructure:"search_mode"`
-	ReasoningEffort   string  `mapstructure:"reasoning_effort"`
-	UseGlow           bool    `mapstructure:"use_glow"`
-	GlowStyle         string  `mapstructure:"glow_style"`
-	GlowWidth         int     `mapstructure:"glow_width"`
+	// SearchDomainFilter limits web search to these domains; a domain
+	// starting with - is excluded instead
+	SearchDomainFilter  []string `mapstructure:"search_domain_filter"`
+	SearchRecencyFilter string   `mapstructure:"search_recency_filter"`
+	ReasoningEffort     string   `mapstructure:"reasoning_effort"`
+	ShowReasoning       bool     `mapstructure:"show_reasoning"`
+	UseGlow             bool     `mapstructure:"use_glow"`
+	GlowStyle           string   `mapstructure:"glow_style"`
+	GlowWidth           int      `mapstructure:"glow_width"`
+	AutoTitle           bool     `mapstructure:"auto_title"`
+	TitleModel          string   `mapstructure:"title_model"`
+	SessionStore        string   `mapstructure:"session_store"`
+	EncryptSessions     bool     `mapstructure:"encrypt_sessions"`
+	SystemPrompt        string   `mapstructure:"system_prompt"`
+	ContextTokens       int      `mapstructure:"context_tokens"`
+	ContextMessages     int      `mapstructure:"context_messages"`
+	ContextStrategy     string   `mapstructure:"context_strategy"`
+	AttachMaxFileSize   int      `mapstructure:"attach_max_file_size"`
+	AttachMaxTokens     int      `mapstructure:"attach_max_tokens"`
+	StoreAttachments    bool     `mapstructure:"store_attachments"`
+	StdinMaxSize        int      `mapstructure:"stdin_max_size"`
 }
 
 // DefaultConfig returns the default configuration
@@ -33,9 +51,22 @@ func DefaultConfig() *Config {
 		SearchContextSize: "low",
 		SearchMode:        "web",
 		ReasoningEffort:   "medium",
+		ShowReasoning:     false,
 		UseGlow:           true,
 		GlowStyle:         "auto",
 		GlowWidth:         0, // 0 means use terminal width
+		AutoTitle:         false,
+		TitleModel:        "sonar",
+		SessionStore:      "json",
+		EncryptSessions:   false,
+		SystemPrompt:      "",
+		ContextTokens:     0,  // 0 means use the model's context window
+		ContextMessages:   20, // 0 means no limit
+		ContextStrategy:   "truncate",
+		AttachMaxFileSize: 256 * 1024,
+		AttachMaxTokens:   32000,
+		StoreAttachments:  true,
+		StdinMaxSize:      1024 * 1024,
 	}
 }
 
@@ -57,7 +88,7 @@ func Load() (*Config, error) {
 	configFile := filepath.Join(configDir, "config.yaml")
 
 	// Ensure config directory exists
-	if err := os.MkdirAll(configDir, 0755); err != nil {
+	if err := os.MkdirAll(configDir, 0700); err != nil {
 		fmt.Fprintf(os.Stderr, "Warning: failed to create config directory: %v\n", err)
 	}
 
@@ -72,10 +103,25 @@ func Load() (*Config, error) {
 	viper.SetDefault("top_p", cfg.TopP)
 	viper.SetDefault("search_context_size", cfg.SearchContextSize)
 	viper.SetDefault("search_mode", cfg.SearchMode)
+	viper.SetDefault("search_domain_filter", cfg.SearchDomainFilter)
+	viper.SetDefault("search_recency_filter", cfg.SearchRecencyFilter)
 	viper.SetDefault("reasoning_effort", cfg.ReasoningEffort)
+	viper.SetDefault("show_reasoning", cfg.ShowReasoning)
 	viper.SetDefault("use_glow", cfg.UseGlow)
 	viper.SetDefault("glow_style", cfg.GlowStyle)
 	viper.SetDefault("glow_width", cfg.GlowWidth)
+	viper.SetDefault("auto_title", cfg.AutoTitle)
+	viper.SetDefault("title_model", cfg.TitleModel)
+	viper.SetDefault("session_store", cfg.SessionStore)
+	viper.SetDefault("encrypt_sessions", cfg.EncryptSessions)
+	viper.SetDefault("system_prompt", cfg.SystemPrompt)
+	viper.SetDefault("context_tokens", cfg.ContextTokens)
+	viper.SetDefault("context_messages", cfg.ContextMessages)
+	viper.SetDefault("context_strategy", cfg.ContextStrategy)
+	viper.SetDefault("attach_max_file_size", cfg.AttachMaxFileSize)
+	viper.SetDefault("attach_max_tokens", cfg.AttachMaxTokens)
+	viper.SetDefault("store_attachments", cfg.StoreAttachments)
+	viper.SetDefault("stdin_max_size", cfg.StdinMaxSize)
 
 	// Read config file if it exists
 	if _, err := os.Stat(configFile); err == nil {
@@ -126,6 +172,12 @@ func LoadWithFile(configFile string) (*Config, error) {
 	return cfg, nil
 }
 
+// validRecencyFilters are the values of search_recency_filter
+var validRecencyFilters = []string{"hour", "day", "week", "month", "year"}
+
+// validContextSizes are the values of search_context_size
+var validContextSizes = []string{"low", "medium", "high"}
+
 // Validate checks if the configuration is valid
 func (c *Config) Validate() error {
 	if c.APIKey == "" {
@@ -149,6 +201,36 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("top_p must be between 0 and 1")
 	}
 
+	// Validate search filters
+	if c.SearchRecencyFilter != "" && !contains(validRecencyFilters, c.SearchRecencyFilter) {
+		return fmt.Errorf("search_recency_filter must be one of %s", strings.Join(validRecencyFilters, ", "))
+	}
+	if c.SearchContextSize != "" && !contains(validContextSizes, c.SearchContextSize) {
+		return fmt.Errorf("search_context_size must be one of %s", strings.Join(validContextSizes, ", "))
+	}
+
+	// Validate context limits
+	if c.ContextTokens < 0 {
+		return fmt.Errorf("context_tokens must not be negative")
+	}
+	if c.ContextMessages < 0 {
+		return fmt.Errorf("context_messages must not be negative")
+	}
+	if c.ContextStrategy != "" && c.ContextStrategy != "truncate" && c.ContextStrategy != "summarize" {
+		return fmt.Errorf("context_strategy must be truncate or summarize")
+	}
+
+	// Validate attachment limits
+	if c.AttachMaxFileSize < 0 {
+		return fmt.Errorf("attach_max_file_size must not be negative")
+	}
+	if c.AttachMaxTokens < 0 {
+		return fmt.Errorf("attach_max_tokens must not be negative")
+	}
+	if c.StdinMaxSize < 0 {
+		return fmt.Errorf("stdin_max_size must not be negative")
+	}
+
 	return nil
 }
 
@@ -160,7 +242,7 @@ func (c *Config) Save() error {
 	}
 
 	configDir := filepath.Join(home, ".pplx")
-	if err := os.MkdirAll(configDir, 0755); err != nil {
+	if err := os.MkdirAll(configDir, 0700); err != nil {
 		return fmt.Errorf("failed to create config directory: %w", err)
 	}
 
@@ -172,10 +254,25 @@ func (c *Config) Save() error {
 	viper.Set("top_p", c.TopP)
 	viper.Set("search_context_size", c.SearchContextSize)
 	viper.Set("search_mode", c.SearchMode)
+	viper.Set("search_domain_filter", c.SearchDomainFilter)
+	viper.Set("search_recency_filter", c.SearchRecencyFilter)
 	viper.Set("reasoning_effort", c.ReasoningEffort)
+	viper.Set("show_reasoning", c.ShowReasoning)
 	viper.Set("use_glow", c.UseGlow)
 	viper.Set("glow_style", c.GlowStyle)
 	viper.Set("glow_width", c.GlowWidth)
+	viper.Set("auto_title", c.AutoTitle)
+	viper.Set("title_model", c.TitleModel)
+	viper.Set("session_store", c.SessionStore)
+	viper.Set("encrypt_sessions", c.EncryptSessions)
+	viper.Set("system_prompt", c.SystemPrompt)
+	viper.Set("context_tokens", c.ContextTokens)
+	viper.Set("context_messages", c.ContextMessages)
+	viper.Set("context_strategy", c.ContextStrategy)
+	viper.Set("attach_max_file_size", c.AttachMaxFileSize)
+	viper.Set("attach_max_tokens", c.AttachMaxTokens)
+	viper.Set("store_attachments", c.StoreAttachments)
+	viper.Set("stdin_max_size", c.StdinMaxSize)
 
 	configFile := filepath.Join(configDir, "config.yaml")
 	if err := viper.WriteConfigAs(configFile); err != nil {
@@ -0,0 +1,45 @@
+package conversation
+
+import (
+	"fmt"
+
+	"perplexity-cli/pkg/session"
+)
+
+// Strategies for history that does not fit the context budget, selected by
+// the context_strategy setting
+const (
+	StrategyTruncate  = "truncate"
+	StrategySummarize = "summarize"
+)
+
+// maxCompactionRounds bounds how often the summary is extended for one
+// request; each round may make the summary longer and push out more history
+const maxCompactionRounds = 3
+
+// Summarizer extends previous, a summary of earlier messages, so it also
+// covers messages
+type Summarizer func(previous string, messages []session.SessionMessage) (string, error)
+
+// BuildCompacted builds the context like Build, but folds history that does
+// not fit into opts.Summary with summarize instead of dropping it. It returns
+// the summary the context was built with, which differs from opts.Summary
+// when it was extended. If summarizing fails, the error is returned along
+// with a truncated context built from the last good summary.
+func BuildCompacted(history []session.SessionMessage, input string, opts Options, summarize Summarizer) (*Context, Summary, error) {
+	for round := 0; ; round++ {
+		ctx := Build(history, input, opts)
+		if !ctx.Truncated() || round == maxCompactionRounds {
+			return ctx, opts.Summary, nil
+		}
+
+		from := ctx.Summarized
+		to := from + ctx.Dropped
+		text, err := summarize(opts.Summary.Text, history[from:to])
+		if err != nil {
+			return ctx, opts.Summary, fmt.Errorf("failed to summarize earlier messages: %w", err)
+		}
+
+		opts.Summary = Summary{Text: text, Messages: to}
+	}
+}
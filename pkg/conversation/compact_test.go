@@ -0,0 +1,67 @@
+package conversation
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"perplexity-cli/pkg/session"
+)
+
+func TestBuildCompacted(t *testing.T) {
+	history := exchanges(5, 400)
+	opts := Options{Model: "sonar", MaxTokens: 450}
+
+	var calls [][]session.SessionMessage
+	summarize := func(previous string, messages []session.SessionMessage) (string, error) {
+		calls = append(calls, messages)
+		return fmt.Sprintf("%s+%d", previous, len(messages)), nil
+	}
+
+	// The first six messages do not fit and are summarized
+	ctx, summary, err := BuildCompacted(history, "latest question", opts, summarize)
+	if err != nil {
+		t.Fatalf("BuildCompacted() failed: %v", err)
+	}
+	if summary.Messages != 6 || summary.Text != "+6" {
+		t.Errorf("summary = %+v, expected +6 covering 6 messages", summary)
+	}
+	if ctx.Truncated() || ctx.Summarized != 6 {
+		t.Errorf("context summarized %d and dropped %d, expected 6 and 0", ctx.Summarized, ctx.Dropped)
+	}
+
+	// Another exchange pushes one more out, extending the summary
+	history = append(history, exchanges(1, 400)...)
+	opts.Summary = summary
+	_, summary, err = BuildCompacted(history, "latest question", opts, summarize)
+	if err != nil {
+		t.Fatalf("BuildCompacted() failed: %v", err)
+	}
+	if summary.Messages != 8 || summary.Text != "+6+2" {
+		t.Errorf("summary = %+v, expected +6+2 covering 8 messages", summary)
+	}
+	if len(calls) != 2 || len(calls[1]) != 2 {
+		t.Errorf("summarizer called with %d batches, expected only the 2 new messages second", len(calls))
+	}
+
+	// Nothing to do when everything fits
+	calls = nil
+	_, unchanged, _ := BuildCompacted(history[:2], "latest question", Options{Model: "sonar"}, summarize)
+	if unchanged != (Summary{}) || len(calls) != 0 {
+		t.Errorf("BuildCompacted() summarized history that fits")
+	}
+}
+
+func TestBuildCompactedFallsBackToTruncation(t *testing.T) {
+	failing := func(string, []session.SessionMessage) (string, error) {
+		return "", errors.New("rate limited")
+	}
+
+	ctx, summary, err := BuildCompacted(exchanges(5, 400), "latest question", Options{Model: "sonar", MaxTokens: 450}, failing)
+	if err == nil {
+		t.Fatal("BuildCompacted() should report the summarizer error")
+	}
+	if summary != (Summary{}) || !ctx.Truncated() {
+		t.Errorf("expected an unchanged summary and a truncated context")
+	}
+}
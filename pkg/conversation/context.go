@@ -0,0 +1,210 @@
+// Package conversation builds the message list sent to the API from a
+// session's history, within a per-model token budget.
+package conversation
+
+import (
+	"perplexity-cli/pkg/config"
+	"perplexity-cli/pkg/perplexity"
+	"perplexity-cli/pkg/session"
+)
+
+// DefaultContextTokens is the context window assumed for unknown models
+const DefaultContextTokens = 127000
+
+// DefaultResponseTokens is the room kept for the response when max_tokens
+// is not configured
+const DefaultResponseTokens = 4096
+
+// messageOverheadTokens approximates the per-message formatting overhead
+const messageOverheadTokens = 4
+
+// ModelContextTokens lists the context window of known models in tokens
+var ModelContextTokens = map[string]int{
+	"sonar":               127000,
+	"sonar-pro":           200000,
+	"sonar-reasoning":     127000,
+	"sonar-reasoning-pro": 127000,
+	"sonar-deep-research": 127000,
+}
+
+// Options controls how much history is sent with a request
+type Options struct {
+	// Model selects the context window the budget is derived from
+	Model string
+	// SystemPrompt is always sent first when set
+	SystemPrompt string
+	// MaxTokens caps the estimated prompt size; 0 uses the model's window
+	MaxTokens int
+	// MaxMessages caps the number of history messages; 0 means no cap
+	MaxMessages int
+	// ResponseTokens is kept free for the response; 0 uses
+	// DefaultResponseTokens
+	ResponseTokens int
+	// Summary replaces the history messages it covers when set
+	Summary Summary
+}
+
+// Summary is a running summary of the first Messages messages of a history
+type Summary struct {
+	Text     string
+	Messages int
+}
+
+// OptionsFromConfig returns the context options configured for model
+func OptionsFromConfig(cfg *config.Config, model string) Options {
+	return Options{
+		Model:          model,
+		SystemPrompt:   cfg.SystemPrompt,
+		MaxTokens:      cfg.ContextTokens,
+		MaxMessages:    cfg.ContextMessages,
+		ResponseTokens: cfg.MaxTokens,
+	}
+}
+
+// SessionOptions returns the context options configured for continuing s,
+// including its stored context summary
+func SessionOptions(cfg *config.Config, s *session.Session) Options {
+	opts := OptionsFromConfig(cfg, s.Metadata.Model)
+	opts.Summary = Summary{
+		Text:     s.Metadata.ContextSummary,
+		Messages: s.Metadata.ContextSummaryMessages,
+	}
+	return opts
+}
+
+// Budget returns the number of prompt tokens available under opts
+func (o Options) Budget() int {
+	window, ok := ModelContextTokens[o.Model]
+	if !ok {
+		window = DefaultContextTokens
+	}
+
+	response := o.ResponseTokens
+	if response <= 0 {
+		response = DefaultResponseTokens
+	}
+
+	budget := window - response
+	if o.MaxTokens > 0 && o.MaxTokens < budget {
+		budget = o.MaxTokens
+	}
+	return budget
+}
+
+// Context is the message list for one request
+type Context struct {
+	Messages []perplexity.Message
+	// Tokens is the estimated size of Messages
+	Tokens int
+	// Budget is the token budget the history was fitted into
+	Budget int
+	// Sent and Dropped count the history messages included and left out;
+	// Summarized counts the messages represented by the summary instead
+	Sent       int
+	Dropped    int
+	Summarized int
+	// MessageLimited is set when history was cut by MaxMessages rather
+	// than by the token budget
+	MessageLimited bool
+}
+
+// Truncated reports whether any history was left out
+func (c *Context) Truncated() bool {
+	return c.Dropped > 0
+}
+
+// Build returns the messages for a request answering input after history.
+// The system prompt, summary and input are always included; history after
+// the summary is added newest first while it fits the budget and message
+// cap. The kept history always starts with a user message so roles keep
+// alternating. References are stripped from assistant messages.
+func Build(history []session.SessionMessage, input string, opts Options) *Context {
+	ctx := &Context{Budget: opts.Budget()}
+
+	// Messages covered by the summary are never sent themselves
+	first := 0
+	if opts.Summary.Text != "" {
+		first = min(opts.Summary.Messages, len(history))
+		ctx.Summarized = first
+	}
+
+	var system []perplexity.Message
+	if prompt := systemPrompt(opts.SystemPrompt, opts.Summary.Text); prompt != "" {
+		system = append(system, perplexity.Message{Role: "system", Content: prompt})
+	}
+	latest := perplexity.Message{Role: "user", Content: input}
+
+	used := MessageTokens(latest)
+	for _, msg := range system {
+		used += MessageTokens(msg)
+	}
+
+	// Walk back from the newest message while history fits
+	start := len(history)
+	for start > first {
+		if opts.MaxMessages > 0 && len(history)-start >= opts.MaxMessages {
+			ctx.MessageLimited = true
+			break
+		}
+
+		msg := toAPIMessage(history[start-1], opts.Model)
+		tokens := MessageTokens(msg)
+		if used+tokens > ctx.Budget {
+			break
+		}
+		used += tokens
+		start--
+	}
+
+	// Never start the history with an assistant reply
+	for start < len(history) && history[start].Role != "user" {
+		used -= MessageTokens(toAPIMessage(history[start], opts.Model))
+		start++
+	}
+
+	ctx.Messages = append(ctx.Messages, system...)
+	for _, msg := range history[start:] {
+		ctx.Messages = append(ctx.Messages, toAPIMessage(msg, opts.Model))
+	}
+	ctx.Messages = append(ctx.Messages, latest)
+
+	ctx.Tokens = used
+	ctx.Sent = len(history) - start
+	ctx.Dropped = start - first
+	return ctx
+}
+
+// systemPrompt combines the configured system prompt with the summary of
+// earlier messages into one system message
+func systemPrompt(prompt, summary string) string {
+	if summary == "" {
+		return prompt
+	}
+
+	summary = "Summary of the earlier conversation:\n" + summary
+	if prompt == "" {
+		return summary
+	}
+	return prompt + "\n\n" + summary
+}
+
+// toAPIMessage converts a session message, stripping references and the
+// reasoning of model from assistant replies
+func toAPIMessage(msg session.SessionMessage, model string) perplexity.Message {
+	content := msg.Content
+	if msg.Role == "assistant" {
+		content = perplexity.StripReferences(perplexity.StripReasoning(model, content))
+	}
+	return perplexity.Message{Role: msg.Role, Content: content}
+}
+
+// MessageTokens estimates the tokens a message takes in a request
+func MessageTokens(msg perplexity.Message) int {
+	return EstimateTokens(msg.Content) + messageOverheadTokens
+}
+
+// EstimateTokens estimates the token count of text at roughly four bytes
+// per token, which overestimates for non-English text rather than under
+func EstimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
@@ -0,0 +1,169 @@
+package conversation
+
+import (
+	"strings"
+	"testing"
+
+	"perplexity-cli/pkg/session"
+)
+
+// exchanges returns n user/assistant exchanges with size-byte contents
+func exchanges(n, size int) []session.SessionMessage {
+	var history []session.SessionMessage
+	for i := 0; i < n; i++ {
+		history = append(history,
+			session.SessionMessage{Role: "user", Content: strings.Repeat("q", size)},
+			session.SessionMessage{Role: "assistant", Content: strings.Repeat("a", size)},
+		)
+	}
+	return history
+}
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name           string
+		history        []session.SessionMessage
+		opts           Options
+		expectSent     int
+		expectDropped  int
+		expectMsgLimit bool
+	}{
+		{
+			name:       "No history",
+			opts:       Options{Model: "sonar"},
+			expectSent: 0,
+		},
+		{
+			name:       "Everything fits",
+			history:    exchanges(3, 100),
+			opts:       Options{Model: "sonar"},
+			expectSent: 6,
+		},
+		{
+			name:           "Message cap",
+			history:        exchanges(15, 10),
+			opts:           Options{Model: "sonar", MaxMessages: 20},
+			expectSent:     20,
+			expectDropped:  10,
+			expectMsgLimit: true,
+		},
+		{
+			// Each history message is 104 tokens and the latest input 8,
+			// so four history messages fit in 450 tokens
+			name:          "Token budget",
+			history:       exchanges(5, 400),
+			opts:          Options{Model: "sonar", MaxTokens: 450},
+			expectSent:    4,
+			expectDropped: 6,
+		},
+		{
+			// Three messages fit, but the oldest is an assistant reply
+			name:          "Odd cut drops leading assistant reply",
+			history:       exchanges(5, 400),
+			opts:          Options{Model: "sonar", MaxTokens: 400},
+			expectSent:    2,
+			expectDropped: 8,
+		},
+		{
+			name:          "Input alone exceeds budget",
+			history:       exchanges(2, 10),
+			opts:          Options{Model: "sonar", MaxTokens: 1},
+			expectSent:    0,
+			expectDropped: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := Build(tt.history, "latest question", tt.opts)
+
+			if ctx.Sent != tt.expectSent || ctx.Dropped != tt.expectDropped {
+				t.Errorf("Build() sent %d and dropped %d, expected %d and %d", ctx.Sent, ctx.Dropped, tt.expectSent, tt.expectDropped)
+			}
+			if ctx.MessageLimited != tt.expectMsgLimit {
+				t.Errorf("MessageLimited = %v, expected %v", ctx.MessageLimited, tt.expectMsgLimit)
+			}
+
+			last := ctx.Messages[len(ctx.Messages)-1]
+			if last.Role != "user" || last.Content != "latest question" {
+				t.Errorf("last message = %+v, expected the latest user turn", last)
+			}
+			if ctx.Sent > 0 && ctx.Messages[0].Role != "user" {
+				t.Errorf("history starts with a %s message", ctx.Messages[0].Role)
+			}
+		})
+	}
+}
+
+func TestBuildKeepsSystemPrompt(t *testing.T) {
+	ctx := Build(exchanges(5, 400), "latest question", Options{
+		Model:        "sonar",
+		SystemPrompt: "Answer briefly.",
+		MaxTokens:    10,
+	})
+
+	if len(ctx.Messages) != 2 {
+		t.Fatalf("Build() returned %d messages, expected 2", len(ctx.Messages))
+	}
+	if ctx.Messages[0].Role != "system" || ctx.Messages[0].Content != "Answer briefly." {
+		t.Errorf("first message = %+v, expected the system prompt", ctx.Messages[0])
+	}
+	if !ctx.Truncated() {
+		t.Error("Truncated() = false, expected true")
+	}
+}
+
+func TestBuildStripsReferences(t *testing.T) {
+	history := []session.SessionMessage{
+		{Role: "user", Content: "What is Paris?"},
+		{Role: "assistant", Content: "A city. [1]\n\n## References:\n[1] Wikipedia"},
+	}
+
+	ctx := Build(history, "And Lyon?", Options{Model: "sonar"})
+	if ctx.Messages[1].Content != "A city. [1]" {
+		t.Errorf("assistant content = %q, expected references stripped", ctx.Messages[1].Content)
+	}
+}
+
+func TestBuildStripsReasoning(t *testing.T) {
+	history := []session.SessionMessage{
+		{Role: "user", Content: "What is Paris?"},
+		{Role: "assistant", Content: "<think>A geography question.</think>\nA city.", Reasoning: "Kept apart."},
+	}
+
+	ctx := Build(history, "And Lyon?", Options{Model: "sonar-reasoning"})
+	if ctx.Messages[1].Content != "A city." {
+		t.Errorf("assistant content = %q, expected reasoning stripped", ctx.Messages[1].Content)
+	}
+}
+
+func TestBudget(t *testing.T) {
+	tests := []struct {
+		opts     Options
+		expected int
+	}{
+		{Options{Model: "sonar"}, 127000 - DefaultResponseTokens},
+		{Options{Model: "sonar-pro", ResponseTokens: 1000}, 199000},
+		{Options{Model: "unknown-model"}, DefaultContextTokens - DefaultResponseTokens},
+		{Options{Model: "sonar", MaxTokens: 8000}, 8000},
+		{Options{Model: "sonar", MaxTokens: 500000}, 127000 - DefaultResponseTokens},
+	}
+
+	for _, tt := range tests {
+		if got := tt.opts.Budget(); got != tt.expected {
+			t.Errorf("Budget(%+v) = %d, expected %d", tt.opts, got, tt.expected)
+		}
+	}
+}
+
+func TestBuildWithSummary(t *testing.T) {
+	opts := Options{Model: "sonar", Summary: Summary{Text: "Earlier: France.", Messages: 6}}
+	ctx := Build(exchanges(5, 10), "latest question", opts)
+
+	if ctx.Summarized != 6 || ctx.Sent != 4 || ctx.Dropped != 0 {
+		t.Errorf("Build() summarized %d, sent %d, dropped %d; expected 6, 4, 0", ctx.Summarized, ctx.Sent, ctx.Dropped)
+	}
+	if ctx.Messages[0].Role != "system" || !strings.Contains(ctx.Messages[0].Content, "Earlier: France.") {
+		t.Errorf("first message = %+v, expected the summary", ctx.Messages[0])
+	}
+}
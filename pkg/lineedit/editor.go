@@ -0,0 +1,258 @@
+// Package lineedit reads interactive input with line editing, persistent
+// history, reverse search and multiline messages. When input is not a
+// terminal it falls back to reading plain lines.
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	"golang.org/x/term"
+)
+
+const (
+	bracketedPasteOn  = "\x1b[?2004h"
+	bracketedPasteOff = "\x1b[?2004l"
+	clearScreen       = "\x1b[H\x1b[2J"
+
+	// tabWidth is the number of columns a tab is displayed as
+	tabWidth = 4
+)
+
+// ErrInterrupted is returned by ReadLine when Ctrl+C is pressed on an empty
+// line
+var ErrInterrupted = errors.New("interrupted")
+
+// Editor reads lines of input
+type Editor struct {
+	in     *os.File
+	out    io.Writer
+	reader *bufio.Reader
+
+	// History is recalled with the arrow keys and Ctrl+R, and lines read
+	// from a terminal are added to it; nil disables history
+	History *History
+	// ContinuationPrompt is shown before every line of a multiline message
+	// after the first
+	ContinuationPrompt string
+
+	// width returns the terminal width in columns
+	width func() int
+	// cursorRow is the row of the cursor after the last render, relative
+	// to the row the prompt starts on
+	cursorRow int
+}
+
+// New returns an editor reading from in and echoing to out
+func New(in *os.File, out io.Writer) *Editor {
+	e := &Editor{
+		in:                 in,
+		out:                out,
+		reader:             bufio.NewReader(in),
+		ContinuationPrompt: "... ",
+	}
+	e.width = e.terminalWidth
+	return e
+}
+
+// Reader returns the buffered reader over the editor's input, for reading
+// answers to prompts outside ReadLine without losing buffered input
+func (e *Editor) Reader() *bufio.Reader {
+	return e.reader
+}
+
+// ReadLine prints prompt and reads a message. On a terminal the line can be
+// edited, history recalled and multiline messages entered; otherwise lines
+// are read as they are, joining continued lines. It returns io.EOF at the
+// end of input and ErrInterrupted for Ctrl+C on an empty line.
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	if !e.isTerminal() {
+		return e.readPlain(prompt)
+	}
+
+	fd := int(e.in.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return e.readPlain(prompt)
+	}
+	defer term.Restore(fd, state)
+
+	fmt.Fprint(e.out, bracketedPasteOn)
+	defer fmt.Fprint(e.out, bracketedPasteOff)
+
+	line, err := e.edit(prompt)
+	if err != nil {
+		return "", err
+	}
+	if err := e.History.Add(line); err != nil {
+		// History is a convenience; failing to record it is not fatal
+		fmt.Fprintf(e.out, "Warning: %v\r\n", err)
+	}
+	return line, nil
+}
+
+// isTerminal reports whether both input and output are terminals
+func (e *Editor) isTerminal() bool {
+	out, ok := e.out.(*os.File)
+	return ok && term.IsTerminal(int(e.in.Fd())) && term.IsTerminal(int(out.Fd()))
+}
+
+// terminalWidth returns the width of the output terminal, or 80
+func (e *Editor) terminalWidth() int {
+	if out, ok := e.out.(*os.File); ok {
+		if width, _, err := term.GetSize(int(out.Fd())); err == nil && width > 0 {
+			return width
+		}
+	}
+	return 80
+}
+
+// readPlain reads lines without editing, joining the lines of a """ block.
+// Backslashes ending a line are kept: only the terminal editor continues
+// such lines.
+func (e *Editor) readPlain(prompt string) (string, error) {
+	fmt.Fprint(e.out, prompt)
+
+	var lines []string
+	for {
+		line, err := e.reader.ReadString('\n')
+		eof := errors.Is(err, io.EOF)
+		if err != nil && !eof {
+			return "", err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if eof && line == "" && len(lines) == 0 {
+			fmt.Fprintln(e.out)
+			return "", io.EOF
+		}
+		lines = append(lines, line)
+
+		text := strings.Join(lines, "\n")
+		if eof || !NeedsMore(text, false) {
+			return Finish(text, false), nil
+		}
+		fmt.Fprint(e.out, e.ContinuationPrompt)
+	}
+}
+
+// edit runs the editing loop on a terminal in raw mode
+func (e *Editor) edit(prompt string) (string, error) {
+	s := newLineState(prompt, e.History.Entries())
+	e.cursorRow = 0
+	e.refresh(s)
+
+	for {
+		k, err := readKey(e.reader)
+		if err != nil {
+			return "", err
+		}
+
+		switch s.handle(k) {
+		case actionSubmit:
+			e.finishLine(s, "")
+			return Finish(s.text(), true), nil
+		case actionEOF:
+			e.finishLine(s, "")
+			return "", io.EOF
+		case actionInterrupt:
+			e.finishLine(s, "^C")
+			return "", ErrInterrupted
+		case actionCancelLine:
+			// Discard the line and start over, like a shell
+			e.finishLine(s, "^C")
+			s = newLineState(prompt, e.History.Entries())
+			e.cursorRow = 0
+			e.refresh(s)
+		case actionClearScreen:
+			fmt.Fprint(e.out, clearScreen)
+			e.cursorRow = 0
+			e.refresh(s)
+		default:
+			e.refresh(s)
+		}
+	}
+}
+
+// finishLine redraws the line with the cursor at its end, then prints
+// suffix and moves to a new line
+func (e *Editor) finishLine(s *lineState, suffix string) {
+	s.searching = false
+	s.pos = len(s.buf)
+	e.refresh(s)
+	fmt.Fprint(e.out, suffix+"\r\n")
+	e.cursorRow = 0
+}
+
+// refresh redraws the prompt and buffer and places the cursor. Lines that
+// do not fit the terminal are wrapped explicitly so the cursor position is
+// known.
+func (e *Editor) refresh(s *lineState) {
+	width := e.width()
+	prompt, buf, pos := s.view()
+
+	var b strings.Builder
+	if e.cursorRow > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", e.cursorRow)
+	}
+	b.WriteString("\r\x1b[J")
+	b.WriteString(prompt)
+
+	row, col := 0, runewidth.StringWidth(prompt)
+	curRow, curCol := row, col
+	for i, r := range buf {
+		if r == '\n' {
+			if i == pos {
+				curRow, curCol = row, min(col, width-1)
+			}
+			b.WriteString("\r\n" + e.ContinuationPrompt)
+			row, col = row+1, runewidth.StringWidth(e.ContinuationPrompt)
+			continue
+		}
+
+		text, w := displayRune(r)
+		if col+w > width {
+			b.WriteString("\r\n")
+			row, col = row+1, 0
+		}
+		if i == pos {
+			curRow, curCol = row, col
+		}
+		b.WriteString(text)
+		col += w
+	}
+	if pos == len(buf) {
+		curRow, curCol = row, col
+	}
+
+	// A cursor past the last column belongs at the start of the next row
+	if pos == len(buf) && curCol >= width {
+		b.WriteString("\r\n")
+		row++
+		curRow, curCol = row, 0
+	}
+
+	if up := row - curRow; up > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", up)
+	}
+	b.WriteString("\r")
+	if curCol > 0 {
+		fmt.Fprintf(&b, "\x1b[%dC", curCol)
+	}
+
+	fmt.Fprint(e.out, b.String())
+	e.cursorRow = curRow
+}
+
+// displayRune returns how a rune is shown and its width in columns
+func displayRune(r rune) (string, int) {
+	if r == '\t' {
+		return strings.Repeat(" ", tabWidth), tabWidth
+	}
+	return string(r), runewidth.RuneWidth(r)
+}
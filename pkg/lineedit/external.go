@@ -0,0 +1,66 @@
+package lineedit
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// EditorCommand returns the user's editor command: $VISUAL, then $EDITOR,
+// then a platform default
+func EditorCommand() string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if editor := strings.TrimSpace(os.Getenv(env)); editor != "" {
+			return editor
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return "notepad"
+	}
+	return "vi"
+}
+
+// EditExternal opens text in the user's editor and returns the saved text
+// with surrounding whitespace trimmed. The editor command may include
+// arguments, e.g. "code --wait".
+func EditExternal(text string) (string, error) {
+	f, err := os.CreateTemp("", "pplx-message-*.md")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	path := f.Name()
+	defer os.Remove(path)
+
+	_, err = f.WriteString(text)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	if err := OpenEditor(path); err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read edited message: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// OpenEditor opens path in the user's editor and waits for it to exit
+func OpenEditor(path string) error {
+	args := strings.Fields(EditorCommand())
+	cmd := exec.Command(args[0], append(args[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor %s failed: %w", args[0], err)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package lineedit
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultHistorySize is the number of entries kept in the history
+const DefaultHistorySize = 1000
+
+// History is a list of previously entered lines, optionally persisted to a
+// file with one entry per line. Newlines and backslashes in entries are
+// escaped so multiline entries take a single line.
+type History struct {
+	path    string
+	max     int
+	entries []string
+}
+
+// NewHistory returns an in-memory history of up to max entries
+func NewHistory(max int) *History {
+	return &History{max: max}
+}
+
+// LoadHistory reads the history file at path, keeping the last max entries.
+// A missing file is an empty history. New entries are appended to the file.
+func LoadHistory(path string, max int) (*History, error) {
+	h := &History{path: path, max: max}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+	defer f.Close()
+
+	var lines int
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		lines++
+		h.append(decodeEntry(scanner.Text()))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	// Rewrite the file once it holds far more lines than are kept
+	if lines > 2*max {
+		if err := h.rewrite(); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// Entries returns the entries, oldest first
+func (h *History) Entries() []string {
+	if h == nil {
+		return nil
+	}
+	return h.entries
+}
+
+// Add records an entry, skipping blank entries and repeats of the latest
+// entry, and appends it to the history file if there is one
+func (h *History) Add(entry string) error {
+	if h == nil || strings.TrimSpace(entry) == "" {
+		return nil
+	}
+	if n := len(h.entries); n > 0 && h.entries[n-1] == entry {
+		return nil
+	}
+
+	h.append(entry)
+	if h.path == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open history: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(encodeEntry(entry) + "\n"); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return nil
+}
+
+// append adds an entry in memory, dropping the oldest beyond max
+func (h *History) append(entry string) {
+	h.entries = append(h.entries, entry)
+	if h.max > 0 && len(h.entries) > h.max {
+		h.entries = h.entries[len(h.entries)-h.max:]
+	}
+}
+
+// rewrite replaces the history file with the kept entries
+func (h *History) rewrite() error {
+	var b strings.Builder
+	for _, entry := range h.entries {
+		b.WriteString(encodeEntry(entry) + "\n")
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(h.path), ".history-*")
+	if err != nil {
+		return fmt.Errorf("failed to rewrite history: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(b.String()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to rewrite history: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to rewrite history: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), h.path); err != nil {
+		return fmt.Errorf("failed to rewrite history: %w", err)
+	}
+	return nil
+}
+
+// encodeEntry escapes backslashes and newlines so an entry fits one line
+func encodeEntry(entry string) string {
+	entry = strings.ReplaceAll(entry, `\`, `\\`)
+	entry = strings.ReplaceAll(entry, "\r", `\r`)
+	return strings.ReplaceAll(entry, "\n", `\n`)
+}
+
+// decodeEntry reverses encodeEntry
+func decodeEntry(line string) string {
+	var b strings.Builder
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped && r == 'n':
+			b.WriteRune('\n')
+		case escaped && r == 'r':
+			b.WriteRune('\r')
+		case escaped:
+			b.WriteRune(r)
+		case r == '\\':
+			escaped = true
+			continue
+		default:
+			b.WriteRune(r)
+		}
+		escaped = false
+	}
+	return b.String()
+}
@@ -0,0 +1,156 @@
+package lineedit
+
+import (
+	"bufio"
+)
+
+// keyKind identifies an editing key
+type keyKind int
+
+const (
+	keyNone keyKind = iota
+	keyRune
+	keyEnter
+	keyNewline
+	keyBackspace
+	keyDelete
+	keyLeft
+	keyRight
+	keyWordLeft
+	keyWordRight
+	keyUp
+	keyDown
+	keyHome
+	keyEnd
+	keyKillEnd
+	keyKillStart
+	keyKillWord
+	keyClearScreen
+	keySearch
+	keyCancel
+	keyInterrupt
+	keyEOF
+	keyPasteStart
+	keyPasteEnd
+)
+
+// key is a single decoded keypress; r is set for keyRune
+type key struct {
+	kind keyKind
+	r    rune
+}
+
+// controlKeys maps control characters to editing keys
+var controlKeys = map[rune]keyKind{
+	0x01: keyHome,        // Ctrl+A
+	0x02: keyLeft,        // Ctrl+B
+	0x03: keyInterrupt,   // Ctrl+C
+	0x04: keyEOF,         // Ctrl+D
+	0x05: keyEnd,         // Ctrl+E
+	0x06: keyRight,       // Ctrl+F
+	0x07: keyCancel,      // Ctrl+G
+	0x08: keyBackspace,   // Ctrl+H
+	0x0a: keyNewline,     // Ctrl+J
+	0x0b: keyKillEnd,     // Ctrl+K
+	0x0c: keyClearScreen, // Ctrl+L
+	0x0d: keyEnter,       // Enter
+	0x0e: keyDown,        // Ctrl+N
+	0x10: keyUp,          // Ctrl+P
+	0x12: keySearch,      // Ctrl+R
+	0x15: keyKillStart,   // Ctrl+U
+	0x17: keyKillWord,    // Ctrl+W
+	0x7f: keyBackspace,   // Backspace
+}
+
+// csiKeys maps the final byte and parameters of CSI sequences to keys
+var csiKeys = map[string]keyKind{
+	"A":    keyUp,
+	"B":    keyDown,
+	"C":    keyRight,
+	"D":    keyLeft,
+	"H":    keyHome,
+	"F":    keyEnd,
+	"1~":   keyHome,
+	"7~":   keyHome,
+	"4~":   keyEnd,
+	"8~":   keyEnd,
+	"3~":   keyDelete,
+	"1;5C": keyWordRight,
+	"1;5D": keyWordLeft,
+	"1;3C": keyWordRight,
+	"1;3D": keyWordLeft,
+	"200~": keyPasteStart,
+	"201~": keyPasteEnd,
+}
+
+// readKey decodes the next keypress from r. An escape that is not followed
+// by buffered input is a lone Esc key, which cancels like Ctrl+G.
+func readKey(r *bufio.Reader) (key, error) {
+	c, _, err := r.ReadRune()
+	if err != nil {
+		return key{}, err
+	}
+
+	if c == 0x1b {
+		return readEscape(r)
+	}
+	if c == '\t' {
+		return key{kind: keyRune, r: c}, nil
+	}
+	if kind, ok := controlKeys[c]; ok {
+		return key{kind: kind}, nil
+	}
+	if c < 0x20 {
+		return key{kind: keyNone}, nil
+	}
+	return key{kind: keyRune, r: c}, nil
+}
+
+// readEscape decodes the rest of an escape sequence
+func readEscape(r *bufio.Reader) (key, error) {
+	if r.Buffered() == 0 {
+		return key{kind: keyCancel}, nil
+	}
+
+	c, _, err := r.ReadRune()
+	if err != nil {
+		return key{}, err
+	}
+
+	switch c {
+	case '[':
+		return readCSI(r)
+	case 'O':
+		// SS3 sequences sent by some terminals for arrows, Home and End
+		c, _, err := r.ReadRune()
+		if err != nil {
+			return key{}, err
+		}
+		return key{kind: csiKeys[string(c)]}, nil
+	case '\r':
+		return key{kind: keyNewline}, nil
+	case 'b':
+		return key{kind: keyWordLeft}, nil
+	case 'f':
+		return key{kind: keyWordRight}, nil
+	case 0x7f:
+		return key{kind: keyKillWord}, nil
+	}
+	return key{kind: keyNone}, nil
+}
+
+// readCSI reads the parameters and final byte of a CSI sequence
+func readCSI(r *bufio.Reader) (key, error) {
+	var seq []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return key{}, err
+		}
+		seq = append(seq, b)
+		if b >= 0x40 && b <= 0x7e {
+			break
+		}
+	}
+	return key{kind: csiKeys[string(seq)]}, nil
+}
@@ -0,0 +1,221 @@
+package lineedit
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHistoryPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	h, err := LoadHistory(path, 3)
+	if err != nil {
+		t.Fatalf("LoadHistory() failed: %v", err)
+	}
+	for _, entry := range []string{"first", "first", "  ", "two\nlines", `back\slash`, "last"} {
+		if err := h.Add(entry); err != nil {
+			t.Fatalf("Add(%q) failed: %v", entry, err)
+		}
+	}
+
+	expected := []string{"two\nlines", `back\slash`, "last"}
+	if got := h.Entries(); strings.Join(got, "|") != strings.Join(expected, "|") {
+		t.Errorf("Entries() = %q, expected %q", got, expected)
+	}
+
+	// Reloading keeps the newest entries and decodes escapes
+	reloaded, err := LoadHistory(path, 3)
+	if err != nil {
+		t.Fatalf("LoadHistory() failed: %v", err)
+	}
+	if got := reloaded.Entries(); strings.Join(got, "|") != strings.Join(expected, "|") {
+		t.Errorf("reloaded Entries() = %q, expected %q", got, expected)
+	}
+
+	// A file with more than twice the kept entries is rewritten
+	for _, entry := range []string{"a", "b", "c"} {
+		reloaded.Add(entry)
+	}
+	if _, err := LoadHistory(path, 3); err != nil {
+		t.Fatalf("LoadHistory() failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() failed: %v", err)
+	}
+	if string(data) != "a\nb\nc\n" {
+		t.Errorf("history file = %q, expected it rewritten to the last 3 entries", data)
+	}
+
+	// A nil history records nothing
+	var none *History
+	if err := none.Add("ignored"); err != nil || none.Entries() != nil {
+		t.Errorf("nil history Add() = %v, Entries() = %q", err, none.Entries())
+	}
+}
+
+func TestMultiline(t *testing.T) {
+	tests := []struct {
+		text     string
+		more     bool
+		expected string
+	}{
+		{"hello", false, "hello"},
+		{`first \`, true, ""},
+		{"first \\\nsecond", false, "first \nsecond"},
+		{`"""`, true, ""},
+		{"\"\"\"\nline one\n\nline two", true, ""},
+		{"\"\"\"\nline one\n\nline two\n\"\"\"", false, "line one\n\nline two"},
+		{`"""inline"""`, false, "inline"},
+		{`say """hi"""`, false, `say """hi"""`},
+	}
+
+	for _, tt := range tests {
+		if got := NeedsMore(tt.text, true); got != tt.more {
+			t.Errorf("NeedsMore(%q) = %v, expected %v", tt.text, got, tt.more)
+		}
+		if tt.more {
+			continue
+		}
+		if got := Finish(tt.text, true); got != tt.expected {
+			t.Errorf("Finish(%q) = %q, expected %q", tt.text, got, tt.expected)
+		}
+	}
+}
+
+func TestMultilinePiped(t *testing.T) {
+	for _, text := range []string{`C:\temp\`, "first \\\nsecond"} {
+		if NeedsMore(text, false) {
+			t.Errorf("NeedsMore(%q) on piped input = true, expected false", text)
+		}
+		if got := Finish(text, false); got != text {
+			t.Errorf("Finish(%q) on piped input = %q, expected it unchanged", text, got)
+		}
+	}
+	if !NeedsMore(`"""`, false) {
+		t.Error(`NeedsMore on piped input ignored an open """ block`)
+	}
+}
+
+func TestReadKey(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []key
+	}{
+		{"aé", []key{{kind: keyRune, r: 'a'}, {kind: keyRune, r: 'é'}}},
+		{"\r\x12\x03", []key{{kind: keyEnter}, {kind: keySearch}, {kind: keyInterrupt}}},
+		{"\x1b[A\x1b[B\x1bOH\x1b[3~", []key{{kind: keyUp}, {kind: keyDown}, {kind: keyHome}, {kind: keyDelete}}},
+		{"\x1b[1;5D\x1bf\x1b\r", []key{{kind: keyWordLeft}, {kind: keyWordRight}, {kind: keyNewline}}},
+		{"\x1b[200~x\x1b[201~", []key{{kind: keyPasteStart}, {kind: keyRune, r: 'x'}, {kind: keyPasteEnd}}},
+		{"\x1b", []key{{kind: keyCancel}}},
+	}
+
+	for _, tt := range tests {
+		r := bufio.NewReader(strings.NewReader(tt.input))
+		var got []key
+		for {
+			k, err := readKey(r)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("readKey(%q) failed: %v", tt.input, err)
+			}
+			got = append(got, k)
+		}
+
+		if len(got) != len(tt.expected) {
+			t.Errorf("readKey(%q) = %v, expected %v", tt.input, got, tt.expected)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.expected[i] {
+				t.Errorf("readKey(%q) key %d = %v, expected %v", tt.input, i, got[i], tt.expected[i])
+			}
+		}
+	}
+}
+
+// testEditor returns an editor reading keys from input, as on a terminal
+func testEditor(input string, history ...string) *Editor {
+	h := NewHistory(DefaultHistorySize)
+	for _, entry := range history {
+		h.Add(entry)
+	}
+	return &Editor{
+		out:                io.Discard,
+		reader:             bufio.NewReader(strings.NewReader(input)),
+		History:            h,
+		ContinuationPrompt: "... ",
+		width:              func() int { return 20 },
+	}
+}
+
+func TestEdit(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		history  []string
+		expected string
+	}{
+		{"typing", "hello\r", nil, "hello"},
+		{"cursor movement", "world\x01hello \r", nil, "hello world"},
+		{"backspace and kill", "one two\x17three\x7f\x7fee\r", nil, "one three"},
+		{"kill line", "discard\x15keep\r", nil, "keep"},
+		{"history", "\x1b[A\x1b[A\r", []string{"older", "newer"}, "older"},
+		{"history returns to typed line", "draft\x1b[A\x1b[B\r", []string{"older"}, "draft"},
+		{"reverse search", "\x12old\r", []string{"older", "newer"}, "older"},
+		{"reverse search again", "\x12e\x12\r", []string{"older", "newer"}, "older"},
+		{"search then edit", "\x12new\x05!\r", []string{"older", "newer"}, "newer!"},
+		{"cancel search", "typed\x12zzz\x07\r", []string{"older"}, "typed"},
+		{"cancel line", "gone\x03kept\r", nil, "kept"},
+		{"backslash continuation", "one \\\rtwo\r", nil, "one \ntwo"},
+		{"triple quotes", "\"\"\"\ra\r\rb\r\"\"\"\r", nil, "a\n\nb"},
+		{"alt enter", "a\x1b\rb\r", nil, "a\nb"},
+		{"bracketed paste", "\x1b[200~x\ry\x1b[201~\r", nil, "x\ny"},
+		{"wrapped line", strings.Repeat("w", 50) + "\x01\x05\r", nil, strings.Repeat("w", 50)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := testEditor(tt.input, tt.history...)
+			got, err := e.edit("> ")
+			if err != nil {
+				t.Fatalf("edit() failed: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("edit() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+
+	if _, err := testEditor("\x04").edit("> "); err != io.EOF {
+		t.Errorf("Ctrl+D on an empty line returned %v, expected io.EOF", err)
+	}
+	if _, err := testEditor("\x03").edit("> "); err != ErrInterrupted {
+		t.Errorf("Ctrl+C on an empty line returned %v, expected ErrInterrupted", err)
+	}
+}
+
+func TestReadPlain(t *testing.T) {
+	input := "single\nfirst \\\nsecond\n\"\"\"\nblock\n\"\"\"\nlast"
+	e := New(nil, io.Discard)
+	e.reader = bufio.NewReader(strings.NewReader(input))
+
+	for _, expected := range []string{"single", "first \\", "second", "block", "last"} {
+		got, err := e.readPlain("> ")
+		if err != nil {
+			t.Fatalf("readPlain() failed: %v", err)
+		}
+		if got != expected {
+			t.Errorf("readPlain() = %q, expected %q", got, expected)
+		}
+	}
+	if _, err := e.readPlain("> "); err != io.EOF {
+		t.Errorf("readPlain() at end of input returned %v, expected io.EOF", err)
+	}
+}
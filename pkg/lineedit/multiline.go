@@ -0,0 +1,37 @@
+package lineedit
+
+import "strings"
+
+// tripleQuote opens and closes a multiline block
+const tripleQuote = `"""`
+
+// NeedsMore reports whether text is an unfinished multiline message: it
+// opens a """ block that is not closed yet or, when editing on a terminal,
+// ends with a backslash. Piped input keeps its backslashes, since a line of
+// code or a Windows path may end with one.
+func NeedsMore(text string, terminal bool) bool {
+	if strings.HasPrefix(strings.TrimSpace(text), tripleQuote) {
+		return strings.Count(text, tripleQuote) < 2
+	}
+	return terminal && strings.HasSuffix(text, `\`)
+}
+
+// Finish turns the raw text of a multiline message into the message: the
+// quotes around a """ block are removed and, when editing on a terminal,
+// backslashes ending a line are dropped
+func Finish(text string, terminal bool) string {
+	trimmed := strings.TrimSpace(text)
+	if strings.HasPrefix(trimmed, tripleQuote) {
+		trimmed = strings.TrimPrefix(trimmed, tripleQuote)
+		if i := strings.LastIndex(trimmed, tripleQuote); i >= 0 {
+			trimmed = trimmed[:i]
+		}
+		return strings.Trim(trimmed, "\r\n")
+	}
+	if !terminal {
+		return text
+	}
+
+	text = strings.ReplaceAll(text, "\\\n", "\n")
+	return strings.TrimSuffix(text, `\`)
+}
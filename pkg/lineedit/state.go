@@ -0,0 +1,289 @@
+package lineedit
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// action tells the editor what to do after a key was handled
+type action int
+
+const (
+	actionRefresh action = iota
+	actionSubmit
+	actionEOF
+	actionInterrupt
+	actionCancelLine
+	actionClearScreen
+)
+
+// lineState is the buffer being edited, with history navigation and
+// reverse search
+type lineState struct {
+	prompt string
+	buf    []rune
+	pos    int
+
+	history []string
+	// histIndex is the history entry shown; len(history) is the line being
+	// typed, saved in pending while browsing
+	histIndex int
+	pending   []rune
+
+	// paste is set between the start and end of a bracketed paste
+	paste bool
+
+	// searching is set during reverse search for query; match is the
+	// history index of the current match, or -1
+	searching bool
+	query     []rune
+	match     int
+	failed    bool
+	// saved and savedIndex restore the buffer when the search is cancelled
+	saved      []rune
+	savedIndex int
+}
+
+// newLineState returns an empty buffer browsing history
+func newLineState(prompt string, history []string) *lineState {
+	return &lineState{prompt: prompt, history: history, histIndex: len(history)}
+}
+
+// text returns the buffer contents
+func (s *lineState) text() string {
+	return string(s.buf)
+}
+
+// view returns the prompt, buffer and cursor position to render
+func (s *lineState) view() (string, []rune, int) {
+	if !s.searching {
+		return s.prompt, s.buf, s.pos
+	}
+
+	label := "reverse-i-search"
+	if s.failed {
+		label = "failed reverse-i-search"
+	}
+	return fmt.Sprintf("(%s)`%s': ", label, string(s.query)), s.buf, s.pos
+}
+
+// handle applies a key to the buffer
+func (s *lineState) handle(k key) action {
+	if s.searching {
+		if a, done := s.handleSearch(k); done {
+			return a
+		}
+	}
+
+	if s.paste {
+		switch k.kind {
+		case keyEnter, keyNewline:
+			s.insert('\n')
+			return actionRefresh
+		case keyPasteEnd:
+			s.paste = false
+			return actionRefresh
+		}
+	}
+
+	switch k.kind {
+	case keyRune:
+		s.insert(k.r)
+	case keyEnter:
+		if NeedsMore(s.text(), true) {
+			s.insert('\n')
+			return actionRefresh
+		}
+		return actionSubmit
+	case keyNewline:
+		s.insert('\n')
+	case keyBackspace:
+		if s.pos > 0 {
+			s.buf = append(s.buf[:s.pos-1], s.buf[s.pos:]...)
+			s.pos--
+		}
+	case keyDelete:
+		if s.pos < len(s.buf) {
+			s.buf = append(s.buf[:s.pos], s.buf[s.pos+1:]...)
+		}
+	case keyEOF:
+		if len(s.buf) == 0 {
+			return actionEOF
+		}
+		if s.pos < len(s.buf) {
+			s.buf = append(s.buf[:s.pos], s.buf[s.pos+1:]...)
+		}
+	case keyLeft:
+		s.pos = max(s.pos-1, 0)
+	case keyRight:
+		s.pos = min(s.pos+1, len(s.buf))
+	case keyWordLeft:
+		s.pos = s.wordStart()
+	case keyWordRight:
+		s.pos = s.wordEnd()
+	case keyHome:
+		s.pos = 0
+	case keyEnd:
+		s.pos = len(s.buf)
+	case keyKillEnd:
+		s.buf = s.buf[:s.pos]
+	case keyKillStart:
+		s.buf = append([]rune(nil), s.buf[s.pos:]...)
+		s.pos = 0
+	case keyKillWord:
+		start := s.wordStart()
+		s.buf = append(s.buf[:start], s.buf[s.pos:]...)
+		s.pos = start
+	case keyUp:
+		s.browse(s.histIndex - 1)
+	case keyDown:
+		s.browse(s.histIndex + 1)
+	case keySearch:
+		s.startSearch()
+	case keyInterrupt:
+		if len(s.buf) == 0 {
+			return actionInterrupt
+		}
+		return actionCancelLine
+	case keyClearScreen:
+		return actionClearScreen
+	case keyPasteStart:
+		s.paste = true
+	}
+	return actionRefresh
+}
+
+// insert inserts r at the cursor
+func (s *lineState) insert(r rune) {
+	s.buf = append(s.buf[:s.pos], append([]rune{r}, s.buf[s.pos:]...)...)
+	s.pos++
+}
+
+// set replaces the buffer and moves the cursor to its end
+func (s *lineState) set(text []rune) {
+	s.buf = append([]rune(nil), text...)
+	s.pos = len(s.buf)
+}
+
+// wordStart returns the start of the word before the cursor
+func (s *lineState) wordStart() int {
+	i := s.pos
+	for i > 0 && unicode.IsSpace(s.buf[i-1]) {
+		i--
+	}
+	for i > 0 && !unicode.IsSpace(s.buf[i-1]) {
+		i--
+	}
+	return i
+}
+
+// wordEnd returns the end of the word after the cursor
+func (s *lineState) wordEnd() int {
+	i := s.pos
+	for i < len(s.buf) && unicode.IsSpace(s.buf[i]) {
+		i++
+	}
+	for i < len(s.buf) && !unicode.IsSpace(s.buf[i]) {
+		i++
+	}
+	return i
+}
+
+// browse shows history entry i, keeping the line being typed so it can be
+// returned to
+func (s *lineState) browse(i int) {
+	if i < 0 || i > len(s.history) || i == s.histIndex {
+		return
+	}
+	if s.histIndex == len(s.history) {
+		s.pending = append([]rune(nil), s.buf...)
+	}
+
+	s.histIndex = i
+	if i == len(s.history) {
+		s.set(s.pending)
+	} else {
+		s.set([]rune(s.history[i]))
+	}
+}
+
+// startSearch enters reverse search from the newest entry
+func (s *lineState) startSearch() {
+	s.searching = true
+	s.query = nil
+	s.match = -1
+	s.failed = false
+	s.saved = append([]rune(nil), s.buf...)
+	s.savedIndex = s.histIndex
+	if s.histIndex == len(s.history) {
+		s.pending = s.saved
+	}
+}
+
+// handleSearch applies a key during reverse search. It reports false for
+// keys that end the search and should then be handled as normal edits.
+func (s *lineState) handleSearch(k key) (action, bool) {
+	switch k.kind {
+	case keyRune:
+		s.query = append(s.query, k.r)
+		s.search(s.matchOrNewest())
+		return actionRefresh, true
+	case keyBackspace:
+		if len(s.query) > 0 {
+			s.query = s.query[:len(s.query)-1]
+		}
+		s.search(len(s.history) - 1)
+		return actionRefresh, true
+	case keySearch:
+		s.search(s.match - 1)
+		return actionRefresh, true
+	case keyCancel, keyInterrupt:
+		s.searching = false
+		s.histIndex = s.savedIndex
+		s.set(s.saved)
+		return actionRefresh, true
+	case keyEnter:
+		s.searching = false
+		return actionSubmit, true
+	}
+
+	// Any other key accepts the match and edits it
+	s.searching = false
+	return actionRefresh, false
+}
+
+// matchOrNewest returns the index to search back from when the query grows:
+// the current match, which may still match, or the newest entry
+func (s *lineState) matchOrNewest() int {
+	if s.match >= 0 {
+		return s.match
+	}
+	return len(s.history) - 1
+}
+
+// search finds the newest entry at or before index from that contains the
+// query and shows it with the cursor at the match
+func (s *lineState) search(from int) {
+	query := string(s.query)
+	if query == "" {
+		s.match = -1
+		s.failed = false
+		s.set(s.saved)
+		return
+	}
+
+	for i := min(from, len(s.history)-1); i >= 0; i-- {
+		offset := strings.Index(s.history[i], query)
+		if offset < 0 {
+			continue
+		}
+		s.match = i
+		s.failed = false
+		s.histIndex = i
+		s.set([]rune(s.history[i]))
+		s.pos = len([]rune(s.history[i][:offset]))
+		return
+	}
+	s.failed = true
+}
@@ -2,6 +2,7 @@ package perplexity
 
 import (
 	"fmt"
+	"net/url"
 	"regexp"
 	"strings"
 )
@@ -32,7 +33,8 @@ func ExtractCitations(content string) []Citation {
 	return citations
 }
 
-// ParseResponse parses the API response and extracts citations
+// ParseResponse parses the API response, separating the reasoning of a
+// reasoning model from the answer, and extracts citations
 func ParseResponse(resp *ChatCompletionResponse) *ParsedResponse {
 	if len(resp.Choices) == 0 {
 		return &ParsedResponse{
@@ -42,13 +44,14 @@ func ParseResponse(resp *ChatCompletionResponse) *ParsedResponse {
 		}
 	}
 
-	content := resp.Choices[0].Message.Content
+	reasoning, content := SplitReasoning(resp.Model, resp.Choices[0].Message.Content)
 	citations := ExtractCitations(content)
 
 	return &ParsedResponse{
 		Content:       content,
 		Citations:     citations,
 		SearchResults: resp.SearchResults,
+		Reasoning:     reasoning,
 	}
 }
 
@@ -80,6 +83,56 @@ func FormatWithReferences(parsed *ParsedResponse) string {
 	return sb.String()
 }
 
+// MergeSources combines the search results cited by several responses into
+// one list without duplicate URLs, in order of first citation, and returns
+// each response's content with its citation markers renumbered to point
+// into that list. Markers that do not refer to a search result are removed.
+func MergeSources(parts []*ParsedResponse) ([]string, []SearchResult) {
+	var merged []SearchResult
+	numbers := make(map[string]int)
+	contents := make([]string, len(parts))
+
+	for i, part := range parts {
+		contents[i] = citationRegex.ReplaceAllStringFunc(part.Content, func(marker string) string {
+			var num int
+			fmt.Sscanf(marker, "[%d]", &num)
+			if num < 1 || num > len(part.SearchResults) {
+				return ""
+			}
+
+			result := part.SearchResults[num-1]
+			n, ok := numbers[result.URL]
+			if !ok {
+				merged = append(merged, result)
+				n = len(merged)
+				numbers[result.URL] = n
+			}
+			return fmt.Sprintf("[%d]", n)
+		})
+	}
+
+	return contents, merged
+}
+
+// Domains returns the host names of results, without a leading "www.", in
+// order of first appearance
+func Domains(results []SearchResult) []string {
+	var domains []string
+	seen := make(map[string]bool)
+	for _, result := range results {
+		u, err := url.Parse(result.URL)
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+		domain := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+		if !seen[domain] {
+			seen[domain] = true
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
 // StripReferences removes the references section from content before sending to API
 // This prevents the model from receiving formatted references as context
 func StripReferences(content string) string {
@@ -95,3 +148,10 @@ func StripReferences(content string) string {
 
 	return content
 }
+
+// StripCitationMarkers removes inline citation markers such as [1] from content
+// and collapses the remaining whitespace into single spaces
+func StripCitationMarkers(content string) string {
+	stripped := citationRegex.ReplaceAllString(content, "")
+	return strings.Join(strings.Fields(stripped), " ")
+}
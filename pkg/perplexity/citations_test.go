@@ -1,6 +1,7 @@
 package perplexity
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -218,3 +219,76 @@ func TestStripReferences(t *testing.T) {
 		})
 	}
 }
+
+func TestStripCitationMarkers(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected string
+	}{
+		{"Paris is the capital. [1]", "Paris is the capital."},
+		{"Rust [1][2] and Go [3] compared", "Rust and Go compared"},
+		{"No citations here", "No citations here"},
+		{"Keep [notes] intact", "Keep [notes] intact"},
+	}
+
+	for _, tt := range tests {
+		result := StripCitationMarkers(tt.content)
+		if result != tt.expected {
+			t.Errorf("StripCitationMarkers(%q) = %q, expected %q", tt.content, result, tt.expected)
+		}
+	}
+}
+
+func TestMergeSources(t *testing.T) {
+	parts := []*ParsedResponse{
+		{
+			Content: "Go is fast [1] and simple [2].",
+			SearchResults: []SearchResult{
+				{Title: "Go", URL: "https://go.dev"},
+				{Title: "Blog", URL: "https://go.dev/blog"},
+			},
+		},
+		{
+			Content: "Rust is safe [1]; Go too [2]. Unknown [5].",
+			SearchResults: []SearchResult{
+				{Title: "Rust", URL: "https://rust-lang.org"},
+				{Title: "Go again", URL: "https://go.dev"},
+			},
+		},
+	}
+
+	contents, sources := MergeSources(parts)
+
+	expected := []string{"Go is fast [1] and simple [2].", "Rust is safe [3]; Go too [1]. Unknown ."}
+	for i := range expected {
+		if contents[i] != expected[i] {
+			t.Errorf("contents[%d] = %q, expected %q", i, contents[i], expected[i])
+		}
+	}
+
+	urls := []string{"https://go.dev", "https://go.dev/blog", "https://rust-lang.org"}
+	if len(sources) != len(urls) {
+		t.Fatalf("got %d sources, expected %d: %+v", len(sources), len(urls), sources)
+	}
+	for i, url := range urls {
+		if sources[i].URL != url {
+			t.Errorf("sources[%d] = %s, expected %s", i, sources[i].URL, url)
+		}
+	}
+}
+
+func TestDomains(t *testing.T) {
+	results := []SearchResult{
+		{URL: "https://www.Go.dev/doc"},
+		{URL: "https://go.dev/blog"},
+		{URL: "https://pkg.go.dev/fmt"},
+		{URL: "not a url"},
+		{URL: "http://github.com:443/golang/go"},
+	}
+
+	expected := []string{"go.dev", "pkg.go.dev", "github.com"}
+	domains := Domains(results)
+	if strings.Join(domains, ",") != strings.Join(expected, ",") {
+		t.Errorf("Domains() = %q, expected %q", domains, expected)
+	}
+}
@@ -2,6 +2,7 @@ package perplexity
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -57,6 +58,30 @@ func (c *Client) CreateCompletionWithRequest(req *ChatCompletionRequest) (*ChatC
 		return nil, fmt.Errorf("API key is required. Set PPLX_API_KEY environment variable.")
 	}
 
+	httpResp, err := c.send(context.Background(), c.httpClient, req)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	// Read response body
+	respBody, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	// Parse response
+	var resp ChatCompletionResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return &resp, nil
+}
+
+// send posts a chat completion request, retrying failed connections, and
+// returns the response once its status is OK
+func (c *Client) send(ctx context.Context, httpClient *http.Client, req *ChatCompletionRequest) (*http.Response, error) {
 	// Set default model if not specified
 	if req.Model == "" {
 		req.Model = c.config.Model
@@ -68,50 +93,39 @@ func (c *Client) CreateCompletionWithRequest(req *ChatCompletionRequest) (*ChatC
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	// Create HTTP request
-	httpReq, err := http.NewRequest("POST", c.endpoint, bytes.NewReader(body))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	// Set headers
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+c.config.APIKey)
-
-	// Make request with retries
+	// Make request with retries; each attempt needs a fresh body reader
 	var httpResp *http.Response
 	for attempt := 0; attempt <= c.config.MaxRetries; attempt++ {
-		httpResp, err = c.httpClient.Do(httpReq)
+		httpReq, err := http.NewRequestWithContext(ctx, "POST", c.endpoint, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+
+		// Set headers
+		httpReq.Header.Set("Content-Type", "application/json")
+		httpReq.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+
+		httpResp, err = httpClient.Do(httpReq)
 		if err == nil {
 			break
 		}
-		if attempt < c.config.MaxRetries {
-			time.Sleep(time.Duration(attempt+1) * time.Second)
+		if attempt == c.config.MaxRetries || ctx.Err() != nil {
+			return nil, fmt.Errorf("failed to make request after %d attempts: %w", attempt+1, err)
 		}
-	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to make request after %d attempts: %w", c.config.MaxRetries+1, err)
-	}
-	defer httpResp.Body.Close()
-
-	// Read response body
-	respBody, err := io.ReadAll(httpResp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		time.Sleep(time.Duration(attempt+1) * time.Second)
 	}
 
 	// Check for HTTP errors
 	if httpResp.StatusCode != http.StatusOK {
+		defer httpResp.Body.Close()
+		respBody, err := io.ReadAll(httpResp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response body: %w", err)
+		}
 		return nil, fmt.Errorf("API request failed with status %d: %s", httpResp.StatusCode, string(respBody))
 	}
 
-	// Parse response
-	var resp ChatCompletionResponse
-	if err := json.Unmarshal(respBody, &resp); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
-	}
-
-	return &resp, nil
+	return httpResp, nil
 }
 
 // Ask sends a simple query and returns the formatted response with references
@@ -0,0 +1,44 @@
+package perplexity
+
+import "strings"
+
+const (
+	thinkOpen  = "<think>"
+	thinkClose = "</think>"
+)
+
+// IsReasoningModel reports whether model thinks in a <think> block before
+// it answers
+func IsReasoningModel(model string) bool {
+	return strings.HasPrefix(model, "sonar-reasoning") || model == "sonar-deep-research"
+}
+
+// SplitReasoning separates the reasoning that reasoning models such as
+// sonar-reasoning give in a <think>...</think> block before their answer.
+// Only a block at the start of a reasoning model's content is reasoning;
+// other models, and answers that have started, may use the tags as text.
+// A block left open runs to the end of content, as in a response that was
+// cut off or is still streaming, and a closing tag without an opening one
+// ends reasoning that started with the content. Content without reasoning
+// is returned unchanged as the answer.
+func SplitReasoning(model, content string) (reasoning, answer string) {
+	if !IsReasoningModel(model) {
+		return "", content
+	}
+
+	if rest, ok := strings.CutPrefix(strings.TrimSpace(content), thinkOpen); ok {
+		reasoning, answer, _ = strings.Cut(rest, thinkClose)
+		return strings.TrimSpace(reasoning), strings.TrimSpace(answer)
+	}
+	if end := strings.Index(content, thinkClose); end >= 0 && !strings.Contains(content[:end], thinkOpen) {
+		return strings.TrimSpace(content[:end]), strings.TrimSpace(content[end+len(thinkClose):])
+	}
+	return "", content
+}
+
+// StripReasoning removes the reasoning of model from content, leaving the
+// answer
+func StripReasoning(model, content string) string {
+	_, answer := SplitReasoning(model, content)
+	return answer
+}
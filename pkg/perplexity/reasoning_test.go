@@ -0,0 +1,100 @@
+package perplexity
+
+import "testing"
+
+func TestSplitReasoning(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     string
+		content   string
+		reasoning string
+		answer    string
+	}{
+		{
+			name:    "No reasoning",
+			content: "  Paris is the capital of France. [1]\n",
+			answer:  "  Paris is the capital of France. [1]\n",
+		},
+		{
+			name:      "Leading block",
+			content:   "<think>\nThe user asks about France.\n</think>\n\nParis is the capital. [1]",
+			reasoning: "The user asks about France.",
+			answer:    "Paris is the capital. [1]",
+		},
+		{
+			name:      "Blocks after the answer",
+			content:   "<think>First.</think>Paris.<think>Second.</think>",
+			reasoning: "First.",
+			answer:    "Paris.<think>Second.</think>",
+		},
+		{
+			name:    "Block inside the answer",
+			content: "Wrap it in <think>...</think> tags.",
+			answer:  "Wrap it in <think>...</think> tags.",
+		},
+		{
+			name:    "Other model",
+			model:   "sonar-pro",
+			content: "<think>\nThe user asks about France.\n</think>\n\nParis.",
+			answer:  "<think>\nThe user asks about France.\n</think>\n\nParis.",
+		},
+		{
+			name:      "Unclosed block",
+			content:   "<think>Still thinking about",
+			reasoning: "Still thinking about",
+			answer:    "",
+		},
+		{
+			name:      "Closing tag only",
+			content:   "The user asks about France.</think>Paris.",
+			reasoning: "The user asks about France.",
+			answer:    "Paris.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := tt.model
+			if model == "" {
+				model = "sonar-reasoning"
+			}
+			reasoning, answer := SplitReasoning(model, tt.content)
+			if reasoning != tt.reasoning || answer != tt.answer {
+				t.Errorf("SplitReasoning() = %q, %q, expected %q, %q", reasoning, answer, tt.reasoning, tt.answer)
+			}
+		})
+	}
+}
+
+func TestParseResponseReasoning(t *testing.T) {
+	resp := &ChatCompletionResponse{
+		Model: "sonar-reasoning-pro",
+		Choices: []Choice{
+			{Message: Message{Role: "assistant", Content: "<think>Maybe [3] applies.</think>\nParis is the capital. [1]"}},
+		},
+		SearchResults: []SearchResult{{URL: "https://en.wikipedia.org/wiki/Paris"}},
+	}
+
+	parsed := ParseResponse(resp)
+	if parsed.Reasoning != "Maybe [3] applies." || parsed.Content != "Paris is the capital. [1]" {
+		t.Errorf("ParseResponse() = %q, %q, expected the reasoning apart from the content", parsed.Reasoning, parsed.Content)
+	}
+	if len(parsed.Citations) != 1 {
+		t.Errorf("ParseResponse() returned %d citations, expected 1 from the answer only", len(parsed.Citations))
+	}
+}
+
+func TestIsReasoningModel(t *testing.T) {
+	for model, expected := range map[string]bool{
+		"sonar-reasoning":     true,
+		"sonar-reasoning-pro": true,
+		"sonar-deep-research": true,
+		"sonar":               false,
+		"sonar-pro":           false,
+		"":                    false,
+	} {
+		if got := IsReasoningModel(model); got != expected {
+			t.Errorf("IsReasoningModel(%q) = %v, expected %v", model, got, expected)
+		}
+	}
+}
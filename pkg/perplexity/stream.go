@@ -0,0 +1,123 @@
+package perplexity
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// streamDone is the data of the server-sent event ending a stream
+const streamDone = "[DONE]"
+
+// CreateCompletionStream sends a chat completion request with streaming
+// enabled. onDelta is called with each piece of content as it arrives. The
+// returned response holds the whole content with the usage and search
+// results of the final chunk, as CreateCompletionWithRequest would return it.
+//
+// The client timeout applies to the wait for each chunk rather than to the
+// whole response, so long answers are not cut off while they are arriving.
+func (c *Client) CreateCompletionStream(req *ChatCompletionRequest, onDelta func(string)) (*ChatCompletionResponse, error) {
+	return c.CreateCompletionStreamContext(context.Background(), req, onDelta)
+}
+
+// CreateCompletionStreamContext is CreateCompletionStream with a context
+// that stops the response early. If ctx is cancelled once the response has
+// started, the content received so far is returned along with ctx's error.
+func (c *Client) CreateCompletionStreamContext(parent context.Context, req *ChatCompletionRequest, onDelta func(string)) (*ChatCompletionResponse, error) {
+	if c.config.APIKey == "" {
+		return nil, fmt.Errorf("API key is required. Set PPLX_API_KEY environment variable.")
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	// Cancel the request when no data arrives for a full timeout
+	idle := time.AfterFunc(c.config.Timeout, cancel)
+	defer idle.Stop()
+
+	streamReq := *req
+	streamReq.Stream = true
+	httpResp, err := c.send(ctx, &http.Client{Transport: c.httpClient.Transport}, &streamReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	resp := &ChatCompletionResponse{Object: "chat.completion"}
+	var content strings.Builder
+	var finishReason string
+
+	scanner := bufio.NewScanner(httpResp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		idle.Reset(c.config.Timeout)
+
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == streamDone {
+			break
+		}
+
+		var chunk ChatCompletionResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal stream chunk: %w", err)
+		}
+		mergeChunk(resp, &chunk)
+
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		choice := chunk.Choices[0]
+		if choice.FinishReason != "" {
+			finishReason = choice.FinishReason
+		}
+		if choice.Delta != nil && choice.Delta.Content != "" {
+			content.WriteString(choice.Delta.Content)
+			if onDelta != nil {
+				onDelta(choice.Delta.Content)
+			}
+		}
+	}
+	resp.Choices = []Choice{{
+		FinishReason: finishReason,
+		Message:      Message{Role: "assistant", Content: content.String()},
+	}}
+	if err := scanner.Err(); err != nil {
+		switch {
+		case parent.Err() != nil:
+			return resp, parent.Err()
+		case ctx.Err() != nil:
+			return nil, fmt.Errorf("stream timed out after %s without data", c.config.Timeout)
+		}
+		return nil, fmt.Errorf("failed to read stream: %w", err)
+	}
+	return resp, nil
+}
+
+// mergeChunk copies the response fields a stream chunk carries into resp.
+// Later chunks repeat or complete earlier ones, so the latest non-empty
+// value wins.
+func mergeChunk(resp, chunk *ChatCompletionResponse) {
+	if chunk.ID != "" {
+		resp.ID = chunk.ID
+	}
+	if chunk.Model != "" {
+		resp.Model = chunk.Model
+	}
+	if chunk.Created != 0 {
+		resp.Created = chunk.Created
+	}
+	if chunk.Usage.TotalTokens != 0 {
+		resp.Usage = chunk.Usage
+	}
+	if len(chunk.SearchResults) > 0 {
+		resp.SearchResults = chunk.SearchResults
+	}
+}
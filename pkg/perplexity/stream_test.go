@@ -0,0 +1,101 @@
+package perplexity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCreateCompletionStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !req.Stream {
+			t.Errorf("request stream = %v (%v), expected true", req.Stream, err)
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		chunks := []string{
+			`{"id":"r1","model":"sonar","choices":[{"delta":{"role":"assistant","content":"Paris is "}}]}`,
+			`{"id":"r1","choices":[{"delta":{"content":"the capital. [1]"}}],"search_results":[{"title":"France","url":"https://example.com"}]}`,
+			`{"id":"r1","choices":[{"delta":{"content":""},"finish_reason":"stop"}],"usage":{"prompt_tokens":5,"completion_tokens":7,"total_tokens":12}}`,
+		}
+		for _, chunk := range chunks {
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+			w.(http.Flusher).Flush()
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	client := NewClient("test-key")
+	client.SetEndpoint(server.URL)
+
+	var deltas []string
+	resp, err := client.CreateCompletionStream(&ChatCompletionRequest{Messages: []Message{{Role: "user", Content: "capital?"}}}, func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	if err != nil {
+		t.Fatalf("CreateCompletionStream() failed: %v", err)
+	}
+
+	if strings.Join(deltas, "|") != "Paris is |the capital. [1]" {
+		t.Errorf("deltas = %q, expected the two content pieces", deltas)
+	}
+	if len(resp.Choices) != 1 || resp.Choices[0].Message.Content != "Paris is the capital. [1]" || resp.Choices[0].FinishReason != "stop" {
+		t.Errorf("choices = %+v, expected the joined content", resp.Choices)
+	}
+	if resp.ID != "r1" || resp.Model != "sonar" || resp.Usage.TotalTokens != 12 || len(resp.SearchResults) != 1 {
+		t.Errorf("response = %+v, expected the metadata of all chunks", resp)
+	}
+
+	// The merged response parses like a regular one
+	parsed := ParseResponse(resp)
+	if len(parsed.Citations) != 1 {
+		t.Errorf("parsed citations = %v, expected 1", parsed.Citations)
+	}
+}
+
+func TestCreateCompletionStreamError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"bad model"}`, http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	client := NewClient("test-key")
+	client.SetEndpoint(server.URL)
+
+	_, err := client.CreateCompletionStream(&ChatCompletionRequest{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "status 400") {
+		t.Errorf("CreateCompletionStream() error = %v, expected the status", err)
+	}
+}
+
+func TestCreateCompletionStreamCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"choices":[{"delta":{"content":"Paris is "}}]}`+"\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	client := NewClient("test-key")
+	client.SetEndpoint(server.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	resp, err := client.CreateCompletionStreamContext(ctx, &ChatCompletionRequest{}, func(string) {
+		cancel()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("CreateCompletionStreamContext() error = %v, expected context.Canceled", err)
+	}
+	if resp == nil || resp.Choices[0].Message.Content != "Paris is " {
+		t.Errorf("response = %+v, expected the content received before cancelling", resp)
+	}
+}
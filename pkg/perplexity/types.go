@@ -26,11 +26,23 @@ type Usage struct {
 	ReasoningTokens   int    `json:"reasoning_tokens,omitempty"`
 }
 
+// Add adds the token counts of other to u, to total several requests
+func (u *Usage) Add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+	u.CitationTokens += other.CitationTokens
+	u.NumSearchQueries += other.NumSearchQueries
+	u.ReasoningTokens += other.ReasoningTokens
+}
+
 // Choice represents a completion choice from the API
 type Choice struct {
 	Index        int     `json:"index"`
 	FinishReason string  `json:"finish_reason"`
 	Message      Message `json:"message"`
+	// Delta is the content added by a chunk of a streamed response
+	Delta *Message `json:"delta,omitempty"`
 }
 
 // ChatCompletionRequest represents the request body for chat completions
@@ -41,10 +53,31 @@ type ChatCompletionRequest struct {
 	Temperature            float64   `json:"temperature,omitempty"`
 	TopP                   float64   `json:"top_p,omitempty"`
 	SearchMode             string    `json:"search_mode,omitempty"`
+	SearchDomainFilter     []string  `json:"search_domain_filter,omitempty"`
+	SearchRecencyFilter    string    `json:"search_recency_filter,omitempty"`
 	ReasoningEffort        string    `json:"reasoning_effort,omitempty"`
 	Stream                 bool      `json:"stream,omitempty"`
 	ReturnImages           bool      `json:"return_images,omitempty"`
 	ReturnRelatedQuestions bool      `json:"return_related_questions,omitempty"`
+	DisableSearch          bool      `json:"disable_search,omitempty"`
+	// WebSearchOptions is omitted when nil, leaving the API's defaults
+	WebSearchOptions *WebSearchOptions `json:"web_search_options,omitempty"`
+}
+
+// WebSearchOptions controls the web search done for a request
+type WebSearchOptions struct {
+	// SearchContextSize is how much search context is retrieved: low,
+	// medium or high
+	SearchContextSize string `json:"search_context_size,omitempty"`
+}
+
+// NewWebSearchOptions returns the search options for a search context
+// size, or nil if it is empty
+func NewWebSearchOptions(searchContextSize string) *WebSearchOptions {
+	if searchContextSize == "" {
+		return nil
+	}
+	return &WebSearchOptions{SearchContextSize: searchContextSize}
 }
 
 // ChatCompletionResponse represents the response from the API
@@ -87,4 +120,7 @@ type ParsedResponse struct {
 	Content       string
 	Citations     []Citation
 	SearchResults []SearchResult
+	// Reasoning is the thinking of a reasoning model, given before its
+	// answer in <think> blocks and removed from Content
+	Reasoning string
 }
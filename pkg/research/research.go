@@ -0,0 +1,138 @@
+// Package research assembles multi-step research: a topic is planned as
+// sub-questions, each is answered on its own, and the answers are combined
+// into one report with a section per sub-question and a single list of
+// references.
+package research
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"perplexity-cli/pkg/perplexity"
+)
+
+// listItem matches a numbered or bulleted list item, capturing its text
+var listItem = regexp.MustCompile(`^\s*(?:\d+[.)]|[-*•])\s+(.+)$`)
+
+// Step is a sub-question and the outcome of researching it
+type Step struct {
+	Question string
+	Answer   *perplexity.ParsedResponse
+	Err      error
+}
+
+// ParsePlan extracts the sub-questions from a planning response, which may
+// be a JSON array of strings, possibly in a code block, or a numbered or
+// bulleted list. Repeated questions are dropped, and at most max are
+// returned.
+func ParsePlan(text string, max int) []string {
+	var questions []string
+	if start, end := strings.Index(text, "["), strings.LastIndex(text, "]"); start >= 0 && end > start {
+		if json.Unmarshal([]byte(text[start:end+1]), &questions) != nil {
+			questions = nil
+		}
+	}
+	if len(questions) == 0 {
+		for _, line := range strings.Split(text, "\n") {
+			if m := listItem.FindStringSubmatch(line); m != nil {
+				questions = append(questions, m[1])
+			}
+		}
+	}
+
+	var plan []string
+	seen := make(map[string]bool)
+	for _, q := range questions {
+		q = strings.TrimSpace(strings.Trim(strings.TrimSpace(q), "*_`\""))
+		key := strings.ToLower(q)
+		if q == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		plan = append(plan, q)
+		if len(plan) == max {
+			break
+		}
+	}
+	return plan
+}
+
+// MergeAnswers renumbers the citations of the answered steps into one list
+// of sources. It returns each step's answer without its references list,
+// empty for failed steps, and the sources.
+func MergeAnswers(steps []Step) ([]string, []perplexity.SearchResult) {
+	var answered []*perplexity.ParsedResponse
+	for _, step := range steps {
+		if step.Err == nil && step.Answer != nil {
+			answered = append(answered, step.Answer)
+		}
+	}
+	merged, sources := perplexity.MergeSources(answered)
+
+	contents := make([]string, len(steps))
+	next := 0
+	for i, step := range steps {
+		if step.Err == nil && step.Answer != nil {
+			contents[i] = strings.TrimSpace(perplexity.StripReferences(merged[next]))
+			next++
+		}
+	}
+	return contents, sources
+}
+
+// Findings formats the answers of the steps, numbered by sub-question, as
+// the input for writing the summary
+func Findings(steps []Step, contents []string) string {
+	var b strings.Builder
+	for i, step := range steps {
+		if contents[i] == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "--- Sub-question %d: %s ---\n%s\n\n", i+1, step.Question, contents[i])
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// Report formats the final report: the topic as its title, the summary,
+// then a section per sub-question with its answer, or the reason it has
+// none
+func Report(topic, summary string, steps []Step, contents []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n## Summary\n\n%s\n", topic, strings.TrimSpace(summary))
+	for i, step := range steps {
+		fmt.Fprintf(&b, "\n## %d. %s\n\n", i+1, step.Question)
+		switch {
+		case step.Err != nil:
+			fmt.Fprintf(&b, "_This sub-question could not be answered: %v_\n", step.Err)
+		case contents[i] == "":
+			b.WriteString("_No answer._\n")
+		default:
+			b.WriteString(demoteHeadings(contents[i]) + "\n")
+		}
+	}
+	return b.String()
+}
+
+// demoteHeadings turns the headings of an answer into level 3 or lower so
+// they nest under its section, leaving code blocks alone
+func demoteHeadings(text string) string {
+	lines := strings.Split(text, "\n")
+	inCode := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inCode = !inCode
+			continue
+		}
+		if inCode || !strings.HasPrefix(line, "#") {
+			continue
+		}
+		level := len(line) - len(strings.TrimLeft(line, "#"))
+		if level <= 6 && strings.HasPrefix(line[level:], " ") {
+			lines[i] = strings.Repeat("#", min(level+2, 6)) + line[level:]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
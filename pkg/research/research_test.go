@@ -0,0 +1,104 @@
+package research
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"perplexity-cli/pkg/perplexity"
+)
+
+func TestParsePlan(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		max      int
+		expected []string
+	}{
+		{
+			name:     "json",
+			text:     `["What is X?", "How is X used?"]`,
+			max:      5,
+			expected: []string{"What is X?", "How is X used?"},
+		},
+		{
+			name:     "json in a code block",
+			text:     "Here is the plan:\n```json\n[\"What is X?\", \"what is x?\", \"Who maintains X?\"]\n```",
+			max:      5,
+			expected: []string{"What is X?", "Who maintains X?"},
+		},
+		{
+			name:     "numbered list",
+			text:     "Sub-questions:\n1. **What is X?**\n2) How is X used?\n\n3. Who maintains X?",
+			max:      2,
+			expected: []string{"What is X?", "How is X used?"},
+		},
+		{
+			name:     "bullets",
+			text:     "- What is X?\n* How is X used?\nSome closing remark.",
+			max:      5,
+			expected: []string{"What is X?", "How is X used?"},
+		},
+		{
+			name:     "nothing",
+			text:     "I cannot help with that.",
+			max:      5,
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParsePlan(tt.text, tt.max); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("ParsePlan() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMergeAnswersAndReport(t *testing.T) {
+	steps := []Step{
+		{
+			Question: "What is X?",
+			Answer: &perplexity.ParsedResponse{
+				Content:       "## Definition\nX is a tool [1][2].\n\n```\n# not a heading\n```",
+				SearchResults: []perplexity.SearchResult{{URL: "https://x.dev"}, {URL: "https://wiki.org/x"}},
+			},
+		},
+		{Question: "Who uses X?", Err: errors.New("status 500")},
+		{
+			Question: "How is X used?",
+			Answer: &perplexity.ParsedResponse{
+				Content:       "Mostly in CI [1] and locally [2].",
+				SearchResults: []perplexity.SearchResult{{URL: "https://blog.dev/ci"}, {URL: "https://x.dev"}},
+			},
+		},
+	}
+
+	contents, sources := MergeAnswers(steps)
+	if len(sources) != 3 {
+		t.Fatalf("MergeAnswers() = %d sources, expected 3 after removing the repeated URL", len(sources))
+	}
+	if contents[1] != "" || contents[2] != "Mostly in CI [3] and locally [1]." {
+		t.Errorf("MergeAnswers() contents = %q", contents)
+	}
+
+	findings := Findings(steps, contents)
+	if strings.Contains(findings, "Who uses X?") || !strings.Contains(findings, "Sub-question 3: How is X used?") {
+		t.Errorf("Findings() = %q, expected the answered sub-questions only", findings)
+	}
+
+	report := Report("X", "X is a tool used in CI [1][3].", steps, contents)
+	for _, expected := range []string{
+		"# X\n\n## Summary\n\nX is a tool used in CI [1][3].\n",
+		"## 1. What is X?\n\n#### Definition\n",
+		"# not a heading",
+		"## 2. Who uses X?\n\n_This sub-question could not be answered: status 500_",
+		"## 3. How is X used?\n\nMostly in CI [3]",
+	} {
+		if !strings.Contains(report, expected) {
+			t.Errorf("Report() is missing %q:\n%s", expected, report)
+		}
+	}
+}
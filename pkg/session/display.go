@@ -2,14 +2,31 @@ package session
 
 import (
 	"fmt"
+	"strings"
 
 	"perplexity-cli/pkg/config"
 	"perplexity-cli/pkg/perplexity"
 	"perplexity-cli/pkg/ui"
 )
 
+// compactedMarker labels messages covered by the context summary
+const compactedMarker = "[compacted]"
+
+// DisplayOptions controls what DisplaySessionWithOptions prints
+type DisplayOptions struct {
+	// Alternates prints the earlier versions of regenerated and edited
+	// messages after each message; otherwise only their number is shown
+	Alternates bool
+}
+
 // DisplaySession displays a full session conversation with formatting
 func DisplaySession(s *Session) error {
+	return DisplaySessionWithOptions(s, DisplayOptions{})
+}
+
+// DisplaySessionWithOptions displays a full session conversation with
+// formatting
+func DisplaySessionWithOptions(s *Session, opts DisplayOptions) error {
 	cfg, err := config.Load()
 	if err != nil {
 		cfg = config.DefaultConfig()
@@ -19,33 +36,79 @@ func DisplaySession(s *Session) error {
 	fmt.Println()
 	ui.PrintSeparator(ui.HeaderColor)
 	fmt.Printf("Session: [%s] %s\n", s.ShortID, FormatSessionTime(s.Metadata.CreatedAt))
+	if s.Metadata.Title != "" {
+		fmt.Printf("Title: %s\n", s.Metadata.Title)
+	}
+	if s.Metadata.Name != "" {
+		fmt.Printf("Name: %s\n", s.Metadata.Name)
+	}
 	fmt.Printf("Model: %s\n", s.Metadata.Model)
 	fmt.Printf("Messages: %d\n", len(s.Messages))
+	if s.IsFork() {
+		fmt.Printf("Forked from: %s at message %d\n", s.Metadata.ParentID, s.Metadata.ForkPoint)
+	}
+	if len(s.Metadata.Compared) > 0 {
+		fmt.Printf("Compared with: %s\n", strings.Join(s.Metadata.Compared, ", "))
+	}
+	if len(s.Metadata.Tags) > 0 {
+		fmt.Printf("Tags: %s\n", strings.Join(s.Metadata.Tags, ", "))
+	}
+	if s.Metadata.Pinned {
+		fmt.Println("Pinned: yes")
+	}
+	if len(s.Metadata.Attachments) > 0 {
+		fmt.Printf("Attachments: %s\n", strings.Join(s.Metadata.Attachments, ", "))
+	}
+	if s.Metadata.Notes != "" {
+		fmt.Printf("Notes: %s\n", s.Metadata.Notes)
+	}
+	if s.Metadata.Summary != "" {
+		fmt.Printf("Summary: %s\n", s.Metadata.Summary)
+	}
+	if s.Metadata.ContextSummary != "" {
+		fmt.Printf("Compacted: first %d messages are sent as a summary (marked %s)\n", s.Metadata.ContextSummaryMessages, compactedMarker)
+	}
 	ui.PrintSeparator(ui.HeaderColor)
 	fmt.Println()
 
 	// Display each message
 	for i, msg := range s.Messages {
+		marker := ""
+		if s.IsCompacted(i) {
+			marker = ui.Yellow(compactedMarker) + " "
+		}
+
 		if msg.Role == "user" {
 			// Print separator before user message (except first)
 			if i > 0 {
 				ui.PrintSeparator(ui.Cyan)
 			}
-			fmt.Print("You: ")
+			fmt.Print(marker + "You: ")
 			fmt.Println(msg.Content)
+			displayAlternates(msg, opts)
 		} else if msg.Role == "assistant" {
 			fmt.Println()
 			ui.PrintSeparator(ui.Magenta)
-			fmt.Print("PPLX: ")
+			// Reasoning is shown with show_reasoning; replies saved before it
+			// was kept apart may still hold it inline
+			reasoning, content := perplexity.SplitReasoning(s.Metadata.Model, msg.Content)
+			if msg.Reasoning != "" {
+				reasoning = msg.Reasoning
+			}
+			if cfg.ShowReasoning {
+				ui.PrintReasoning(reasoning)
+			}
+			fmt.Print(marker + "PPLX: ")
 
 			// Check if content has citations and format accordingly
-			formatted := formatMessageWithCitations(msg.Content)
+			formatted := formatMessageWithCitations(content)
 			rendered, err := ui.RenderMarkdown(formatted, cfg)
 			if err != nil {
 				fmt.Println(formatted)
 			} else {
 				fmt.Println(rendered)
 			}
+			displayAlternates(msg, opts)
 			fmt.Println()
 		}
 	}
@@ -53,6 +116,45 @@ func DisplaySession(s *Session) error {
 	return nil
 }
 
+// displayAlternates prints the earlier versions of a message, or their
+// number unless opts asks for them
+func displayAlternates(msg SessionMessage, opts DisplayOptions) {
+	n := len(msg.Alternates)
+	if n == 0 {
+		return
+	}
+	if !opts.Alternates {
+		fmt.Println(ui.Yellow(fmt.Sprintf("(%d earlier %s; show with --alternates)", n, pluralize(n, "version", "versions"))))
+		return
+	}
+
+	for i, alt := range msg.Alternates {
+		fmt.Println(ui.Yellow(fmt.Sprintf("  Alternate %d of %d (%s):", i+1, n, FormatSessionTime(alt.Timestamp))))
+		fmt.Println(indent(alt.Content, "    "))
+		if alt.Reply != "" {
+			fmt.Println(ui.Yellow("    Response:"))
+			fmt.Println(indent(alt.Reply, "    "))
+		}
+		for _, reply := range alt.ReplyAlternates {
+			fmt.Println(ui.Yellow(fmt.Sprintf("    Earlier response (%s):", FormatSessionTime(reply.Timestamp))))
+			fmt.Println(indent(reply.Content, "    "))
+		}
+	}
+}
+
+// pluralize returns singular for 1 and plural otherwise
+func pluralize(n int, singular, plural string) string {
+	if n == 1 {
+		return singular
+	}
+	return plural
+}
+
+// indent prefixes every line of text
+func indent(text, prefix string) string {
+	return prefix + strings.ReplaceAll(strings.TrimRight(text, "\n"), "\n", "\n"+prefix)
+}
+
 // formatMessageWithCitations checks for citations and formats them
 func formatMessageWithCitations(content string) string {
 	// Extract citations from content
@@ -75,6 +177,42 @@ func DisplaySessionSummary(s *Session) {
 	fmt.Printf("[%s] %s - %s (%d messages)\n",
 		s.ShortID,
 		FormatSessionTime(s.Metadata.CreatedAt),
-		TruncateQuery(s.Metadata.InitialQuery, 50),
+		TruncateQuery(s.ToInfo().DisplayTitle(), 50),
 		len(s.Messages))
 }
+
+// DisplayTree prints a fork tree, marking the session with highlightID
+func DisplayTree(root *TreeNode, highlightID string) {
+	printTreeNode(root, "", "", highlightID)
+}
+
+func printTreeNode(node *TreeNode, prefix, childPrefix, highlightID string) {
+	info := node.Info
+
+	marker := ""
+	if info.ID == highlightID {
+		marker = ui.Cyan(" *")
+	}
+
+	forkPoint := ""
+	if info.ParentID != "" {
+		forkPoint = fmt.Sprintf("@%d ", info.ForkPoint)
+	}
+
+	fmt.Printf("%s[%s]%s %s%s - %s (%d messages)\n",
+		prefix,
+		info.ShortID,
+		marker,
+		forkPoint,
+		FormatSessionTime(info.CreatedAt),
+		TruncateQuery(info.DisplayTitle(), 40),
+		info.MessageCount)
+
+	for i, child := range node.Children {
+		if i == len(node.Children)-1 {
+			printTreeNode(child, childPrefix+"└── ", childPrefix+"    ", highlightID)
+		} else {
+			printTreeNode(child, childPrefix+"├── ", childPrefix+"│   ", highlightID)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package session
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// PassphraseEnv names the environment variable holding the passphrase
+// session encryption keys are derived from
+const PassphraseEnv = "PPLX_SESSION_PASSPHRASE"
+
+// encryptedMagic prefixes encrypted session data. It is followed by the
+// AES-GCM nonce and the sealed JSON document.
+var encryptedMagic = []byte("PPLXENC1")
+
+// pbkdf2Iterations is the PBKDF2-SHA256 work factor for passphrase keys
+const pbkdf2Iterations = 600000
+
+// ErrNoSessionKey is returned when encrypted sessions are read without a
+// passphrase or key file to decrypt them
+var ErrNoSessionKey = errors.New("no session encryption key")
+
+// ErrDecrypt is returned when encrypted session data cannot be decrypted
+// with the available key
+var ErrDecrypt = errors.New("failed to decrypt session (wrong passphrase or key?)")
+
+// Encryption encrypts stored session data with AES-256-GCM. Encrypted data is
+// always decrypted on load, so stores can hold a mix of encrypted and
+// plaintext sessions; Enabled controls whether sessions are encrypted when
+// they are saved. The key is resolved on first use.
+type Encryption struct {
+	// Enabled encrypts sessions when they are saved
+	Enabled bool
+
+	key  func(create bool) ([]byte, error)
+	mu   sync.Mutex
+	aead cipher.AEAD
+}
+
+// NewEncryption returns an Encryption using DefaultKey
+func NewEncryption(enabled bool) *Encryption {
+	return &Encryption{Enabled: enabled, key: DefaultKey}
+}
+
+// NewEncryptionWithKey returns an Encryption using a fixed 32-byte key
+func NewEncryptionWithKey(enabled bool, key []byte) *Encryption {
+	return &Encryption{Enabled: enabled, key: func(bool) ([]byte, error) { return key, nil }}
+}
+
+// IsEncrypted reports whether stored session data is encrypted
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedMagic)
+}
+
+// seal encrypts data if encryption is enabled, creating a key if needed
+func (e *Encryption) seal(data []byte) ([]byte, error) {
+	if e == nil || !e.Enabled {
+		return data, nil
+	}
+
+	aead, err := e.cipher(true)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	out := append(append([]byte{}, encryptedMagic...), nonce...)
+	return aead.Seal(out, nonce, data, encryptedMagic), nil
+}
+
+// open decrypts data if it is encrypted and returns plaintext data unchanged
+func (e *Encryption) open(data []byte) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return data, nil
+	}
+	if e == nil {
+		return nil, ErrNoSessionKey
+	}
+
+	aead, err := e.cipher(false)
+	if err != nil {
+		return nil, err
+	}
+
+	body := data[len(encryptedMagic):]
+	if len(body) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+
+	plain, err := aead.Open(nil, body[:aead.NonceSize()], body[aead.NonceSize():], encryptedMagic)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plain, nil
+}
+
+// convert rewrites stored data in the form sessions are saved in: plaintext
+// data is encrypted if encryption is enabled and encrypted data decrypted if
+// it is not. Data already in that form is returned unchanged.
+func (e *Encryption) convert(data []byte) ([]byte, error) {
+	enabled := e != nil && e.Enabled
+	switch {
+	case enabled && !IsEncrypted(data):
+		return e.seal(data)
+	case !enabled && IsEncrypted(data):
+		return e.open(data)
+	default:
+		return data, nil
+	}
+}
+
+// cipher returns the AEAD for the configured key, resolving it on first use
+func (e *Encryption) cipher(create bool) (cipher.AEAD, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.aead != nil {
+		return e.aead, nil
+	}
+
+	key, err := e.key(create)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session key: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session key: %w", err)
+	}
+
+	e.aead = aead
+	return aead, nil
+}
+
+// DefaultKey returns the session encryption key. With PPLX_SESSION_PASSPHRASE
+// set, the key is derived from the passphrase and a salt kept in
+// ~/.pplx/session.salt; otherwise it is read from ~/.pplx/session.key. Missing
+// salt and key files are generated when create is true.
+func DefaultKey(create bool) ([]byte, error) {
+	if passphrase := os.Getenv(PassphraseEnv); passphrase != "" {
+		salt, err := readOrCreateSecret(GetSessionSaltPath(), 16, create)
+		if err != nil {
+			return nil, err
+		}
+		return pbkdf2.Key(sha256.New, passphrase, salt, pbkdf2Iterations, 32)
+	}
+
+	return readOrCreateSecret(GetSessionKeyPath(), 32, create)
+}
+
+// readOrCreateSecret reads a file of random bytes, generating it with mode
+// 0600 if it does not exist and create is true. A file of the wrong size,
+// including an empty one, is an error rather than a secret.
+func readOrCreateSecret(path string, size int, create bool) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if len(data) != size {
+			return nil, fmt.Errorf("%s is corrupt: expected %d bytes, found %d", path, size, len(data))
+		}
+		return data, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if !create {
+		return nil, fmt.Errorf("%w: set %s or restore %s", ErrNoSessionKey, PassphraseEnv, path)
+	}
+
+	data = make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		return nil, fmt.Errorf("failed to generate %s: %w", path, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create key directory: %w", err)
+	}
+
+	err = createSecretFile(path, data)
+	if errors.Is(err, os.ErrExist) {
+		// Another process created it first
+		return readOrCreateSecret(path, size, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	Debugf("Generated session key material at %s", path)
+	return data, nil
+}
+
+// createSecretFile writes data to a temporary file, syncs it and links it
+// into place, so other processes see either no file at path or the complete
+// secret, never a partly written one. It fails with os.ErrExist if path
+// already exists.
+func createSecretFile(path string, data []byte) error {
+	// CreateTemp creates the file with mode 0600
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	// Unlike rename, link never replaces a secret another process created
+	if err := os.Link(tmp.Name(), path); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return err
+		}
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	return nil
+}
@@ -1,239 +1,386 @@
 package session
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"reflect"
+	"slices"
 	"sort"
-	"strings"
 	"time"
+
+	"perplexity-cli/pkg/config"
 )
 
-// Manager handles session CRUD operations
+// Manager handles session CRUD operations on top of a Store
 type Manager struct {
-	sessionsDir string
+	store Store
 }
 
-// NewManager creates a new session manager
+// NewManager creates a new session manager using the store selected by the
+// session_store configuration setting, encrypting sessions if
+// encrypt_sessions is set
 func NewManager() (*Manager, error) {
-	sessionsDir := GetSessionsDir()
-	if err := os.MkdirAll(sessionsDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create sessions directory: %w", err)
+	cfg, err := config.Load()
+	if err != nil {
+		cfg = config.DefaultConfig()
+	}
+
+	store, err := OpenStore(cfg.SessionStore, NewEncryption(cfg.EncryptSessions))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open session store: %w", err)
 	}
-	return &Manager{sessionsDir: sessionsDir}, nil
+	return &Manager{store: store}, nil
 }
 
 // NewManagerWithDir creates a manager with a custom directory (for testing)
 func NewManagerWithDir(dir string) *Manager {
-	return &Manager{sessionsDir: dir}
+	return &Manager{store: &JSONStore{dir: dir}}
+}
+
+// NewManagerWithStore creates a manager backed by the given store
+func NewManagerWithStore(store Store) *Manager {
+	return &Manager{store: store}
+}
+
+// Store returns the store backing the manager
+func (m *Manager) Store() Store {
+	return m.store
 }
 
-// Save saves a session to disk atomically (write to temp then rename)
+// Close releases the resources held by the underlying store
+func (m *Manager) Close() error {
+	return m.store.Close()
+}
+
+// ErrSessionModified is returned by Save when the stored session was written
+// by someone else since the session was loaded
+var ErrSessionModified = errors.New("session modified elsewhere")
+
+// Lock takes an exclusive advisory lock on the session with the given ID,
+// serialising load-modify-save cycles across processes. The lock is released
+// by calling the returned function.
+func (m *Manager) Lock(id string) (func(), error) {
+	return m.store.Lock(id)
+}
+
+// ErrIDTaken is returned when a new session's ID is already used by a stored
+// session, e.g. one created in the same millisecond by another process
+var ErrIDTaken = errors.New("session ID already in use")
+
+// maxIDAttempts caps how often a new session is given a fresh ID on save
+const maxIDAttempts = 5
+
+// namesLockID is the lock held while a session name is checked and the
+// session saved, so two sessions cannot take the same name at once. Session
+// IDs are timestamps, so it never clashes with a session's lock.
+const namesLockID = "names"
+
+// Save saves a session. It fails with ErrSessionModified if the stored
+// session has a different revision than the session being saved, and with
+// ErrNameTaken if the session was given a name another session has. A new
+// session whose ID is already taken is given a unique ID and saved.
 func (m *Manager) Save(session *Session) error {
-	filename := filepath.Join(m.sessionsDir, session.ID+".json")
+	for attempt := 1; ; attempt++ {
+		err := m.lockAndSave(session)
+		if !errors.Is(err, ErrIDTaken) || attempt == maxIDAttempts {
+			return err
+		}
 
-	// Ensure directory exists
-	if err := os.MkdirAll(m.sessionsDir, 0755); err != nil {
-		return fmt.Errorf("failed to create sessions directory: %w", err)
+		Debugf("Session ID %s is taken, retrying with a new ID", session.ID)
+		session.reassignID()
 	}
+}
 
-	// Marshal session to JSON
-	data, err := json.MarshalIndent(session, "", "  ")
+// lockAndSave saves a session while holding its lock
+func (m *Manager) lockAndSave(session *Session) error {
+	unlock, err := m.Lock(session.ID)
 	if err != nil {
-		return fmt.Errorf("failed to marshal session: %w", err)
+		return err
 	}
+	defer unlock()
+
+	return m.saveLocked(session)
+}
 
-	// Write to temporary file
-	tempFile := filename + ".tmp"
-	if err := os.WriteFile(tempFile, data, 0644); err != nil {
-		return fmt.Errorf("failed to write temp file: %w", err)
+// saveLocked performs the revision check and write; the caller must hold the
+// session lock
+func (m *Manager) saveLocked(session *Session) error {
+	// Refuse to overwrite changes made since the session was loaded, and
+	// sessions written by a newer version of pplx
+	stored, err := m.store.Load(session.ID)
+	switch {
+	case session.unsaved && (err == nil || errors.Is(err, ErrUnsupportedSchema)):
+		return fmt.Errorf("%w: %s", ErrIDTaken, session.ID)
+	case err == nil && stored.Revision != session.Revision:
+		return fmt.Errorf("%w: %s is at revision %d, expected %d", ErrSessionModified, session.ID, stored.Revision, session.Revision)
+	case errors.Is(err, ErrUnsupportedSchema):
+		return err
 	}
 
-	// Atomic rename
-	if err := os.Rename(tempFile, filename); err != nil {
-		os.Remove(tempFile) // Clean up temp file
-		return fmt.Errorf("failed to rename temp file: %w", err)
+	// A new or changed name is checked under the names lock, held until the
+	// session is written, so concurrent saves cannot both take it
+	if name := session.Metadata.Name; name != "" && (err != nil || stored.Metadata.Name != name) {
+		unlock, err := m.store.Lock(namesLockID)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		if err := m.CheckName(name, session.ID); err != nil {
+			return err
+		}
 	}
 
-	Debugf("Saved session: %s", filename)
-	return nil
-}
+	session.SchemaVersion = CurrentSchemaVersion
+	session.Revision++
 
-// Load loads a session from disk by ID
-func (m *Manager) Load(id string) (*Session, error) {
-	filename := filepath.Join(m.sessionsDir, id+".json")
-	return m.LoadFromFile(filename)
+	if err := m.store.Save(session); err != nil {
+		session.Revision--
+		return err
+	}
+
+	session.storedVersion = CurrentSchemaVersion
+	session.unsaved = false
+	session.markSaved()
+	return nil
 }
 
-// LoadByShortID loads a session by its short ID
-func (m *Manager) LoadByShortID(shortID string) (*Session, error) {
-	entries, err := os.ReadDir(m.sessionsDir)
+// Modify loads a session, applies fn and saves it while holding the session
+// lock, so concurrent modifications from other processes are not lost
+func (m *Manager) Modify(id string, fn func(*Session) error) (*Session, error) {
+	unlock, err := m.Lock(id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read sessions directory: %w", err)
+		return nil, err
 	}
+	defer unlock()
 
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-
-		filename := entry.Name()
-		if !IsValidSessionFile(filename) {
-			continue
-		}
+	session, err := m.store.Load(id)
+	if err != nil {
+		return nil, err
+	}
 
-		filepath := filepath.Join(m.sessionsDir, filename)
-		session, err := m.LoadFromFile(filepath)
-		if err != nil {
-			continue
+	if session.storedVersion < CurrentSchemaVersion {
+		if err := m.store.Backup(session.ID, session.storedVersion); err != nil {
+			return nil, err
 		}
+	}
 
-		if session.ShortID == shortID {
-			return session, nil
-		}
+	if err := fn(session); err != nil {
+		return nil, err
 	}
 
-	return nil, fmt.Errorf("session with short ID %s not found", shortID)
+	if err := m.saveLocked(session); err != nil {
+		return nil, err
+	}
+	return session, nil
 }
 
-// LoadFromFile loads a session from a specific file path
-func (m *Manager) LoadFromFile(filename string) (*Session, error) {
-	data, err := os.ReadFile(filename)
+// Convert rewrites a session and its backups in the form the store saves
+// sessions in, for example encrypted after encryption was turned on. Unlike
+// Modify it keeps no backup of a session with an older schema before
+// migrating it, since the backup would be a copy in the form being replaced.
+func (m *Manager) Convert(id string) error {
+	unlock, err := m.Lock(id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read session file: %w", err)
+		return err
 	}
+	defer unlock()
 
-	var session Session
-	if err := json.Unmarshal(data, &session); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal session: %w", err)
+	session, err := m.store.Load(id)
+	if err != nil {
+		return err
 	}
 
-	// Handle old sessions without ShortID
-	if session.ShortID == "" {
-		// Generate ShortID from the session's creation time
-		session.ShortID = GenerateShortID(session.Metadata.CreatedAt)
+	if err := m.saveLocked(session); err != nil {
+		return err
+	}
+	return m.store.RewriteBackups(id)
+}
 
-		// Save the session with the new ShortID
-		if err := m.Save(&session); err != nil {
-			// Log warning but continue - session will work without saving
+// Rebase reloads a session that failed to save with ErrSessionModified and
+// re-applies local's changes since it was loaded or saved, so neither
+// writer's are lost. base is the number of leading messages local left
+// unchanged: its messages after those replace the ones it had then, which
+// it may have removed or rewritten, and messages the other writer added are
+// kept before them. Metadata fields local changed overwrite the reloaded
+// ones. The merged session is saved and returned.
+func (m *Manager) Rebase(local *Session, base int) (*Session, error) {
+	base = min(base, len(local.Messages))
+	pending := slices.Clone(local.Messages[base:])
+	replaced := max(base, local.savedMessages)
+	metadata, saved := local.Metadata.clone(), local.savedMetadata
+
+	return m.Modify(local.ID, func(latest *Session) error {
+		kept := latest.Messages[:min(base, len(latest.Messages))]
+		added := latest.Messages[min(replaced, len(latest.Messages)):]
+		latest.Messages = slices.Concat(kept, added, pending)
+
+		mergeMetadata(&latest.Metadata, metadata, saved)
+		latest.Metadata.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+// mergeMetadata sets the fields of latest that local changed from base
+func mergeMetadata(latest *SessionMetadata, local, base SessionMetadata) {
+	target := reflect.ValueOf(latest).Elem()
+	localValue, baseValue := reflect.ValueOf(local), reflect.ValueOf(base)
+	for i := range target.NumField() {
+		if !reflect.DeepEqual(localValue.Field(i).Interface(), baseValue.Field(i).Interface()) {
+			target.Field(i).Set(localValue.Field(i))
+		}
+	}
+}
+
+// Load loads a session by ID. Sessions stored with an older schema are
+// migrated and rewritten, keeping a backup of the original.
+func (m *Manager) Load(id string) (*Session, error) {
+	session, err := m.store.Load(id)
+	if err != nil {
+		return nil, err
+	}
+	session.markSaved()
+
+	if session.needsMigration() {
+		if err := m.persistMigration(session); err != nil {
+			// Log warning but continue - session works without saving
 			Debugf("Failed to save migrated session %s: %v", session.ID, err)
 		} else {
-			Debugf("Migrated session %s with ShortID %s", session.ID, session.ShortID)
+			Debugf("Migrated session %s to schema version %d", session.ID, CurrentSchemaVersion)
 		}
 	}
 
-	return &session, nil
+	return session, nil
 }
 
-// Delete deletes a session by ID
-func (m *Manager) Delete(id string) error {
-	filename := GenerateSessionFilename(id)
-	if err := os.Remove(filename); err != nil {
-		return fmt.Errorf("failed to delete session: %w", err)
+// persistMigration saves a session that was migrated on load, backing up the
+// stored original first if its schema changed
+func (m *Manager) persistMigration(session *Session) error {
+	unlock, err := m.Lock(session.ID)
+	if err != nil {
+		return err
 	}
-	return nil
-}
+	defer unlock()
 
-// List returns a list of all sessions sorted by time (newest first)
-func (m *Manager) List() ([]SessionInfo, error) {
-	entries, err := os.ReadDir(m.sessionsDir)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read sessions directory: %w", err)
+	// Sessions missing a short ID despite a current schema are repaired
+	// in place; there is nothing worth backing up
+	if session.ShortID == "" {
+		session.ShortID = GenerateShortID(session.Metadata.CreatedAt)
 	}
 
-	var sessions []SessionInfo
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
+	if session.storedVersion < CurrentSchemaVersion {
+		if err := m.store.Backup(session.ID, session.storedVersion); err != nil {
+			return err
 		}
+	}
 
-		filename := entry.Name()
-		if !IsValidSessionFile(filename) {
-			continue
-		}
+	return m.saveLocked(session)
+}
 
-		// Load session to get info
-		filepath := filepath.Join(m.sessionsDir, filename)
-		session, err := m.LoadFromFile(filepath)
-		if err != nil {
-			Debugf("Failed to load session %s: %v", filename, err)
-			continue
+// LoadByShortID loads a session by its short ID
+func (m *Manager) LoadByShortID(shortID string) (*Session, error) {
+	sessions, err := m.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, info := range sessions {
+		if info.ShortID == shortID {
+			return m.Load(info.ID)
 		}
+	}
+
+	return nil, fmt.Errorf("session with short ID %s not found", shortID)
+}
 
-		sessions = append(sessions, session.ToInfo())
+// Find loads the session ref refers to; see Resolve for the accepted forms
+func (m *Manager) Find(ref string) (*Session, error) {
+	id, err := m.Resolve(ref)
+	if err != nil {
+		return nil, err
 	}
+	return m.Load(id)
+}
 
-	// Sort by created time, newest first
-	sort.Slice(sessions, func(i, j int) bool {
-		return sessions[i].CreatedAt.After(sessions[j].CreatedAt)
-	})
+// Delete deletes a session by ID
+func (m *Manager) Delete(id string) error {
+	return m.store.Delete(id)
+}
 
+// List returns a list of all sessions sorted by time (newest first)
+func (m *Manager) List() ([]SessionInfo, error) {
+	sessions, err := m.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	sortNewestFirst(sessions)
 	return sessions, nil
 }
 
-// ListRecent returns the n most recent sessions
+// ListRecent returns the n most recent sessions, pinned sessions first
 func (m *Manager) ListRecent(n int) ([]SessionInfo, error) {
+	return m.ListRecentTagged(n, nil)
+}
+
+// ListRecentTagged returns the n most recent sessions carrying all of the
+// given tags, pinned sessions first
+func (m *Manager) ListRecentTagged(n int, tags []string) ([]SessionInfo, error) {
 	sessions, err := m.List()
 	if err != nil {
 		return nil, err
 	}
 
+	sessions = FilterByTags(sessions, tags)
+	SortPinnedFirst(sessions)
+
 	if len(sessions) > n {
 		return sessions[:n], nil
 	}
 	return sessions, nil
 }
 
-// Search searches for sessions containing the query string
+// Search searches for sessions matching the query string. Short IDs and tags
+// match exactly; the initial query, title, name, notes, summary and messages
+// match case-insensitive substrings.
 func (m *Manager) Search(query string) ([]SessionInfo, error) {
-	queryLower := strings.ToLower(query)
-	sessions, err := m.List()
+	results, err := m.store.Search(query)
 	if err != nil {
 		return nil, err
 	}
 
-	var results []SessionInfo
-	for _, info := range sessions {
-		// Load full session to search content
-		session, err := m.Load(info.ID)
-		if err != nil {
-			continue
-		}
-
-		found := false
-
-		// Search by short ID (exact match, case-insensitive)
-		if strings.EqualFold(session.ShortID, query) {
-			found = true
-		}
+	sortNewestFirst(results)
+	return results, nil
+}
 
-		// Search in initial query
-		if !found && strings.Contains(strings.ToLower(session.Metadata.InitialQuery), queryLower) {
-			found = true
-		}
+// sortNewestFirst sorts sessions by created time, newest first
+func sortNewestFirst(sessions []SessionInfo) {
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.After(sessions[j].CreatedAt)
+	})
+}
 
-		// Search in all messages
-		if !found {
-			for _, msg := range session.Messages {
-				if strings.Contains(strings.ToLower(msg.Content), queryLower) {
-					found = true
-					break
-				}
-			}
-		}
+// FilterByTags returns the sessions carrying all of the given tags
+func FilterByTags(sessions []SessionInfo, tags []string) []SessionInfo {
+	if len(tags) == 0 {
+		return sessions
+	}
 
-		if found {
-			results = append(results, info)
+	var filtered []SessionInfo
+	for _, info := range sessions {
+		if info.HasTags(tags) {
+			filtered = append(filtered, info)
 		}
 	}
-
-	return results, nil
+	return filtered
 }
 
-// GetSessionDir returns the sessions directory path
-func (m *Manager) GetSessionDir() string {
-	return m.sessionsDir
+// SortPinnedFirst moves pinned sessions to the front, keeping the existing
+// order within pinned and unpinned sessions
+func SortPinnedFirst(sessions []SessionInfo) {
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].Pinned && !sessions[j].Pinned
+	})
 }
 
 // CreateAndSave creates a new session and saves it
@@ -247,25 +394,20 @@ func (m *Manager) CreateAndSave(model, initialQuery string) (*Session, error) {
 
 // Update appends a message to a session and saves it
 func (m *Manager) Update(id, role, content string) error {
-	session, err := m.Load(id)
+	_, err := m.Modify(id, func(session *Session) error {
+		session.AddMessage(role, content)
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to load session for update: %w", err)
+		return fmt.Errorf("failed to update session: %w", err)
 	}
-
-	session.AddMessage(role, content)
-	return m.Save(session)
-}
-
-// GetSessionFilename returns the full path for a session file
-func (m *Manager) GetSessionFilename(id string) string {
-	return filepath.Join(m.sessionsDir, id+".json")
+	return nil
 }
 
 // SessionExists checks if a session exists
 func (m *Manager) SessionExists(id string) bool {
-	filename := GenerateSessionFilename(id)
-	_, err := os.Stat(filename)
-	return err == nil
+	_, err := m.store.Load(id)
+	return !errors.Is(err, ErrSessionNotFound)
 }
 
 // GetLatestSession returns the most recent session
@@ -282,6 +424,19 @@ func (m *Manager) GetLatestSession() (*Session, error) {
 	return m.Load(sessions[0].ID)
 }
 
+// Fork creates and saves a new session branching from parent after message n
+func (m *Manager) Fork(parent *Session, n int) (*Session, error) {
+	fork, err := parent.Fork(n)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.Save(fork); err != nil {
+		return nil, err
+	}
+	return fork, nil
+}
+
 // CreateSessionFromPerplexityMessages creates a session from perplexity messages
 func (m *Manager) CreateSessionFromPerplexityMessages(model string, messages []struct {
 	Role    string
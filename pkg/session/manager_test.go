@@ -1,10 +1,22 @@
 package session
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"perplexity-cli/pkg/perplexity"
 )
 
 func TestNewSession(t *testing.T) {
@@ -444,3 +456,1391 @@ func TestManagerBackwardCompatibility(t *testing.T) {
 		t.Error("ShortID should persist after saving")
 	}
 }
+
+func TestSessionFork(t *testing.T) {
+	session := NewSession("sonar-pro", "First question")
+	session.AddMessage("user", "First question")
+	session.AddMessage("assistant", "First answer")
+	session.AddMessage("user", "Second question")
+	session.AddMessage("assistant", "Second answer")
+
+	fork, err := session.Fork(2)
+	if err != nil {
+		t.Fatalf("Fork(2) failed: %v", err)
+	}
+
+	if len(fork.Messages) != 2 {
+		t.Errorf("Fork(2) has %d messages, expected 2", len(fork.Messages))
+	}
+
+	if fork.Metadata.ParentID != session.ID {
+		t.Errorf("Fork parent_id = %s, expected %s", fork.Metadata.ParentID, session.ID)
+	}
+
+	if fork.Metadata.ForkPoint != 2 {
+		t.Errorf("Fork fork_point = %d, expected 2", fork.Metadata.ForkPoint)
+	}
+
+	if fork.Metadata.Model != "sonar-pro" {
+		t.Errorf("Fork model = %s, expected sonar-pro", fork.Metadata.Model)
+	}
+
+	// Modifying the fork must not affect the parent
+	fork.Messages[0].Content = "Changed"
+	if session.Messages[0].Content != "First question" {
+		t.Error("Fork shares message storage with its parent")
+	}
+
+	// Fork points must be in range and on an assistant reply
+	for _, at := range []int{0, 3, 5} {
+		if _, err := session.Fork(at); err == nil {
+			t.Errorf("Fork(%d) should fail", at)
+		}
+	}
+
+	// The context summary is kept only if it covers copied messages
+	session.SetContextSummary("First exchange", 2)
+	if fork, _ := session.Fork(2); fork.Metadata.ContextSummaryMessages != 2 || !fork.IsCompacted(1) {
+		t.Error("Fork(2) should keep a context summary covering 2 messages")
+	}
+	session.SetContextSummary("Both exchanges", 4)
+	if fork, _ := session.Fork(2); fork.Metadata.ContextSummary != "" {
+		t.Error("Fork(2) should drop a context summary covering 4 messages")
+	}
+}
+
+func TestSessionRemoveLastExchange(t *testing.T) {
+	session := NewSession("sonar", "First")
+	if _, ok := session.RemoveLastExchange(); ok {
+		t.Error("RemoveLastExchange on an empty session should report false")
+	}
+
+	session.AddMessage("user", "First")
+	session.AddMessage("assistant", "Answer one")
+	session.AddMessage("user", "Second")
+	session.AddMessage("assistant", "Answer two")
+	session.SetSummary("Both exchanges")
+	session.SetContextSummary("First exchange", 2)
+
+	removed, ok := session.RemoveLastExchange()
+	if !ok || removed.Content != "Second" {
+		t.Fatalf("RemoveLastExchange() = %q, %v; expected Second, true", removed.Content, ok)
+	}
+	if len(session.Messages) != 2 {
+		t.Errorf("expected 2 messages left, got %d", len(session.Messages))
+	}
+	if session.Metadata.Summary != "" {
+		t.Error("summary covering the removed messages should be dropped")
+	}
+	if session.Metadata.ContextSummary == "" {
+		t.Error("context summary covering only kept messages should be kept")
+	}
+
+	// A trailing user message without a reply is removed on its own
+	session.AddMessage("user", "Unanswered")
+	if removed, _ := session.RemoveLastExchange(); removed.Content != "Unanswered" || len(session.Messages) != 2 {
+		t.Errorf("removed %q leaving %d messages, expected Unanswered and 2", removed.Content, len(session.Messages))
+	}
+
+	if _, ok := session.RemoveLastExchange(); !ok || session.Metadata.ContextSummary != "" {
+		t.Error("removing the summarized exchange should drop the context summary")
+	}
+}
+
+func TestSessionAddAttachments(t *testing.T) {
+	session := NewSession("sonar", "Question")
+	session.AddAttachments("/src/main.go", "/src/go.mod")
+	session.AddAttachments("/src/main.go", "/docs/a.md")
+
+	expected := []string{"/src/main.go", "/src/go.mod", "/docs/a.md"}
+	if strings.Join(session.Metadata.Attachments, " ") != strings.Join(expected, " ") {
+		t.Errorf("Attachments = %q, expected %q without duplicates", session.Metadata.Attachments, expected)
+	}
+}
+
+func TestLinkCompared(t *testing.T) {
+	manager := NewManagerWithDir(t.TempDir())
+
+	// Sessions created in the same millisecond get new IDs when saved, so
+	// they are linked after saving
+	sessions := []*Session{NewSession("sonar", "Question"), NewSession("sonar-pro", "Question"), NewSession("sonar-reasoning", "Question")}
+	for _, s := range sessions {
+		if err := manager.Save(s); err != nil {
+			t.Fatalf("Save() failed: %v", err)
+		}
+	}
+	LinkCompared(sessions)
+	for _, s := range sessions {
+		if err := manager.Save(s); err != nil {
+			t.Fatalf("Save() after linking failed: %v", err)
+		}
+	}
+
+	loaded, err := manager.Load(sessions[1].ID)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	expected := []string{sessions[0].ID, sessions[2].ID}
+	if strings.Join(loaded.Metadata.Compared, " ") != strings.Join(expected, " ") {
+		t.Errorf("Compared = %q, expected the other sessions %q", loaded.Metadata.Compared, expected)
+	}
+}
+
+func TestSessionKeepAlternates(t *testing.T) {
+	session := NewSession("sonar", "Question")
+	if session.LastExchange() != nil {
+		t.Error("LastExchange on an empty session should be nil")
+	}
+
+	session.AddMessage("user", "Question")
+	session.AddMessage("assistant", "First answer")
+
+	// Retrying keeps the previous response on the new one
+	for _, answer := range []string{"Second answer", "Third answer"} {
+		replaced := session.LastExchange()
+		session.RemoveLastExchange()
+		session.AddMessage("user", "Question")
+		session.AddMessage("assistant", answer)
+		session.KeepAlternates(replaced)
+	}
+
+	reply := session.Messages[1]
+	if reply.Content != "Third answer" || len(reply.Alternates) != 2 ||
+		reply.Alternates[0].Content != "First answer" || reply.Alternates[1].Content != "Second answer" {
+		t.Errorf("reply = %+v, expected Third answer with the first two as alternates", reply)
+	}
+	if len(session.Messages[0].Alternates) != 0 {
+		t.Errorf("an unchanged question should have no alternates, got %+v", session.Messages[0].Alternates)
+	}
+
+	// Editing keeps the previous question and its response on the new question
+	replaced := session.LastExchange()
+	session.RemoveLastExchange()
+	session.AddMessage("user", "Better question")
+	session.AddMessage("assistant", "Better answer")
+	session.KeepAlternates(replaced)
+
+	question := session.Messages[0]
+	if len(question.Alternates) != 1 || question.Alternates[0].Content != "Question" || question.Alternates[0].Reply != "Third answer" {
+		t.Errorf("question alternates = %+v, expected Question with Third answer", question.Alternates)
+	}
+	if len(question.Alternates[0].ReplyAlternates) != 2 {
+		t.Errorf("the earlier versions of the replaced answer should be kept, got %+v", question.Alternates[0].ReplyAlternates)
+	}
+	if len(session.Messages[1].Alternates) != 0 {
+		t.Errorf("the answer to an edited question should have no alternates, got %+v", session.Messages[1].Alternates)
+	}
+
+	// Alternates are saved with the session
+	tempDir, err := os.MkdirTemp("", "session-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	manager := NewManagerWithDir(tempDir)
+	if err := manager.Save(session); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	loaded, err := manager.Load(session.ID)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if got := loaded.Messages[0].Alternates; len(got) != 1 || got[0].Reply != "Third answer" {
+		t.Errorf("loaded alternates = %+v, expected them saved", got)
+	}
+}
+
+func TestManagerFind(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "session-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	manager := NewManagerWithDir(tempDir)
+
+	session := NewSession("sonar", "Test query")
+	if err := manager.Save(session); err != nil {
+		t.Fatalf("Failed to save session: %v", err)
+	}
+
+	for _, id := range []string{session.ShortID, session.ID} {
+		found, err := manager.Find(id)
+		if err != nil {
+			t.Fatalf("Find(%q) failed: %v", id, err)
+		}
+		if found.ID != session.ID {
+			t.Errorf("Find(%q) = %s, expected %s", id, found.ID, session.ID)
+		}
+	}
+
+	if _, err := manager.Find("nonexistent"); err == nil {
+		t.Error("Find should return error for non-existent ID")
+	}
+}
+
+func TestManagerResolve(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "session-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	manager := NewManagerWithDir(tempDir)
+
+	// Short IDs abcd111 and abcd222 share a prefix; xyz9 is newest
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	var sessions []*Session
+	for i, shortID := range []string{"abcd111", "abcd222", "xyz9"} {
+		session := NewSession("sonar", "Query "+shortID)
+		session.ID = fmt.Sprintf("20240115-10000%d.000", i)
+		session.ShortID = shortID
+		session.Metadata.CreatedAt = base.Add(time.Duration(i) * time.Minute)
+		if err := manager.Save(session); err != nil {
+			t.Fatalf("Failed to save session: %v", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	tests := []struct {
+		ref      string
+		expected string
+	}{
+		{"abcd111", sessions[0].ID},
+		{"abcd2", sessions[1].ID},
+		{"xyz9", sessions[2].ID},
+		{"20240115-100000.000", sessions[0].ID},
+		{"latest", sessions[2].ID},
+		{"@-1", sessions[2].ID},
+		{"@-3", sessions[0].ID},
+	}
+
+	for _, tt := range tests {
+		id, err := manager.Resolve(tt.ref)
+		if err != nil {
+			t.Errorf("Resolve(%q) failed: %v", tt.ref, err)
+			continue
+		}
+		if id != tt.expected {
+			t.Errorf("Resolve(%q) = %s, expected %s", tt.ref, id, tt.expected)
+		}
+	}
+
+	_, err = manager.Resolve("abcd")
+	if !errors.Is(err, ErrAmbiguousID) {
+		t.Fatalf("Resolve(abcd) error = %v, expected ErrAmbiguousID", err)
+	}
+	for _, candidate := range []string{"[abcd111]", "[abcd222]"} {
+		if !strings.Contains(err.Error(), candidate) {
+			t.Errorf("ambiguous error %q does not list %s", err, candidate)
+		}
+	}
+
+	// Prefixes shorter than four characters are not resolved
+	for _, ref := range []string{"xyz", "@-4", "@-0", "nonexistent"} {
+		if _, err := manager.Resolve(ref); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("Resolve(%q) error = %v, expected ErrSessionNotFound", ref, err)
+		}
+	}
+}
+
+func TestSaveReassignsTakenID(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "session-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	manager := NewManagerWithDir(tempDir)
+
+	// Two sessions created in the same millisecond
+	first := NewSession("sonar", "First")
+	second := NewSession("sonar", "Second")
+	second.ID, second.ShortID = first.ID, first.ShortID
+	second.Metadata.CreatedAt = first.Metadata.CreatedAt
+
+	if err := manager.Save(first); err != nil {
+		t.Fatalf("Failed to save first session: %v", err)
+	}
+	if err := manager.Save(second); err != nil {
+		t.Fatalf("Failed to save second session: %v", err)
+	}
+
+	if second.ID == first.ID || second.ShortID == first.ShortID {
+		t.Fatalf("second session kept the taken IDs %s/%s", second.ID, second.ShortID)
+	}
+	if !strings.HasPrefix(second.ShortID, first.ShortID) {
+		t.Errorf("reassigned short ID %s should extend %s", second.ShortID, first.ShortID)
+	}
+
+	for _, session := range []*Session{first, second} {
+		loaded, err := manager.Find(session.ShortID)
+		if err != nil {
+			t.Fatalf("Find(%s) failed: %v", session.ShortID, err)
+		}
+		if loaded.Metadata.InitialQuery != session.Metadata.InitialQuery {
+			t.Errorf("Find(%s) loaded %q, expected %q", session.ShortID, loaded.Metadata.InitialQuery, session.Metadata.InitialQuery)
+		}
+	}
+
+	// Saving a loaded session again is an update, not a collision
+	if err := manager.Save(first); err != nil {
+		t.Errorf("re-saving a stored session failed: %v", err)
+	}
+}
+
+func TestSessionNames(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "session-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	manager := NewManagerWithDir(tempDir)
+
+	first := NewSession("sonar", "First")
+	if err := manager.Save(first); err != nil {
+		t.Fatalf("Failed to save session: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	second := NewSession("sonar", "Second")
+	if err := manager.Save(second); err != nil {
+		t.Fatalf("Failed to save session: %v", err)
+	}
+
+	if _, err := manager.SetName(first.ID, "deploy-research"); err != nil {
+		t.Fatalf("SetName failed: %v", err)
+	}
+
+	found, err := manager.Find("deploy-research")
+	if err != nil {
+		t.Fatalf("Find by name failed: %v", err)
+	}
+	if found.ID != first.ID {
+		t.Errorf("Find(deploy-research) = %s, expected %s", found.ID, first.ID)
+	}
+
+	// Renaming a session to its own name is allowed
+	if _, err := manager.SetName(first.ID, "deploy-research"); err != nil {
+		t.Errorf("SetName with the current name failed: %v", err)
+	}
+
+	if _, err := manager.SetName(second.ID, "deploy-research"); !errors.Is(err, ErrNameTaken) {
+		t.Errorf("SetName with a taken name error = %v, expected ErrNameTaken", err)
+	}
+	if _, err := manager.SetName(second.ID, first.ShortID); err == nil {
+		t.Error("SetName should reject another session's short ID")
+	}
+
+	for _, name := range []string{"9lives", "has space", "-dash", strings.Repeat("a", 65)} {
+		if err := ValidateName(name); err == nil {
+			t.Errorf("ValidateName(%q) should fail", name)
+		}
+	}
+
+	if _, err := manager.SetName(first.ID, ""); err != nil {
+		t.Fatalf("clearing the name failed: %v", err)
+	}
+	if _, err := manager.Find("deploy-research"); err == nil {
+		t.Error("Find should fail once the name is removed")
+	}
+}
+
+func TestConcurrentSavesTakeANameOnce(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		manager := NewManagerWithStore(store)
+
+		const runs = 6
+		errs := make([]error, runs)
+		var wg sync.WaitGroup
+		for i := range runs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s := NewSession("sonar", fmt.Sprintf("Run %d", i))
+				s.Metadata.Name = "foo"
+				errs[i] = manager.Save(s)
+			}()
+		}
+		wg.Wait()
+
+		saved := 0
+		for _, err := range errs {
+			switch {
+			case err == nil:
+				saved++
+			case !errors.Is(err, ErrNameTaken):
+				t.Errorf("Save() error = %v, expected ErrNameTaken", err)
+			}
+		}
+		if saved != 1 {
+			t.Errorf("%d sessions were saved with the name foo, expected 1", saved)
+		}
+	})
+}
+
+func TestResolvePrefersNames(t *testing.T) {
+	manager := NewManagerWithDir(t.TempDir())
+
+	named := NewSession("sonar", "Named")
+	named.Metadata.Name = "abcdefg"
+	if err := manager.Save(named); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	// A session created later whose short ID happens to equal the name
+	later := NewSession("sonar", "Later")
+	later.ShortID = "abcdefg"
+	if err := manager.Save(later); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	id, err := manager.Resolve("abcdefg")
+	if err != nil {
+		t.Fatalf("Resolve() failed: %v", err)
+	}
+	if id != named.ID {
+		t.Errorf("Resolve(abcdefg) = %s, expected the named session %s", id, named.ID)
+	}
+}
+
+func TestBuildTree(t *testing.T) {
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	sessions := []SessionInfo{
+		{ID: "root", CreatedAt: base},
+		{ID: "a", ParentID: "root", ForkPoint: 2, CreatedAt: base.Add(2 * time.Minute)},
+		{ID: "b", ParentID: "root", ForkPoint: 4, CreatedAt: base.Add(time.Minute)},
+		{ID: "a1", ParentID: "a", ForkPoint: 4, CreatedAt: base.Add(3 * time.Minute)},
+		{ID: "other", CreatedAt: base},
+	}
+
+	if root := FindRoot(sessions, "a1"); root != "root" {
+		t.Errorf("FindRoot(a1) = %s, expected root", root)
+	}
+
+	if root := FindRoot(sessions, "other"); root != "other" {
+		t.Errorf("FindRoot(other) = %s, expected other", root)
+	}
+
+	tree, err := BuildTree(sessions, "root")
+	if err != nil {
+		t.Fatalf("BuildTree failed: %v", err)
+	}
+
+	if len(tree.Children) != 2 {
+		t.Fatalf("root has %d children, expected 2", len(tree.Children))
+	}
+
+	// Children are ordered oldest first
+	if tree.Children[0].Info.ID != "b" || tree.Children[1].Info.ID != "a" {
+		t.Errorf("children order = %s, %s; expected b, a", tree.Children[0].Info.ID, tree.Children[1].Info.ID)
+	}
+
+	if len(tree.Children[1].Children) != 1 || tree.Children[1].Children[0].Info.ID != "a1" {
+		t.Error("expected a1 to be a child of a")
+	}
+
+	if _, err := BuildTree(sessions, "missing"); err == nil {
+		t.Error("BuildTree should fail for unknown root")
+	}
+}
+
+func TestSessionTags(t *testing.T) {
+	session := NewSession("sonar", "Test")
+
+	session.AddTags("Work", "#rust", "work", " ")
+	if len(session.Metadata.Tags) != 2 {
+		t.Fatalf("AddTags() produced %v, expected [rust work]", session.Metadata.Tags)
+	}
+	if session.Metadata.Tags[0] != "rust" || session.Metadata.Tags[1] != "work" {
+		t.Errorf("AddTags() produced %v, expected [rust work]", session.Metadata.Tags)
+	}
+
+	info := session.ToInfo()
+	if !info.HasTags([]string{"WORK"}) {
+		t.Error("HasTags should match case-insensitively")
+	}
+	if info.HasTags([]string{"work", "go"}) {
+		t.Error("HasTags should require all tags")
+	}
+
+	session.RemoveTags("#Rust", "work")
+	if session.Metadata.Tags != nil {
+		t.Errorf("RemoveTags() left %v, expected none", session.Metadata.Tags)
+	}
+}
+
+func TestManagerListRecentPinnedAndTagged(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "session-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	manager := NewManagerWithDir(tempDir)
+
+	oldest := NewSession("sonar", "Oldest")
+	oldest.Metadata.Pinned = true
+	oldest.AddTags("work")
+	manager.Save(oldest)
+
+	time.Sleep(10 * time.Millisecond)
+
+	middle := NewSession("sonar", "Middle")
+	middle.AddTags("home")
+	manager.Save(middle)
+
+	time.Sleep(10 * time.Millisecond)
+
+	newest := NewSession("sonar", "Newest")
+	newest.AddTags("work")
+	manager.Save(newest)
+
+	sessions, err := manager.ListRecent(2)
+	if err != nil {
+		t.Fatalf("ListRecent() failed: %v", err)
+	}
+
+	if len(sessions) != 2 || sessions[0].ID != oldest.ID || sessions[1].ID != newest.ID {
+		t.Errorf("ListRecent(2) should return the pinned session first, then the newest")
+	}
+
+	tagged, err := manager.ListRecentTagged(10, []string{"work"})
+	if err != nil {
+		t.Fatalf("ListRecentTagged() failed: %v", err)
+	}
+
+	if len(tagged) != 2 {
+		t.Errorf("ListRecentTagged(work) returned %d sessions, expected 2", len(tagged))
+	}
+
+	// Titles and tags are searchable
+	middle.SetTitle("Kitchen renovation")
+	manager.Save(middle)
+
+	results, err := manager.Search("renovation")
+	if err != nil {
+		t.Fatalf("Search() failed: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != middle.ID {
+		t.Errorf("Search('renovation') should find the session by title")
+	}
+
+	results, err = manager.Search("home")
+	if err != nil {
+		t.Fatalf("Search() failed: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != middle.ID {
+		t.Errorf("Search('home') should find the session by tag")
+	}
+}
+
+func TestBuildTranscript(t *testing.T) {
+	messages := []SessionMessage{
+		{Role: "user", Content: "What is Go?"},
+		{Role: "assistant", Content: "A language. [1]\n\n## References:\n[1] go.dev"},
+		{Role: "user", Content: "Who made it?"},
+	}
+
+	transcript := BuildTranscript(messages, 0)
+	expected := "User: What is Go?\n\nAssistant: A language. [1]\n\nUser: Who made it?"
+	if transcript != expected {
+		t.Errorf("BuildTranscript() = %q, expected %q", transcript, expected)
+	}
+
+	// Oldest messages are dropped first when over budget
+	truncated := BuildTranscript(messages, 40)
+	if strings.Contains(truncated, "What is Go?") || !strings.Contains(truncated, "Who made it?") {
+		t.Errorf("BuildTranscript() with budget = %q, expected only the latest messages", truncated)
+	}
+}
+
+func TestCleanTitle(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Comparing Rust Async Runtimes", "Comparing Rust Async Runtimes"},
+		{"\"Comparing Rust Async Runtimes.\"", "Comparing Rust Async Runtimes"},
+		{"Title: Go Generics Explained [1]\nExtra line", "Go Generics Explained"},
+		{"**Kubernetes Upgrade Planning**", "Kubernetes Upgrade Planning"},
+	}
+
+	for _, tt := range tests {
+		result := cleanTitle(tt.input)
+		if result != tt.expected {
+			t.Errorf("cleanTitle(%q) = %q, expected %q", tt.input, result, tt.expected)
+		}
+	}
+}
+
+func TestGenerateTitleAndSummary(t *testing.T) {
+	var lastRequest perplexity.ChatCompletionRequest
+	reply := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&lastRequest)
+		json.NewEncoder(w).Encode(perplexity.ChatCompletionResponse{
+			Choices: []perplexity.Choice{{Message: perplexity.Message{Role: "assistant", Content: reply}}},
+		})
+	}))
+	defer server.Close()
+
+	client := perplexity.NewClient("test-key")
+	client.SetEndpoint(server.URL)
+
+	session := NewSession("sonar-pro", "What is Go?")
+	session.AddMessage("user", "What is Go?")
+	session.AddMessage("assistant", "A programming language.")
+
+	reply = "\"Introduction To The Go Language\""
+	title, err := GenerateTitle(client, "sonar", session.Messages)
+	if err != nil {
+		t.Fatalf("GenerateTitle() failed: %v", err)
+	}
+	if title != "Introduction To The Go Language" {
+		t.Errorf("GenerateTitle() = %q", title)
+	}
+	if lastRequest.Model != "sonar" || lastRequest.Messages[0].Role != "system" {
+		t.Errorf("GenerateTitle() sent unexpected request: %+v", lastRequest)
+	}
+
+	reply = "The user asked about Go [1] and learned it is a language."
+	summary, err := GenerateSummary(client, "sonar", session.Messages)
+	if err != nil {
+		t.Fatalf("GenerateSummary() failed: %v", err)
+	}
+
+	session.SetSummary(summary)
+	if !session.HasFreshSummary() {
+		t.Error("summary should be fresh right after SetSummary")
+	}
+	if strings.Contains(session.Metadata.Summary, "[1]") {
+		t.Errorf("summary should not contain citation markers: %q", session.Metadata.Summary)
+	}
+
+	session.AddMessage("user", "More?")
+	if session.HasFreshSummary() {
+		t.Error("summary should be stale after adding messages")
+	}
+}
+
+func TestManagerSaveDetectsConcurrentModification(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "session-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	manager := NewManagerWithDir(tempDir)
+
+	session := NewSession("sonar", "Test query")
+	session.AddMessage("user", "Hello")
+	session.AddMessage("assistant", "Hi!")
+	if err := manager.Save(session); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	// Two writers load the same revision
+	first, _ := manager.Load(session.ID)
+	second, _ := manager.Load(session.ID)
+
+	first.AddMessage("user", "From first")
+	first.AddMessage("assistant", "Reply to first")
+	if err := manager.Save(first); err != nil {
+		t.Fatalf("first Save() failed: %v", err)
+	}
+
+	base := len(second.Messages)
+	second.AddMessage("user", "From second")
+	second.AddMessage("assistant", "Reply to second")
+	err = manager.Save(second)
+	if !errors.Is(err, ErrSessionModified) {
+		t.Fatalf("second Save() error = %v, expected ErrSessionModified", err)
+	}
+
+	merged, err := manager.Rebase(second, base)
+	if err != nil {
+		t.Fatalf("Rebase() failed: %v", err)
+	}
+
+	if len(merged.Messages) != 6 {
+		t.Fatalf("merged session has %d messages, expected 6", len(merged.Messages))
+	}
+	if merged.Messages[2].Content != "From first" || merged.Messages[4].Content != "From second" {
+		t.Errorf("merged messages out of order: %q, %q", merged.Messages[2].Content, merged.Messages[4].Content)
+	}
+
+	reloaded, _ := manager.Load(session.ID)
+	if len(reloaded.Messages) != 6 || reloaded.Revision != merged.Revision {
+		t.Errorf("reloaded session has %d messages at revision %d, expected 6 at %d",
+			len(reloaded.Messages), reloaded.Revision, merged.Revision)
+	}
+}
+
+func TestManagerRebaseAfterRewrite(t *testing.T) {
+	manager := NewManagerWithDir(t.TempDir())
+
+	session := NewSession("sonar", "Test query")
+	session.AddMessage("user", "Hello")
+	session.AddMessage("assistant", "Hi!")
+	session.AddMessage("user", "Question")
+	session.AddMessage("assistant", "Bad answer")
+	if err := manager.Save(session); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	first, _ := manager.Load(session.ID)
+	second, _ := manager.Load(session.ID)
+
+	first.AddMessage("user", "From first")
+	first.AddMessage("assistant", "Reply to first")
+	first.Metadata.Pinned = true
+	if err := manager.Save(first); err != nil {
+		t.Fatalf("first Save() failed: %v", err)
+	}
+
+	// The second writer replaces the last exchange, as /retry does, and
+	// edits metadata
+	second.RemoveLastExchange()
+	base := len(second.Messages)
+	second.AddMessage("user", "Question")
+	second.AddMessage("assistant", "Better answer")
+	second.SetTitle("Retried")
+	second.AddTags("retry")
+	if err := manager.Save(second); !errors.Is(err, ErrSessionModified) {
+		t.Fatalf("second Save() error = %v, expected ErrSessionModified", err)
+	}
+
+	merged, err := manager.Rebase(second, base)
+	if err != nil {
+		t.Fatalf("Rebase() failed: %v", err)
+	}
+
+	var contents []string
+	for _, msg := range merged.Messages {
+		contents = append(contents, msg.Content)
+	}
+	expected := []string{"Hello", "Hi!", "From first", "Reply to first", "Question", "Better answer"}
+	if !reflect.DeepEqual(contents, expected) {
+		t.Errorf("merged messages = %q, expected %q", contents, expected)
+	}
+	if merged.Metadata.Title != "Retried" || !reflect.DeepEqual(merged.Metadata.Tags, []string{"retry"}) || !merged.Metadata.Pinned {
+		t.Errorf("merged metadata = %+v, expected both writers' changes", merged.Metadata)
+	}
+}
+
+func TestManagerModifyIsSerialized(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "session-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	manager := NewManagerWithDir(tempDir)
+
+	session := NewSession("sonar", "Test query")
+	if err := manager.Save(session); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	const writers = 10
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := manager.Update(session.ID, "user", fmt.Sprintf("message %d", i)); err != nil {
+				t.Errorf("Update() failed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	loaded, err := manager.Load(session.ID)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+
+	if len(loaded.Messages) != writers {
+		t.Errorf("session has %d messages after %d concurrent updates", len(loaded.Messages), writers)
+	}
+}
+
+func TestManagerMigratesOldSchema(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "session-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	manager := NewManagerWithDir(tempDir)
+
+	// A session written before schema versions and short IDs existed
+	legacy := `{
+  "id": "20240115-103045.123",
+  "messages": [{"role": "user", "content": "Hello", "timestamp": "2024-01-15T10:30:45Z"}],
+  "metadata": {"model": "sonar", "initial_query": "Hello", "created_at": "2024-01-15T10:30:45.123Z", "updated_at": "2024-01-15T10:30:45.123Z"}
+}`
+	filename := filepath.Join(tempDir, "20240115-103045.123.json")
+	if err := os.WriteFile(filename, []byte(legacy), 0644); err != nil {
+		t.Fatalf("Failed to write legacy session: %v", err)
+	}
+
+	// Dry run reports the pending migration without writing
+	reports, err := manager.MigrateAll(true)
+	if err != nil {
+		t.Fatalf("MigrateAll(dry run) failed: %v", err)
+	}
+	if len(reports) != 1 || reports[0].From != 0 || len(reports[0].Steps) != 1 {
+		t.Fatalf("MigrateAll(dry run) reports = %+v, expected one v0 session", reports)
+	}
+	if data, _ := os.ReadFile(filename); string(data) != legacy {
+		t.Error("dry run modified the session file")
+	}
+
+	loaded, err := manager.Load("20240115-103045.123")
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+
+	expectedShortID := GenerateShortID(time.Date(2024, 1, 15, 10, 30, 45, 123000000, time.UTC))
+	if loaded.ShortID != expectedShortID {
+		t.Errorf("migrated ShortID = %s, expected %s", loaded.ShortID, expectedShortID)
+	}
+	if loaded.SchemaVersion != CurrentSchemaVersion {
+		t.Errorf("migrated SchemaVersion = %d, expected %d", loaded.SchemaVersion, CurrentSchemaVersion)
+	}
+
+	backup, err := os.ReadFile(filepath.Join(tempDir, "backups", "20240115-103045.123.v0.json"))
+	if err != nil || string(backup) != legacy {
+		t.Errorf("expected the original file to be backed up, got %q (%v)", backup, err)
+	}
+
+	reports, err = manager.MigrateAll(false)
+	if err != nil {
+		t.Fatalf("MigrateAll() failed: %v", err)
+	}
+	if len(reports) != 0 {
+		t.Errorf("MigrateAll() after lazy migration reported %d sessions, expected 0", len(reports))
+	}
+}
+
+func TestManagerRefusesNewerSchema(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "session-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	manager := NewManagerWithDir(tempDir)
+
+	future := fmt.Sprintf(`{"schema_version": %d, "id": "future", "short_id": "abc", "messages": [], "metadata": {}}`, CurrentSchemaVersion+1)
+	filename := filepath.Join(tempDir, "future.json")
+	if err := os.WriteFile(filename, []byte(future), 0644); err != nil {
+		t.Fatalf("Failed to write session: %v", err)
+	}
+
+	if _, err := manager.Load("future"); !errors.Is(err, ErrUnsupportedSchema) {
+		t.Errorf("Load() error = %v, expected ErrUnsupportedSchema", err)
+	}
+
+	if data, _ := os.ReadFile(filename); string(data) != future {
+		t.Error("session with a newer schema was rewritten")
+	}
+}
+
+func TestStores(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "session-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	jsonStore, err := NewJSONStore(filepath.Join(tempDir, "sessions"), nil)
+	if err != nil {
+		t.Fatalf("NewJSONStore() failed: %v", err)
+	}
+
+	sqliteStore, err := NewSQLiteStore(filepath.Join(tempDir, "sessions.db"), nil)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() failed: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	for name, store := range map[string]Store{"json": jsonStore, "sqlite": sqliteStore} {
+		t.Run(name, func(t *testing.T) {
+			manager := NewManagerWithStore(store)
+
+			paris := NewSession("sonar", "What is Paris?")
+			paris.AddMessage("user", "Tell me about France")
+			paris.AddMessage("assistant", "100% worth a visit")
+			paris.AddTags("travel")
+			if err := manager.Save(paris); err != nil {
+				t.Fatalf("Save() failed: %v", err)
+			}
+
+			time.Sleep(10 * time.Millisecond)
+
+			tokyo := NewSession("sonar", "What is Tokyo?")
+			tokyo.AddMessage("user", "Tell me about Japan")
+			if err := manager.Save(tokyo); err != nil {
+				t.Fatalf("Save() failed: %v", err)
+			}
+
+			loaded, err := manager.Find(paris.ShortID)
+			if err != nil {
+				t.Fatalf("Find() failed: %v", err)
+			}
+			if len(loaded.Messages) != 2 || loaded.Revision != 1 {
+				t.Errorf("loaded %d messages at revision %d, expected 2 at 1", len(loaded.Messages), loaded.Revision)
+			}
+
+			sessions, err := manager.List()
+			if err != nil {
+				t.Fatalf("List() failed: %v", err)
+			}
+			if len(sessions) != 2 || sessions[0].ID != tokyo.ID {
+				t.Errorf("List() should return both sessions, newest first")
+			}
+
+			searches := map[string]int{
+				"france":       1, // message content, case-insensitive
+				"is":           2, // short query
+				"100%":         1, // LIKE wildcards are literal
+				"travel":       1, // tag
+				tokyo.ShortID:  1, // short ID
+				"no such text": 0,
+			}
+			for query, expected := range searches {
+				results, err := manager.Search(query)
+				if err != nil {
+					t.Fatalf("Search(%q) failed: %v", query, err)
+				}
+				if len(results) != expected {
+					t.Errorf("Search(%q) returned %d results, expected %d", query, len(results), expected)
+				}
+			}
+
+			stale, _ := manager.Load(paris.ID)
+			loaded.AddMessage("user", "More")
+			if err := manager.Save(loaded); err != nil {
+				t.Fatalf("Save() failed: %v", err)
+			}
+			if err := manager.Save(stale); !errors.Is(err, ErrSessionModified) {
+				t.Errorf("Save() of stale session error = %v, expected ErrSessionModified", err)
+			}
+
+			if err := manager.Delete(tokyo.ID); err != nil {
+				t.Fatalf("Delete() failed: %v", err)
+			}
+			if _, err := manager.Load(tokyo.ID); !errors.Is(err, ErrSessionNotFound) {
+				t.Errorf("Load() after Delete() error = %v, expected ErrSessionNotFound", err)
+			}
+		})
+	}
+}
+
+// forEachStore runs fn as a subtest against an empty store of each backend
+func forEachStore(t *testing.T, fn func(t *testing.T, store Store)) {
+	backends := map[string]func(dir string) (Store, error){
+		"json": func(dir string) (Store, error) { return NewJSONStore(filepath.Join(dir, "sessions"), nil) },
+		"sqlite": func(dir string) (Store, error) {
+			return NewSQLiteStore(filepath.Join(dir, "sessions.db"), nil)
+		},
+	}
+	for name, open := range backends {
+		t.Run(name, func(t *testing.T) {
+			store, err := open(t.TempDir())
+			if err != nil {
+				t.Fatalf("opening the %s store failed: %v", name, err)
+			}
+			defer store.Close()
+			fn(t, store)
+		})
+	}
+}
+
+func TestStoreSearchConformance(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		manager := NewManagerWithStore(store)
+
+		paris := NewSession("sonar", "What is Paris?")
+		paris.AddMessage("assistant", "100% worth a visit")
+		paris.AddTags("travel", "europe")
+		paris.SetTitle("City guide")
+		if err := manager.Save(paris); err != nil {
+			t.Fatalf("Save() failed: %v", err)
+		}
+
+		tokyo := NewSession("sonar", "What is Tokyo?")
+		tokyo.AddTags("travelogue")
+		if err := manager.Save(tokyo); err != nil {
+			t.Fatalf("Save() failed: %v", err)
+		}
+
+		tests := []struct {
+			query    string
+			expected []string
+		}{
+			{query: "travel", expected: []string{paris.ID}},
+			{query: "#Travel", expected: []string{paris.ID}},
+			{query: "travelogue", expected: []string{tokyo.ID}},
+			{query: "trav", expected: nil},
+			{query: "euro", expected: nil},
+			{query: "city GUIDE", expected: []string{paris.ID}},
+			{query: "what is", expected: []string{paris.ID, tokyo.ID}},
+			{query: "100%", expected: []string{paris.ID}},
+			{query: "1_0", expected: nil},
+			{query: strings.ToUpper(tokyo.ShortID), expected: []string{tokyo.ID}},
+		}
+		for _, tt := range tests {
+			results, err := manager.Search(tt.query)
+			if err != nil {
+				t.Fatalf("Search(%q) failed: %v", tt.query, err)
+			}
+			var ids []string
+			for _, result := range results {
+				ids = append(ids, result.ID)
+			}
+			sort.Strings(ids)
+			expected := append([]string(nil), tt.expected...)
+			sort.Strings(expected)
+			if !reflect.DeepEqual(ids, expected) {
+				t.Errorf("Search(%q) = %v, expected %v", tt.query, ids, expected)
+			}
+		}
+	})
+}
+
+func TestSQLiteStoreReindexesTags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	store, err := NewSQLiteStore(path, nil)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() failed: %v", err)
+	}
+
+	s := NewSession("sonar", "What is Paris?")
+	s.AddTags("travel")
+	if err := NewManagerWithStore(store).Save(s); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	// Index the session as older versions did, with its tags in the body
+	for _, q := range []string{
+		`DELETE FROM session_tags`,
+		`UPDATE sessions_fts SET body = body || char(10) || 'travel'`,
+		`PRAGMA user_version = 0`,
+	} {
+		if _, err := store.db.Exec(q); err != nil {
+			t.Fatalf("%s failed: %v", q, err)
+		}
+	}
+	store.Close()
+
+	store, err = NewSQLiteStore(path, nil)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() failed: %v", err)
+	}
+	defer store.Close()
+
+	for query, expected := range map[string]int{"trav": 0, "travel": 1} {
+		results, err := store.Search(query)
+		if err != nil {
+			t.Fatalf("Search(%q) failed: %v", query, err)
+		}
+		if len(results) != expected {
+			t.Errorf("Search(%q) after reindexing returned %d results, expected %d", query, len(results), expected)
+		}
+	}
+}
+
+func TestCopyStore(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "session-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	src := NewManagerWithDir(tempDir)
+	for i := 0; i < 3; i++ {
+		session := NewSession("sonar", fmt.Sprintf("Query %d", i))
+		session.AddMessage("user", fmt.Sprintf("Query %d", i))
+		time.Sleep(time.Millisecond)
+		if err := src.Save(session); err != nil {
+			t.Fatalf("Save() failed: %v", err)
+		}
+	}
+
+	dst, err := NewSQLiteStore(filepath.Join(tempDir, "sessions.db"), nil)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() failed: %v", err)
+	}
+	defer dst.Close()
+
+	copied, skipped, err := CopyStore(dst, src.Store())
+	if err != nil {
+		t.Fatalf("CopyStore() failed: %v", err)
+	}
+	if copied != 3 || len(skipped) != 0 {
+		t.Errorf("CopyStore() copied %d and skipped %d, expected 3 and 0", copied, len(skipped))
+	}
+
+	ids, err := dst.IDs()
+	if err != nil {
+		t.Fatalf("IDs() failed: %v", err)
+	}
+	if len(ids) != 3 {
+		t.Errorf("destination has %d sessions, expected 3", len(ids))
+	}
+}
+
+func TestEncryptedStores(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "session-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	key := bytes.Repeat([]byte{7}, 32)
+	enc := NewEncryptionWithKey(true, key)
+
+	sessionsDir := filepath.Join(tempDir, "sessions")
+	jsonStore, err := NewJSONStore(sessionsDir, enc)
+	if err != nil {
+		t.Fatalf("NewJSONStore() failed: %v", err)
+	}
+
+	dbPath := filepath.Join(tempDir, "sessions.db")
+	sqliteStore, err := NewSQLiteStore(dbPath, enc)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() failed: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	for _, path := range []string{sessionsDir, dbPath} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Stat(%s) failed: %v", path, err)
+		}
+		if info.Mode().Perm()&0077 != 0 {
+			t.Errorf("%s has mode %v, expected no group or other access", path, info.Mode().Perm())
+		}
+	}
+
+	for name, store := range map[string]Store{"json": jsonStore, "sqlite": sqliteStore} {
+		t.Run(name, func(t *testing.T) {
+			manager := NewManagerWithStore(store)
+
+			secret := NewSession("sonar", "Acme Corp contract terms")
+			secret.AddMessage("user", "Acme Corp contract terms")
+			if err := manager.Save(secret); err != nil {
+				t.Fatalf("Save() failed: %v", err)
+			}
+
+			loaded, err := manager.Load(secret.ID)
+			if err != nil {
+				t.Fatalf("Load() failed: %v", err)
+			}
+			if loaded.Metadata.InitialQuery != secret.Metadata.InitialQuery {
+				t.Errorf("InitialQuery = %q, expected %q", loaded.Metadata.InitialQuery, secret.Metadata.InitialQuery)
+			}
+
+			results, err := manager.Search("acme corp")
+			if err != nil {
+				t.Fatalf("Search() failed: %v", err)
+			}
+			if len(results) != 1 {
+				t.Errorf("Search() returned %d results, expected 1", len(results))
+			}
+
+			// Encryption can be turned off without losing access
+			enc.Enabled = false
+			defer func() { enc.Enabled = true }()
+
+			time.Sleep(10 * time.Millisecond)
+			plain := NewSession("sonar", "Public question")
+			if err := manager.Save(plain); err != nil {
+				t.Fatalf("Save() failed: %v", err)
+			}
+			if sessions, _ := manager.List(); len(sessions) != 2 {
+				t.Errorf("List() returned %d sessions, expected 2", len(sessions))
+			}
+		})
+	}
+
+	data, err := os.ReadFile(filepath.Join(sessionsDir, mustFirstID(t, jsonStore)+".json"))
+	if err != nil {
+		t.Fatalf("ReadFile() failed: %v", err)
+	}
+	if !IsEncrypted(data) || bytes.Contains(data, []byte("Acme")) {
+		t.Error("session file should be encrypted")
+	}
+
+	wrongKey := NewManagerWithStore(&JSONStore{dir: sessionsDir, enc: NewEncryptionWithKey(false, bytes.Repeat([]byte{8}, 32))})
+	if _, err := wrongKey.Load(mustFirstID(t, jsonStore)); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Load() with the wrong key error = %v, expected ErrDecrypt", err)
+	}
+
+	noKey := NewManagerWithDir(sessionsDir)
+	if _, err := noKey.Load(mustFirstID(t, jsonStore)); !errors.Is(err, ErrNoSessionKey) {
+		t.Errorf("Load() without a key error = %v, expected ErrNoSessionKey", err)
+	}
+}
+
+func TestConvertLeavesNoPlaintextBackups(t *testing.T) {
+	tempDir := t.TempDir()
+	enc := NewEncryptionWithKey(false, bytes.Repeat([]byte{7}, 32))
+
+	// Sessions written before schema versions existed, as stored
+	legacy := func(id string) []byte {
+		return []byte(`{"id": "` + id + `", "messages": [{"role": "user", "content": "Acme Corp contract terms", "timestamp": "2024-01-15T10:30:45Z"}], "metadata": {"model": "sonar", "initial_query": "Acme Corp contract terms", "created_at": "2024-01-15T10:30:45.123Z", "updated_at": "2024-01-15T10:30:45.123Z"}}`)
+	}
+	ids := []string{"20240115-103045.123", "20240116-103045.123"}
+
+	sessionsDir := filepath.Join(tempDir, "sessions")
+	jsonStore, err := NewJSONStore(sessionsDir, enc)
+	if err != nil {
+		t.Fatalf("NewJSONStore() failed: %v", err)
+	}
+	for _, id := range ids {
+		if err := os.WriteFile(filepath.Join(sessionsDir, id+".json"), legacy(id), 0600); err != nil {
+			t.Fatalf("Failed to write legacy session: %v", err)
+		}
+	}
+
+	dbPath := filepath.Join(tempDir, "sessions.db")
+	sqliteStore, err := NewSQLiteStore(dbPath, enc)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore() failed: %v", err)
+	}
+	defer sqliteStore.Close()
+	for _, id := range ids {
+		if _, err := sqliteStore.db.Exec(`INSERT INTO sessions (id, short_id, created_at, data) VALUES (?, '', 0, ?)`, id, legacy(id)); err != nil {
+			t.Fatalf("Failed to insert legacy session: %v", err)
+		}
+	}
+
+	for name, store := range map[string]Store{"json": jsonStore, "sqlite": sqliteStore} {
+		t.Run(name, func(t *testing.T) {
+			manager := NewManagerWithStore(store)
+
+			// The first session is migrated, and backed up, while unencrypted
+			if _, err := manager.Load(ids[0]); err != nil {
+				t.Fatalf("Load() failed: %v", err)
+			}
+
+			enc.Enabled = true
+			defer func() { enc.Enabled = false }()
+			for _, id := range ids {
+				if err := manager.Convert(id); err != nil {
+					t.Fatalf("Convert(%s) failed: %v", id, err)
+				}
+			}
+
+			for _, id := range ids {
+				loaded, err := manager.Load(id)
+				if err != nil {
+					t.Fatalf("Load() after Convert() failed: %v", err)
+				}
+				if loaded.Metadata.InitialQuery != "Acme Corp contract terms" {
+					t.Errorf("InitialQuery = %q after Convert()", loaded.Metadata.InitialQuery)
+				}
+			}
+		})
+	}
+
+	if err := sqliteStore.Compact(); err != nil {
+		t.Fatalf("Compact() failed: %v", err)
+	}
+
+	var backups int
+	err = filepath.WalkDir(tempDir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		if strings.Contains(path, "backups") {
+			backups++
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if bytes.Contains(data, []byte("Acme")) {
+			t.Errorf("%s holds a plaintext copy of a session", path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkDir() failed: %v", err)
+	}
+	if backups != 1 {
+		t.Errorf("found %d backup files, expected the one made before encryption", backups)
+	}
+
+	var sqliteBackups int
+	if err := sqliteStore.db.QueryRow(`SELECT count(*) FROM session_backups`).Scan(&sqliteBackups); err != nil || sqliteBackups != 1 {
+		t.Errorf("session_backups holds %d rows (%v), expected 1", sqliteBackups, err)
+	}
+}
+
+// mustFirstID returns the ID of the oldest session in a store
+func mustFirstID(t *testing.T, store Store) string {
+	t.Helper()
+	ids, err := store.IDs()
+	if err != nil || len(ids) == 0 {
+		t.Fatalf("IDs() = %v, %v", ids, err)
+	}
+	sort.Strings(ids)
+	return ids[0]
+}
+
+func TestReadOrCreateSecretConcurrently(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.key")
+
+	const processes = 8
+	secrets := make([][]byte, processes)
+	errs := make([]error, processes)
+	var wg sync.WaitGroup
+	for i := range processes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			secrets[i], errs[i] = readOrCreateSecret(path, 32, true)
+		}()
+	}
+	wg.Wait()
+
+	for i := range processes {
+		if errs[i] != nil {
+			t.Fatalf("readOrCreateSecret() failed: %v", errs[i])
+		}
+		if !bytes.Equal(secrets[i], secrets[0]) {
+			t.Fatalf("readOrCreateSecret() returned different secrets to concurrent callers")
+		}
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("key directory has %d entries, expected only the key", len(entries))
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() failed: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("key file mode = %v, expected 0600", info.Mode().Perm())
+	}
+}
+
+func TestReadOrCreateSecretRejectsShortFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.salt")
+	for _, data := range [][]byte{{}, {1, 2, 3}} {
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readOrCreateSecret(path, 16, true); err == nil {
+			t.Errorf("readOrCreateSecret() with a %d byte file succeeded, expected an error", len(data))
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CurrentSchemaVersion is the session schema version written by this build.
+// Bump it together with a new entry in migrations whenever the on-disk
+// format changes in a way older sessions need to be upgraded for.
+const CurrentSchemaVersion = 1
+
+// ErrUnsupportedSchema is returned when a session was written by a newer
+// version of pplx. Such sessions are refused rather than loaded and saved
+// back without the fields this build does not know about.
+var ErrUnsupportedSchema = errors.New("unsupported session schema version")
+
+// Migration upgrades a raw session document from schema version From to
+// From+1. Migrations operate on the decoded JSON object so they can rename
+// or restructure fields the current Session type no longer has.
+type Migration struct {
+	From        int
+	Description string
+	Apply       func(doc map[string]interface{}) error
+}
+
+// migrations is the ordered registry of schema migrations, one per version
+var migrations = []Migration{
+	{From: 0, Description: "generate short_id from created_at", Apply: migrateShortID},
+}
+
+// PendingMigrations returns the migrations needed to bring a session at the
+// given schema version up to CurrentSchemaVersion, in order
+func PendingMigrations(version int) []Migration {
+	var pending []Migration
+	for _, m := range migrations {
+		if m.From >= version {
+			pending = append(pending, m)
+		}
+	}
+	return pending
+}
+
+// schemaVersion returns the schema version of a raw session document.
+// Sessions written before versioning was introduced are version 0.
+func schemaVersion(doc map[string]interface{}) int {
+	if v, ok := doc["schema_version"].(float64); ok {
+		return int(v)
+	}
+	return 0
+}
+
+// migrateDocument applies all pending migrations to doc in place and returns
+// the version it started at
+func migrateDocument(doc map[string]interface{}) (int, error) {
+	from := schemaVersion(doc)
+	if from > CurrentSchemaVersion {
+		return from, fmt.Errorf("%w: session uses version %d but this build supports up to %d; upgrade pplx to open it",
+			ErrUnsupportedSchema, from, CurrentSchemaVersion)
+	}
+
+	for _, m := range PendingMigrations(from) {
+		if err := m.Apply(doc); err != nil {
+			return from, fmt.Errorf("migration from version %d (%s) failed: %w", m.From, m.Description, err)
+		}
+		doc["schema_version"] = float64(m.From + 1)
+	}
+
+	return from, nil
+}
+
+// decodeSession decodes raw session JSON, migrating it to the current schema
+// in memory. The schema version the data was stored with is recorded on the
+// session so callers can persist the migration.
+func decodeSession(data []byte) (*Session, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal session: %w", err)
+	}
+
+	from, err := migrateDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	if from < CurrentSchemaVersion {
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, fmt.Errorf("failed to marshal migrated session: %w", err)
+		}
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal session: %w", err)
+	}
+	session.storedVersion = from
+
+	return &session, nil
+}
+
+// needsMigration reports whether a loaded session must be rewritten: it was
+// stored with an older schema, or lacks a short ID despite a current one
+func (s *Session) needsMigration() bool {
+	return s.storedVersion < CurrentSchemaVersion || s.ShortID == ""
+}
+
+// MigrationReport describes the migration of a single session
+type MigrationReport struct {
+	ID    string
+	From  int
+	Steps []Migration
+	Err   error
+}
+
+// MigrateAll upgrades every stored session to the current schema, backing up
+// each original first. With dryRun set, nothing is written and the reports
+// describe what would be done. Sessions that are already current are not
+// reported.
+func (m *Manager) MigrateAll(dryRun bool) ([]MigrationReport, error) {
+	ids, err := m.store.IDs()
+	if err != nil {
+		return nil, err
+	}
+
+	var reports []MigrationReport
+	for _, id := range ids {
+		report := MigrationReport{ID: id}
+
+		session, err := m.store.Load(id)
+		if err != nil {
+			report.Err = err
+			reports = append(reports, report)
+			continue
+		}
+
+		if !session.needsMigration() {
+			continue
+		}
+
+		report.From = session.storedVersion
+		report.Steps = PendingMigrations(report.From)
+		if !dryRun {
+			report.Err = m.persistMigration(session)
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+// migrateShortID fills in short_id for sessions created before short IDs
+// existed, deriving it from the creation time like new sessions do
+func migrateShortID(doc map[string]interface{}) error {
+	if id, ok := doc["short_id"].(string); ok && id != "" {
+		return nil
+	}
+
+	var createdAt time.Time
+	if metadata, ok := doc["metadata"].(map[string]interface{}); ok {
+		if raw, ok := metadata["created_at"].(string); ok {
+			parsed, err := time.Parse(time.RFC3339Nano, raw)
+			if err != nil {
+				return fmt.Errorf("invalid created_at: %w", err)
+			}
+			createdAt = parsed
+		}
+	}
+
+	doc["short_id"] = GenerateShortID(createdAt)
+	return nil
+}
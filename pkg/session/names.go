@@ -0,0 +1,69 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// maxNameLength caps the length of session names
+const maxNameLength = 64
+
+// namePattern matches valid session names: a letter followed by letters,
+// digits, dots, dashes or underscores. Names cannot start with '@' so they
+// never clash with relative references like @-1.
+var namePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9._-]*$`)
+
+// ErrNameTaken is returned when a session name is already used by another
+// session or collides with a session ID
+var ErrNameTaken = errors.New("session name already in use")
+
+// ValidateName checks that name can be used as a session name
+func ValidateName(name string) error {
+	if len(name) > maxNameLength {
+		return fmt.Errorf("invalid session name %q: longer than %d characters", name, maxNameLength)
+	}
+	if name == LatestRef {
+		return fmt.Errorf("invalid session name %q: reserved for the most recent session", name)
+	}
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid session name %q: must start with a letter and contain only letters, digits, '.', '-' and '_'", name)
+	}
+	return nil
+}
+
+// CheckName reports whether name is valid and free for the session with the
+// given ID. Names must not match another session's name, short ID or ID.
+// Saving a session checks its name again under a lock, so a name found free
+// here can still be refused if another process takes it first.
+func (m *Manager) CheckName(name, id string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+
+	sessions, err := m.store.List()
+	if err != nil {
+		return err
+	}
+
+	for _, info := range sessions {
+		if info.ID == id {
+			continue
+		}
+		if info.Name == name || info.ShortID == name || info.ID == name {
+			return fmt.Errorf("%w: %s (session [%s])", ErrNameTaken, name, info.ShortID)
+		}
+	}
+	return nil
+}
+
+// SetName gives the session with the given ID a unique name, or removes its
+// name if name is empty. The name is checked when the session is saved.
+func (m *Manager) SetName(id, name string) (*Session, error) {
+	return m.Modify(id, func(s *Session) error {
+		s.Metadata.Name = name
+		s.Metadata.UpdatedAt = time.Now()
+		return nil
+	})
+}
@@ -0,0 +1,107 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// LatestRef refers to the most recently created session
+	LatestRef = "latest"
+
+	// minPrefixLength is the shortest short ID prefix that is resolved;
+	// short IDs share their leading characters, so shorter prefixes are
+	// rarely unique
+	minPrefixLength = 4
+
+	// maxCandidates caps the sessions listed in an ambiguous prefix error
+	maxCandidates = 10
+)
+
+// ErrAmbiguousID is returned when a short ID prefix matches several sessions
+var ErrAmbiguousID = errors.New("ambiguous session ID")
+
+// Resolve returns the ID of the session ref refers to. ref may be "latest"
+// or "@-n" for the nth most recent session, a session name, a short ID, a
+// full ID, or a unique prefix of a short or full ID of at least four
+// characters, tried in that order. Names come first because they are
+// checked against existing short IDs only when given, so a short ID
+// generated later may equal a name; the name keeps working.
+func (m *Manager) Resolve(ref string) (string, error) {
+	sessions, err := m.List()
+	if err != nil {
+		return "", err
+	}
+
+	if n, ok := parseRelativeRef(ref); ok {
+		if n > len(sessions) {
+			return "", fmt.Errorf("%w: %s (there are %d sessions)", ErrSessionNotFound, ref, len(sessions))
+		}
+		return sessions[n-1].ID, nil
+	}
+
+	for _, match := range []func(SessionInfo) bool{
+		func(info SessionInfo) bool { return info.Name != "" && info.Name == ref },
+		func(info SessionInfo) bool { return info.ShortID == ref },
+		func(info SessionInfo) bool { return info.ID == ref },
+	} {
+		for _, info := range sessions {
+			if match(info) {
+				return info.ID, nil
+			}
+		}
+	}
+
+	var candidates []SessionInfo
+	if len(ref) >= minPrefixLength {
+		for _, info := range sessions {
+			if strings.HasPrefix(info.ShortID, ref) || strings.HasPrefix(info.ID, ref) {
+				candidates = append(candidates, info)
+			}
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return "", fmt.Errorf("%w: %s", ErrSessionNotFound, ref)
+	case 1:
+		return candidates[0].ID, nil
+	default:
+		return "", ambiguousError(ref, candidates)
+	}
+}
+
+// parseRelativeRef parses "latest" and "@-n" references, returning n
+func parseRelativeRef(ref string) (int, bool) {
+	if ref == LatestRef {
+		return 1, true
+	}
+
+	digits, ok := strings.CutPrefix(ref, "@-")
+	if !ok {
+		return 0, false
+	}
+
+	n, err := strconv.Atoi(digits)
+	if err != nil || n < 1 {
+		return 0, false
+	}
+	return n, true
+}
+
+// ambiguousError lists the sessions matching an ambiguous prefix, newest
+// first
+func ambiguousError(ref string, candidates []SessionInfo) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s matches %d sessions:", ref, len(candidates))
+	for i, info := range candidates {
+		if i == maxCandidates {
+			fmt.Fprintf(&b, "\n  ... and %d more", len(candidates)-maxCandidates)
+			break
+		}
+		fmt.Fprintf(&b, "\n  [%s] %s  %s", info.ShortID, FormatSessionTime(info.CreatedAt), TruncateQuery(info.DisplayTitle(), 50))
+	}
+	return fmt.Errorf("%w: %s", ErrAmbiguousID, b.String())
+}
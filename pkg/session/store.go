@@ -0,0 +1,125 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Supported values of the session_store configuration setting
+const (
+	StoreJSON   = "json"
+	StoreSQLite = "sqlite"
+)
+
+// ErrSessionNotFound is returned by stores when no session has the given ID
+var ErrSessionNotFound = errors.New("session not found")
+
+// Store persists sessions. Stores only read and write; revision checks,
+// schema migration bookkeeping and locking policy live in Manager.
+type Store interface {
+	// Save writes a session, replacing any stored session with the same ID
+	Save(session *Session) error
+	// Load reads a session by its full ID, migrating it to the current
+	// schema in memory. Load never writes.
+	Load(id string) (*Session, error)
+	// Delete removes a session
+	Delete(id string) error
+	// List returns summary information for every readable session, in no
+	// particular order
+	List() ([]SessionInfo, error)
+	// Search returns the sessions matching query, in no particular order
+	Search(query string) ([]SessionInfo, error)
+	// Lock takes an exclusive lock on a session across processes. The lock
+	// is released by calling the returned function.
+	Lock(id string) (func(), error)
+	// Backup keeps a copy of the stored representation of a session before
+	// it is rewritten by a schema migration from the given version
+	Backup(id string, version int) error
+	// RewriteBackups rewrites the backups of a session in the form sessions
+	// are saved in, encrypting or decrypting them to match the session
+	RewriteBackups(id string) error
+	// IDs returns the IDs of all stored sessions, including ones that
+	// cannot be decoded
+	IDs() ([]string, error)
+	// Close releases resources held by the store
+	Close() error
+}
+
+// OpenStore opens the session store of the given kind at its default
+// location. enc may be nil, in which case encrypted sessions cannot be read.
+func OpenStore(kind string, enc *Encryption) (Store, error) {
+	switch kind {
+	case "", StoreJSON:
+		return NewJSONStore(GetSessionsDir(), enc)
+	case StoreSQLite:
+		return NewSQLiteStore(GetSessionsDBPath(), enc)
+	default:
+		return nil, fmt.Errorf("unknown session store %q (expected %q or %q)", kind, StoreJSON, StoreSQLite)
+	}
+}
+
+// CopyStore copies every readable session from src to dst, keeping IDs and
+// revisions. It returns the number of sessions copied and the IDs of
+// sessions that could not be read.
+func CopyStore(dst, src Store) (int, []string, error) {
+	ids, err := src.IDs()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	copied := 0
+	var skipped []string
+	for _, id := range ids {
+		session, err := src.Load(id)
+		if err != nil {
+			Debugf("Skipping session %s: %v", id, err)
+			skipped = append(skipped, id)
+			continue
+		}
+
+		if err := dst.Save(session); err != nil {
+			return copied, skipped, fmt.Errorf("failed to copy session %s: %w", id, err)
+		}
+		copied++
+	}
+
+	return copied, skipped, nil
+}
+
+// matchesQuery reports whether a session matches a search query: an exact
+// short ID or tag, or a case-insensitive substring of the initial query,
+// title, notes, summary or any message
+func matchesQuery(session *Session, query string) bool {
+	if strings.EqualFold(session.ShortID, query) {
+		return true
+	}
+
+	if slices.Contains(session.Metadata.Tags, NormalizeTag(query)) {
+		return true
+	}
+
+	queryLower := strings.ToLower(query)
+	for _, text := range searchableText(session) {
+		if strings.Contains(strings.ToLower(text), queryLower) {
+			return true
+		}
+	}
+	return false
+}
+
+// searchableText returns the free-text fields of a session matched by search
+func searchableText(session *Session) []string {
+	texts := []string{
+		session.Metadata.InitialQuery,
+		session.Metadata.Title,
+		session.Metadata.Name,
+		session.Metadata.Notes,
+		session.Metadata.Summary,
+	}
+	for _, msg := range session.Messages {
+		texts = append(texts, msg.Content)
+	}
+	return texts
+}
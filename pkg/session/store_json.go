@@ -0,0 +1,258 @@
+package session
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// JSONStore stores each session as a JSON file in a directory. Files are
+// private to the user (0600 in a 0700 directory) and optionally encrypted.
+type JSONStore struct {
+	dir string
+	enc *Encryption
+}
+
+// NewJSONStore creates a JSON store in dir, creating the directory if needed
+// and restricting it to the current user. enc may be nil.
+func NewJSONStore(dir string, enc *Encryption) (*JSONStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create sessions directory: %w", err)
+	}
+
+	// Directories created by older versions were world-readable
+	if err := os.Chmod(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to restrict sessions directory: %w", err)
+	}
+	return &JSONStore{dir: dir, enc: enc}, nil
+}
+
+// Dir returns the directory the store writes to
+func (s *JSONStore) Dir() string {
+	return s.dir
+}
+
+func (s *JSONStore) filename(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// Save writes a session atomically (write to temp then rename)
+func (s *JSONStore) Save(session *Session) error {
+	filename := s.filename(session.ID)
+
+	// Ensure directory exists
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create sessions directory: %w", err)
+	}
+
+	// Marshal session to JSON
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+
+	data, err = s.enc.seal(data)
+	if err != nil {
+		return err
+	}
+
+	// Write to a fresh temporary file so it is always created 0600
+	tempFile := filename + ".tmp"
+	os.Remove(tempFile)
+	if err := os.WriteFile(tempFile, data, 0600); err != nil {
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+
+	// Atomic rename
+	if err := os.Rename(tempFile, filename); err != nil {
+		os.Remove(tempFile) // Clean up temp file
+		return fmt.Errorf("failed to rename temp file: %w", err)
+	}
+
+	Debugf("Saved session: %s (revision %d)", filename, session.Revision)
+	return nil
+}
+
+// Load reads a session file by ID
+func (s *JSONStore) Load(id string) (*Session, error) {
+	return s.loadFile(s.filename(id))
+}
+
+// loadFile reads and decodes a session file
+func (s *JSONStore) loadFile(filename string) (*Session, error) {
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, ParseSessionID(filename))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session file: %w", err)
+	}
+
+	data, err = s.enc.open(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(filename), err)
+	}
+
+	session, err := decodeSession(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(filename), err)
+	}
+	return session, nil
+}
+
+// Delete removes a session file and its lock file
+func (s *JSONStore) Delete(id string) error {
+	err := os.Remove(s.filename(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+
+	os.Remove(filepath.Join(s.dir, id+".lock"))
+	return nil
+}
+
+// List decodes every session file in the directory
+func (s *JSONStore) List() ([]SessionInfo, error) {
+	sessions, err := s.loadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]SessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		infos = append(infos, session.ToInfo())
+	}
+	return infos, nil
+}
+
+// Search scans every session file for the query
+func (s *JSONStore) Search(query string) ([]SessionInfo, error) {
+	sessions, err := s.loadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []SessionInfo
+	for _, session := range sessions {
+		if matchesQuery(session, query) {
+			results = append(results, session.ToInfo())
+		}
+	}
+	return results, nil
+}
+
+// loadAll decodes every readable session file, skipping ones that fail
+func (s *JSONStore) loadAll() ([]*Session, error) {
+	ids, err := s.IDs()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]*Session, 0, len(ids))
+	for _, id := range ids {
+		session, err := s.Load(id)
+		if err != nil {
+			Debugf("Failed to load session %s: %v", id, err)
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+// Lock takes an advisory lock on <id>.lock next to the session file
+func (s *JSONStore) Lock(id string) (func(), error) {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create sessions directory: %w", err)
+	}
+	return lockFile(filepath.Join(s.dir, id+".lock"))
+}
+
+// Backup copies a session file to backups/<id>.v<version>.json as stored,
+// so backups of encrypted sessions stay encrypted. Existing backups are
+// never overwritten.
+func (s *JSONStore) Backup(id string, version int) error {
+	data, err := os.ReadFile(s.filename(id))
+	if err != nil {
+		return fmt.Errorf("failed to read session file: %w", err)
+	}
+
+	backupDir := filepath.Join(s.dir, "backups")
+	if err := os.MkdirAll(backupDir, 0700); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	filename := filepath.Join(backupDir, fmt.Sprintf("%s.v%d.json", id, version))
+	if _, err := os.Stat(filename); err == nil {
+		return nil
+	}
+
+	if err := os.WriteFile(filename, data, 0600); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	Debugf("Backed up session %s (schema version %d) to %s", id, version, filename)
+	return nil
+}
+
+// RewriteBackups rewrites the backup files of a session encrypted or in
+// plaintext, like the session file
+func (s *JSONStore) RewriteBackups(id string) error {
+	backups, err := filepath.Glob(filepath.Join(s.dir, "backups", id+".v*.json"))
+	if err != nil {
+		return fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	for _, filename := range backups {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return fmt.Errorf("failed to read backup: %w", err)
+		}
+
+		converted, err := s.enc.convert(data)
+		if err != nil {
+			return fmt.Errorf("failed to convert backup %s: %w", filepath.Base(filename), err)
+		}
+		if bytes.Equal(converted, data) {
+			continue
+		}
+
+		tempFile := filename + ".tmp"
+		os.Remove(tempFile)
+		if err := os.WriteFile(tempFile, converted, 0600); err != nil {
+			return fmt.Errorf("failed to write backup: %w", err)
+		}
+		if err := os.Rename(tempFile, filename); err != nil {
+			os.Remove(tempFile)
+			return fmt.Errorf("failed to replace backup: %w", err)
+		}
+	}
+	return nil
+}
+
+// IDs lists the IDs of all session files in the directory
+func (s *JSONStore) IDs() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sessions directory: %w", err)
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		if entry.IsDir() || !IsValidSessionFile(entry.Name()) {
+			continue
+		}
+		ids = append(ids, ParseSessionID(entry.Name()))
+	}
+	return ids, nil
+}
+
+// Close is a no-op for the JSON store
+func (s *JSONStore) Close() error {
+	return nil
+}
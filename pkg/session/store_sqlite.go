@@ -0,0 +1,434 @@
+package session
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema creates the session tables. Sessions are stored as their JSON
+// document so schema migrations apply exactly as they do for the JSON store;
+// sessions_fts indexes the searchable text with a trigram tokenizer, which
+// gives the same case-insensitive substring matching as the JSON store, and
+// session_tags holds the tags, which search matches exactly.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS sessions (
+	id         TEXT PRIMARY KEY,
+	short_id   TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	data       BLOB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS sessions_short_id ON sessions(short_id);
+CREATE INDEX IF NOT EXISTS sessions_created_at ON sessions(created_at);
+CREATE VIRTUAL TABLE IF NOT EXISTS sessions_fts USING fts5(id UNINDEXED, body, tokenize = 'trigram');
+CREATE TABLE IF NOT EXISTS session_tags (
+	id  TEXT NOT NULL,
+	tag TEXT NOT NULL,
+	PRIMARY KEY (id, tag)
+);
+CREATE INDEX IF NOT EXISTS session_tags_tag ON session_tags(tag);
+CREATE TABLE IF NOT EXISTS session_backups (
+	id      TEXT NOT NULL,
+	version INTEGER NOT NULL,
+	data    BLOB NOT NULL,
+	PRIMARY KEY (id, version)
+);
+`
+
+// sqliteIndexVersion is the layout of the search index, kept in the
+// database's user_version. Databases indexed with an older layout are
+// reindexed when opened. Version 1 moved tags from the full-text body to
+// session_tags.
+const sqliteIndexVersion = 1
+
+// SQLiteStore stores sessions in a single SQLite database with full-text
+// search. Locks are advisory lock files next to the database. Encrypted
+// sessions are not indexed; searches decrypt and scan them instead.
+type SQLiteStore struct {
+	db      *sql.DB
+	lockDir string
+	enc     *Encryption
+}
+
+// NewSQLiteStore opens (and if needed creates) the database at path,
+// restricting it to the current user. enc may be nil.
+func NewSQLiteStore(path string, enc *Encryption) (*SQLiteStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create database directory: %w", err)
+	}
+
+	// SQLite creates its WAL and shared-memory files with the permissions
+	// of the database, so creating it 0600 up front covers all three
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session database: %w", err)
+	}
+	f.Close()
+
+	for _, name := range []string{path, path + "-wal", path + "-shm"} {
+		if err := os.Chmod(name, 0600); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to restrict session database: %w", err)
+		}
+	}
+
+	dsn := "file:" + path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open session database: %w", err)
+	}
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize session database: %w", err)
+	}
+
+	store := &SQLiteStore{db: db, lockDir: path + ".locks", enc: enc}
+	if err := store.upgradeIndex(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// upgradeIndex rebuilds the search index of a database indexed with an
+// older layout than sqliteIndexVersion
+func (s *SQLiteStore) upgradeIndex() error {
+	var version int
+	if err := s.db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return fmt.Errorf("failed to read session database version: %w", err)
+	}
+	if version >= sqliteIndexVersion {
+		return nil
+	}
+
+	sessions, err := s.query(`SELECT id, data FROM sessions WHERE substr(data, 1, ?) != ?`,
+		len(encryptedMagic), encryptedMagic)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, session := range sessions {
+		if err := index(tx, session, true); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, sqliteIndexVersion)); err != nil {
+		return fmt.Errorf("failed to update session database version: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to reindex sessions: %w", err)
+	}
+	return nil
+}
+
+// index replaces the search index entries of a session, leaving it out of
+// the index unless searchable is set
+func index(tx *sql.Tx, session *Session, searchable bool) error {
+	if _, err := tx.Exec(`DELETE FROM sessions_fts WHERE id = ?`, session.ID); err != nil {
+		return fmt.Errorf("failed to update search index: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM session_tags WHERE id = ?`, session.ID); err != nil {
+		return fmt.Errorf("failed to update search index: %w", err)
+	}
+	if !searchable {
+		return nil
+	}
+
+	body := strings.Join(searchableText(session), "\n")
+	if _, err := tx.Exec(`INSERT INTO sessions_fts (id, body) VALUES (?, ?)`, session.ID, body); err != nil {
+		return fmt.Errorf("failed to update search index: %w", err)
+	}
+	for _, tag := range session.Metadata.Tags {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO session_tags (id, tag) VALUES (?, ?)`, session.ID, tag); err != nil {
+			return fmt.Errorf("failed to update search index: %w", err)
+		}
+	}
+	return nil
+}
+
+// Save inserts or replaces a session and its search index entry
+func (s *SQLiteStore) Save(session *Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+
+	data, err = s.enc.seal(data)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT OR REPLACE INTO sessions (id, short_id, created_at, data) VALUES (?, ?, ?, ?)`,
+		session.ID, session.ShortID, session.Metadata.CreatedAt.UnixNano(), data)
+	if err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+
+	// Indexing an encrypted session would store its text in plaintext
+	if err := index(tx, session, !IsEncrypted(data)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit session: %w", err)
+	}
+
+	Debugf("Saved session: %s (revision %d)", session.ID, session.Revision)
+	return nil
+}
+
+// Load reads a session by ID
+func (s *SQLiteStore) Load(id string) (*Session, error) {
+	var data []byte
+	err := s.db.QueryRow(`SELECT data FROM sessions WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+
+	return s.decode(id, data)
+}
+
+// decode decrypts and decodes a stored session document
+func (s *SQLiteStore) decode(id string, data []byte) (*Session, error) {
+	data, err := s.enc.open(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", id, err)
+	}
+
+	session, err := decodeSession(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", id, err)
+	}
+	return session, nil
+}
+
+// Delete removes a session and its search index entry
+func (s *SQLiteStore) Delete(id string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM sessions WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+
+	if err := index(tx, &Session{ID: id}, false); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+
+	os.Remove(filepath.Join(s.lockDir, id+".lock"))
+	return nil
+}
+
+// List decodes every stored session
+func (s *SQLiteStore) List() ([]SessionInfo, error) {
+	sessions, err := s.query(`SELECT id, data FROM sessions`)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]SessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		infos = append(infos, session.ToInfo())
+	}
+	return infos, nil
+}
+
+// Search matches short IDs and tags exactly and everything else through the
+// trigram index, as the JSON store does. Queries shorter than three
+// characters fall back to a full scan of the index, which LIKE handles
+// transparently. Encrypted sessions are not indexed, so they are decrypted
+// and matched one by one.
+func (s *SQLiteStore) Search(query string) ([]SessionInfo, error) {
+	pattern := "%" + escapeLike(query) + "%"
+	indexed, err := s.query(`SELECT id, data FROM sessions
+		WHERE substr(data, 1, ?) != ?
+		  AND (short_id = ? COLLATE NOCASE
+		       OR id IN (SELECT id FROM session_tags WHERE tag = ?)
+		       OR id IN (SELECT id FROM sessions_fts WHERE body LIKE ? ESCAPE '\'))`,
+		len(encryptedMagic), encryptedMagic, query, NormalizeTag(query), pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := s.query(`SELECT id, data FROM sessions WHERE substr(data, 1, ?) = ?`,
+		len(encryptedMagic), encryptedMagic)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []SessionInfo
+	for _, session := range indexed {
+		results = append(results, session.ToInfo())
+	}
+	for _, session := range encrypted {
+		if matchesQuery(session, query) {
+			results = append(results, session.ToInfo())
+		}
+	}
+	return results, nil
+}
+
+// query decodes the sessions returned by a query selecting id and data,
+// skipping sessions that cannot be decoded
+func (s *SQLiteStore) query(q string, args ...interface{}) ([]*Session, error) {
+	rows, err := s.db.Query(q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*Session
+	for rows.Next() {
+		var id string
+		var data []byte
+		if err := rows.Scan(&id, &data); err != nil {
+			return nil, fmt.Errorf("failed to read session: %w", err)
+		}
+
+		session, err := s.decode(id, data)
+		if err != nil {
+			Debugf("Failed to load session %s: %v", id, err)
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// Lock takes an advisory lock on a per-session lock file next to the database
+func (s *SQLiteStore) Lock(id string) (func(), error) {
+	if err := os.MkdirAll(s.lockDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+	return lockFile(filepath.Join(s.lockDir, id+".lock"))
+}
+
+// Backup copies the stored document into session_backups as stored, so
+// backups of encrypted sessions stay encrypted. Existing backups are never
+// overwritten.
+func (s *SQLiteStore) Backup(id string, version int) error {
+	_, err := s.db.Exec(`INSERT OR IGNORE INTO session_backups (id, version, data)
+		SELECT id, ?, data FROM sessions WHERE id = ?`, version, id)
+	if err != nil {
+		return fmt.Errorf("failed to back up session: %w", err)
+	}
+	return nil
+}
+
+// RewriteBackups rewrites the backups of a session in session_backups
+// encrypted or in plaintext, like the session
+func (s *SQLiteStore) RewriteBackups(id string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT version, data FROM session_backups WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to query backups: %w", err)
+	}
+	converted := make(map[int][]byte)
+	for rows.Next() {
+		var version int
+		var data []byte
+		if err := rows.Scan(&version, &data); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read backup: %w", err)
+		}
+		if converted[version], err = s.enc.convert(data); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to convert backup v%d: %w", version, err)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read backups: %w", err)
+	}
+
+	for version, data := range converted {
+		if _, err := tx.Exec(`UPDATE session_backups SET data = ? WHERE id = ? AND version = ?`, data, id, version); err != nil {
+			return fmt.Errorf("failed to rewrite backup: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit backups: %w", err)
+	}
+	return nil
+}
+
+// IDs lists the IDs of all stored sessions
+func (s *SQLiteStore) IDs() ([]string, error) {
+	rows, err := s.db.Query(`SELECT id FROM sessions`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to read session ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Compact rebuilds the database file and truncates the write-ahead log, so
+// pages that held sessions before they were rewritten (for example before
+// encryption) are no longer on disk
+func (s *SQLiteStore) Compact() error {
+	if _, err := s.db.Exec(`VACUUM`); err != nil {
+		return fmt.Errorf("failed to compact session database: %w", err)
+	}
+	if _, err := s.db.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`); err != nil {
+		return fmt.Errorf("failed to checkpoint session database: %w", err)
+	}
+	return nil
+}
+
+// Close closes the database
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// escapeLike escapes the LIKE wildcards in s using \ as the escape character
+func escapeLike(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(s)
+}
@@ -0,0 +1,165 @@
+package session
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"perplexity-cli/pkg/perplexity"
+)
+
+const (
+	// maxTranscriptChars caps the conversation text sent for titling or
+	// summarizing so long sessions do not exceed the model context
+	maxTranscriptChars = 48000
+
+	titlePrompt = "You write titles for saved research conversations. " +
+		"Reply with a title of 5 to 8 words describing the topic of the conversation. " +
+		"Reply with the title only: no quotes, no trailing punctuation, no citations."
+
+	summaryPrompt = "You summarize saved research conversations. " +
+		"Reply with a single paragraph summarizing what was asked and the key conclusions. " +
+		"Do not add citations or information that is not in the conversation."
+
+	contextSummaryPrompt = "You condense the earlier part of a research conversation so it can continue without the full history. " +
+		"You are given the summary so far, if any, and the messages that followed it. " +
+		"Reply with an updated summary that keeps every question asked, the key facts, figures and conclusions, and any open threads. " +
+		"Be concise, do not add citations, and do not add information that is not in the conversation."
+)
+
+// GenerateTitle asks the model for a short title describing the conversation
+func GenerateTitle(client *perplexity.Client, model string, messages []SessionMessage) (string, error) {
+	content, err := complete(client, model, titlePrompt, BuildTranscript(messages, maxTranscriptChars))
+	if err != nil {
+		return "", err
+	}
+
+	title := cleanTitle(content)
+	if title == "" {
+		return "", fmt.Errorf("model returned an empty title")
+	}
+	return title, nil
+}
+
+// GenerateSummary asks the model for a one-paragraph summary of the conversation
+func GenerateSummary(client *perplexity.Client, model string, messages []SessionMessage) (string, error) {
+	content, err := complete(client, model, summaryPrompt, BuildTranscript(messages, maxTranscriptChars))
+	if err != nil {
+		return "", err
+	}
+
+	summary := perplexity.StripCitationMarkers(perplexity.StripReferences(content))
+	if summary == "" {
+		return "", fmt.Errorf("model returned an empty summary")
+	}
+	return summary, nil
+}
+
+// GenerateContextSummary asks the model to extend previous, a summary of
+// earlier messages, so it also covers messages
+func GenerateContextSummary(client *perplexity.Client, model, previous string, messages []SessionMessage) (string, error) {
+	transcript := BuildTranscript(messages, maxTranscriptChars)
+	if transcript == "" {
+		return previous, nil
+	}
+	if previous != "" {
+		transcript = "Summary so far:\n" + previous + "\n\nMessages that followed:\n\n" + transcript
+	}
+
+	content, err := complete(client, model, contextSummaryPrompt, transcript)
+	if err != nil {
+		return "", err
+	}
+
+	summary := perplexity.StripCitationMarkers(perplexity.StripReferences(content))
+	if summary == "" {
+		return "", fmt.Errorf("model returned an empty summary")
+	}
+	return summary, nil
+}
+
+// SetContextSummary stores a context summary covering the first n messages
+func (s *Session) SetContextSummary(summary string, n int) {
+	s.Metadata.ContextSummary = summary
+	s.Metadata.ContextSummaryMessages = n
+}
+
+// IsCompacted reports whether the message at 0-based index i is covered by
+// the context summary
+func (s *Session) IsCompacted(i int) bool {
+	return s.Metadata.ContextSummary != "" && i < s.Metadata.ContextSummaryMessages
+}
+
+// SetSummary stores a summary covering the current messages of the session
+func (s *Session) SetSummary(summary string) {
+	s.Metadata.Summary = summary
+	s.Metadata.SummaryMessages = len(s.Messages)
+	s.Metadata.UpdatedAt = time.Now()
+}
+
+// HasFreshSummary reports whether the cached summary covers every message
+func (s *Session) HasFreshSummary() bool {
+	return s.Metadata.Summary != "" && s.Metadata.SummaryMessages == len(s.Messages)
+}
+
+// complete sends a conversation transcript with a system instruction and
+// returns the model's reply
+func complete(client *perplexity.Client, model, instruction, transcript string) (string, error) {
+	if transcript == "" {
+		return "", fmt.Errorf("conversation is empty")
+	}
+
+	req := &perplexity.ChatCompletionRequest{
+		Model: model,
+		Messages: []perplexity.Message{
+			{Role: "system", Content: instruction},
+			{Role: "user", Content: transcript},
+		},
+	}
+
+	resp, err := client.CreateCompletionWithRequest(req)
+	if err != nil {
+		return "", err
+	}
+
+	parsed := perplexity.ParseResponse(resp)
+	return strings.TrimSpace(parsed.Content), nil
+}
+
+// BuildTranscript renders messages as a plain-text transcript. When the
+// transcript exceeds maxChars, the oldest messages are dropped first.
+func BuildTranscript(messages []SessionMessage, maxChars int) string {
+	entries := make([]string, 0, len(messages))
+	total := 0
+	for i := len(messages) - 1; i >= 0; i-- {
+		msg := messages[i]
+
+		speaker := "User"
+		if msg.Role == "assistant" {
+			speaker = "Assistant"
+		}
+
+		entry := fmt.Sprintf("%s: %s", speaker, strings.TrimSpace(perplexity.StripReferences(msg.Content)))
+		if maxChars > 0 && total+len(entry) > maxChars && len(entries) > 0 {
+			break
+		}
+		entries = append(entries, entry)
+		total += len(entry)
+	}
+
+	// Restore chronological order
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+
+	return strings.Join(entries, "\n\n")
+}
+
+// cleanTitle normalises a model-generated title to a single unquoted line
+func cleanTitle(title string) string {
+	title = perplexity.StripCitationMarkers(strings.SplitN(strings.TrimSpace(title), "\n", 2)[0])
+	title = strings.TrimPrefix(title, "Title:")
+	title = strings.Trim(strings.TrimSpace(title), "\"'`*#")
+	title = strings.TrimRight(title, ".!")
+	return strings.TrimSpace(title)
+}
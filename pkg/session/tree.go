@@ -0,0 +1,77 @@
+package session
+
+import (
+	"fmt"
+	"sort"
+)
+
+// TreeNode is a session together with the sessions forked from it
+type TreeNode struct {
+	Info     SessionInfo
+	Children []*TreeNode
+}
+
+// FindRoot follows parent links from the session with the given ID up to the
+// oldest ancestor that still exists. Missing parents end the walk silently.
+func FindRoot(sessions []SessionInfo, id string) string {
+	byID := make(map[string]SessionInfo, len(sessions))
+	for _, info := range sessions {
+		byID[info.ID] = info
+	}
+
+	current := id
+	seen := map[string]bool{}
+	for !seen[current] {
+		seen[current] = true
+		info, ok := byID[current]
+		if !ok || info.ParentID == "" {
+			break
+		}
+		if _, ok := byID[info.ParentID]; !ok {
+			break
+		}
+		current = info.ParentID
+	}
+	return current
+}
+
+// BuildTree builds the fork tree rooted at rootID from a list of sessions.
+// Children are ordered by creation time, oldest first.
+func BuildTree(sessions []SessionInfo, rootID string) (*TreeNode, error) {
+	children := make(map[string][]SessionInfo)
+	var root *SessionInfo
+	for i := range sessions {
+		info := sessions[i]
+		if info.ID == rootID {
+			root = &sessions[i]
+		}
+		if info.ParentID != "" {
+			children[info.ParentID] = append(children[info.ParentID], info)
+		}
+	}
+
+	if root == nil {
+		return nil, fmt.Errorf("session not found: %s", rootID)
+	}
+
+	visited := map[string]bool{}
+	var build func(info SessionInfo) *TreeNode
+	build = func(info SessionInfo) *TreeNode {
+		visited[info.ID] = true
+		node := &TreeNode{Info: info}
+
+		kids := children[info.ID]
+		sort.Slice(kids, func(i, j int) bool {
+			return kids[i].CreatedAt.Before(kids[j].CreatedAt)
+		})
+		for _, child := range kids {
+			if visited[child.ID] {
+				continue
+			}
+			node.Children = append(node.Children, build(child))
+		}
+		return node
+	}
+
+	return build(*root), nil
+}
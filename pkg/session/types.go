@@ -1,6 +1,10 @@
 package session
 
 import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
 	"time"
 
 	"perplexity-cli/pkg/perplexity"
@@ -11,6 +15,22 @@ type SessionMessage struct {
 	Role      string    `json:"role"`
 	Content   string    `json:"content"`
 	Timestamp time.Time `json:"timestamp"`
+	// Reasoning is the thinking a reasoning model gave before the reply
+	// in Content; it is kept for display and never sent as context
+	Reasoning string `json:"reasoning,omitempty"`
+	// Alternates are earlier versions of the message, oldest first, kept
+	// when a response is regenerated or a question edited and resent
+	Alternates []Alternate `json:"alternates,omitempty"`
+}
+
+// Alternate is an earlier version of a message
+type Alternate struct {
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+	// Reply is the response an edited question received, and
+	// ReplyAlternates the earlier versions of that response
+	Reply           string      `json:"reply,omitempty"`
+	ReplyAlternates []Alternate `json:"reply_alternates,omitempty"`
 }
 
 // SessionMetadata contains metadata about the session
@@ -19,32 +39,87 @@ type SessionMetadata struct {
 	InitialQuery string    `json:"initial_query"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
+	ParentID     string    `json:"parent_id,omitempty"`
+	ForkPoint    int       `json:"fork_point,omitempty"`
+	Title        string    `json:"title,omitempty"`
+	// Name is a unique alias the session can be addressed by instead of
+	// its short ID
+	Name   string   `json:"name,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+	Pinned bool     `json:"pinned,omitempty"`
+	Notes  string   `json:"notes,omitempty"`
+	// Compared holds the IDs of the sessions saved by 'pplx compare' that
+	// answered the same question with other models
+	Compared []string `json:"compared,omitempty"`
+	// Attachments are the absolute paths of files attached to messages
+	Attachments []string `json:"attachments,omitempty"`
+	// Summary is a model-generated summary covering the first
+	// SummaryMessages messages; it is stale once more messages are added
+	Summary         string `json:"summary,omitempty"`
+	SummaryMessages int    `json:"summary_messages,omitempty"`
+	// ContextSummary condenses the first ContextSummaryMessages messages;
+	// it is sent in their place once they no longer fit the context budget
+	ContextSummary         string `json:"context_summary,omitempty"`
+	ContextSummaryMessages int    `json:"context_summary_messages,omitempty"`
 }
 
 // Session represents a conversation session stored as JSON
 type Session struct {
-	ID       string           `json:"id"`
-	ShortID  string           `json:"short_id"`
-	Messages []SessionMessage `json:"messages"`
-	Metadata SessionMetadata  `json:"metadata"`
+	// SchemaVersion is the on-disk format version; see CurrentSchemaVersion
+	SchemaVersion int              `json:"schema_version"`
+	ID            string           `json:"id"`
+	ShortID       string           `json:"short_id"`
+	Messages      []SessionMessage `json:"messages"`
+	Metadata      SessionMetadata  `json:"metadata"`
+	// Revision is incremented on every save and used to detect writes
+	// made by another process since the session was loaded
+	Revision int `json:"revision,omitempty"`
+
+	// storedVersion is the schema version the session was loaded from
+	storedVersion int
+	// unsaved is set on sessions that have never been stored, whose ID
+	// must not belong to an existing session
+	unsaved bool
+	// savedMessages and savedMetadata are the message count and metadata
+	// the session had when it was last loaded or saved, so Rebase can tell
+	// its changes from those made by another process
+	savedMessages int
+	savedMetadata SessionMetadata
 }
 
 // NewSession creates a new session with the given model and initial query
 func NewSession(model, initialQuery string) *Session {
 	now := time.Now()
 	return &Session{
-		ID:       generateSessionID(now),
-		ShortID:  GenerateShortID(now),
-		Messages: make([]SessionMessage, 0),
+		SchemaVersion: CurrentSchemaVersion,
+		ID:            generateSessionID(now),
+		ShortID:       GenerateShortID(now),
+		Messages:      make([]SessionMessage, 0),
 		Metadata: SessionMetadata{
 			Model:        model,
 			InitialQuery: initialQuery,
 			CreatedAt:    now,
 			UpdatedAt:    now,
 		},
+		storedVersion: CurrentSchemaVersion,
+		unsaved:       true,
 	}
 }
 
+// markSaved records the session's messages and metadata as stored
+func (s *Session) markSaved() {
+	s.savedMessages = len(s.Messages)
+	s.savedMetadata = s.Metadata.clone()
+}
+
+// clone returns a copy of md that shares no slices with it
+func (md SessionMetadata) clone() SessionMetadata {
+	md.Tags = slices.Clone(md.Tags)
+	md.Compared = slices.Clone(md.Compared)
+	md.Attachments = slices.Clone(md.Attachments)
+	return md
+}
+
 // AddMessage adds a message to the session
 func (s *Session) AddMessage(role, content string) {
 	s.Messages = append(s.Messages, SessionMessage{
@@ -55,6 +130,13 @@ func (s *Session) AddMessage(role, content string) {
 	s.Metadata.UpdatedAt = time.Now()
 }
 
+// AddReply adds an assistant reply to the session with the reasoning the
+// model gave before it
+func (s *Session) AddReply(content, reasoning string) {
+	s.AddMessage("assistant", content)
+	s.Messages[len(s.Messages)-1].Reasoning = reasoning
+}
+
 // AddPerplexityMessages converts and adds perplexity messages
 func (s *Session) AddPerplexityMessages(messages []perplexity.Message) {
 	for _, msg := range messages {
@@ -82,6 +164,182 @@ func (s *Session) GetLastMessages(n int) []SessionMessage {
 	return s.Messages[len(s.Messages)-n:]
 }
 
+// Fork creates a new session containing the first n messages of s.
+// n is a 1-based message index and must point at an assistant reply, so the
+// fork always ends on a complete exchange and can be continued directly.
+func (s *Session) Fork(n int) (*Session, error) {
+	if n < 1 || n > len(s.Messages) {
+		return nil, fmt.Errorf("fork point %d out of range (session has %d messages)", n, len(s.Messages))
+	}
+	if s.Messages[n-1].Role != "assistant" {
+		return nil, fmt.Errorf("message %d is a %s message; fork at an assistant reply instead", n, s.Messages[n-1].Role)
+	}
+
+	fork := NewSession(s.Metadata.Model, s.Metadata.InitialQuery)
+	fork.Messages = make([]SessionMessage, n)
+	copy(fork.Messages, s.Messages[:n])
+	fork.Metadata.ParentID = s.ID
+	fork.Metadata.ForkPoint = n
+	fork.Metadata.Title = s.Metadata.Title
+	fork.Metadata.Tags = append([]string(nil), s.Metadata.Tags...)
+
+	// The context summary still applies if it covers only copied messages
+	if s.Metadata.ContextSummaryMessages <= n {
+		fork.Metadata.ContextSummary = s.Metadata.ContextSummary
+		fork.Metadata.ContextSummaryMessages = s.Metadata.ContextSummaryMessages
+	}
+
+	return fork, nil
+}
+
+// RemoveLastExchange removes the latest user message and everything after
+// it, dropping summaries that covered the removed messages. It returns the
+// removed user message, or false if the session has none.
+func (s *Session) RemoveLastExchange() (SessionMessage, bool) {
+	for i := len(s.Messages) - 1; i >= 0; i-- {
+		if s.Messages[i].Role != "user" {
+			continue
+		}
+
+		removed := s.Messages[i]
+		s.Messages = s.Messages[:i]
+		if s.Metadata.SummaryMessages > i {
+			s.Metadata.Summary = ""
+			s.Metadata.SummaryMessages = 0
+		}
+		if s.Metadata.ContextSummaryMessages > i {
+			s.SetContextSummary("", 0)
+		}
+		s.Metadata.UpdatedAt = time.Now()
+		return removed, true
+	}
+	return SessionMessage{}, false
+}
+
+// LastExchange returns a copy of the latest user message and the messages
+// after it, or nil if the session has no user message
+func (s *Session) LastExchange() []SessionMessage {
+	for i := len(s.Messages) - 1; i >= 0; i-- {
+		if s.Messages[i].Role == "user" {
+			return append([]SessionMessage(nil), s.Messages[i:]...)
+		}
+	}
+	return nil
+}
+
+// KeepAlternates records replaced, an exchange removed with
+// RemoveLastExchange and asked again, as alternates of the latest exchange.
+// If the question is unchanged, the previous response becomes an alternate
+// of the new response; if it was edited, the previous question and its
+// response become an alternate of the new question.
+func (s *Session) KeepAlternates(replaced []SessionMessage) {
+	exchange := len(s.Messages) - len(s.LastExchange())
+	if exchange == len(s.Messages) || len(replaced) == 0 {
+		return
+	}
+
+	question := &s.Messages[exchange]
+	previous := replaced[0]
+	var reply *SessionMessage
+	if exchange+1 < len(s.Messages) {
+		reply = &s.Messages[exchange+1]
+	}
+	var previousReply *SessionMessage
+	if len(replaced) > 1 {
+		previousReply = &replaced[1]
+	}
+
+	if question.Content == previous.Content {
+		question.Alternates = previous.Alternates
+		if reply != nil && previousReply != nil {
+			reply.Alternates = append(append([]Alternate(nil), previousReply.Alternates...),
+				Alternate{Content: previousReply.Content, Timestamp: previousReply.Timestamp})
+		}
+	} else {
+		alternate := Alternate{Content: previous.Content, Timestamp: previous.Timestamp}
+		if previousReply != nil {
+			alternate.Reply = previousReply.Content
+			alternate.ReplyAlternates = previousReply.Alternates
+		}
+		question.Alternates = append(append([]Alternate(nil), previous.Alternates...), alternate)
+	}
+	s.Metadata.UpdatedAt = time.Now()
+}
+
+// IsFork reports whether the session was forked from another session
+func (s *Session) IsFork() bool {
+	return s.Metadata.ParentID != ""
+}
+
+// SetTitle sets the session title; an empty title clears it
+func (s *Session) SetTitle(title string) {
+	s.Metadata.Title = strings.TrimSpace(title)
+	s.Metadata.UpdatedAt = time.Now()
+}
+
+// AddAttachments records the paths of attached files, ignoring duplicates
+func (s *Session) AddAttachments(paths ...string) {
+	for _, path := range paths {
+		if !slices.Contains(s.Metadata.Attachments, path) {
+			s.Metadata.Attachments = append(s.Metadata.Attachments, path)
+		}
+	}
+	s.Metadata.UpdatedAt = time.Now()
+}
+
+// LinkCompared records in each session the IDs of the others, which
+// answered the same question with other models
+func LinkCompared(sessions []*Session) {
+	for _, s := range sessions {
+		s.Metadata.Compared = nil
+		for _, other := range sessions {
+			if other != s {
+				s.Metadata.Compared = append(s.Metadata.Compared, other.ID)
+			}
+		}
+		s.Metadata.UpdatedAt = time.Now()
+	}
+}
+
+// AddTags adds tags to the session, ignoring duplicates
+func (s *Session) AddTags(tags ...string) {
+	for _, tag := range tags {
+		tag = NormalizeTag(tag)
+		if tag != "" && !slices.Contains(s.Metadata.Tags, tag) {
+			s.Metadata.Tags = append(s.Metadata.Tags, tag)
+		}
+	}
+	sort.Strings(s.Metadata.Tags)
+	s.Metadata.UpdatedAt = time.Now()
+}
+
+// RemoveTags removes tags from the session
+func (s *Session) RemoveTags(tags ...string) {
+	kept := s.Metadata.Tags[:0]
+	for _, existing := range s.Metadata.Tags {
+		remove := false
+		for _, tag := range tags {
+			if existing == NormalizeTag(tag) {
+				remove = true
+				break
+			}
+		}
+		if !remove {
+			kept = append(kept, existing)
+		}
+	}
+	if len(kept) == 0 {
+		kept = nil
+	}
+	s.Metadata.Tags = kept
+	s.Metadata.UpdatedAt = time.Now()
+}
+
+// NormalizeTag lowercases a tag and strips surrounding whitespace and a leading #
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
+
 // SessionInfo represents summary information for listing sessions
 type SessionInfo struct {
 	ID           string    `json:"id"`
@@ -89,6 +347,31 @@ type SessionInfo struct {
 	CreatedAt    time.Time `json:"created_at"`
 	InitialQuery string    `json:"initial_query"`
 	MessageCount int       `json:"message_count"`
+	ParentID     string    `json:"parent_id,omitempty"`
+	ForkPoint    int       `json:"fork_point,omitempty"`
+	Title        string    `json:"title,omitempty"`
+	Name         string    `json:"name,omitempty"`
+	Tags         []string  `json:"tags,omitempty"`
+	Pinned       bool      `json:"pinned,omitempty"`
+	Summary      string    `json:"summary,omitempty"`
+}
+
+// DisplayTitle returns the session title, falling back to the initial query
+func (i SessionInfo) DisplayTitle() string {
+	if i.Title != "" {
+		return i.Title
+	}
+	return i.InitialQuery
+}
+
+// HasTags reports whether the session carries every one of the given tags
+func (i SessionInfo) HasTags(tags []string) bool {
+	for _, tag := range tags {
+		if !slices.Contains(i.Tags, NormalizeTag(tag)) {
+			return false
+		}
+	}
+	return true
 }
 
 // ToInfo converts a Session to SessionInfo
@@ -99,5 +382,12 @@ func (s *Session) ToInfo() SessionInfo {
 		CreatedAt:    s.Metadata.CreatedAt,
 		InitialQuery: s.Metadata.InitialQuery,
 		MessageCount: len(s.Messages),
+		ParentID:     s.Metadata.ParentID,
+		ForkPoint:    s.Metadata.ForkPoint,
+		Title:        s.Metadata.Title,
+		Name:         s.Metadata.Name,
+		Tags:         s.Metadata.Tags,
+		Pinned:       s.Metadata.Pinned,
+		Summary:      s.Metadata.Summary,
 	}
 }
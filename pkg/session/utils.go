@@ -2,6 +2,7 @@ package session
 
 import (
 	"fmt"
+	"math/rand/v2"
 	"os"
 	"path/filepath"
 	"time"
@@ -17,10 +18,41 @@ func GetSessionsDir() string {
 	return filepath.Join(home, ".pplx", "sessions")
 }
 
+// GetSessionsDBPath returns the path of the SQLite session database
+func GetSessionsDBPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		// Fallback to current directory if can't get home
+		return ".pplx/sessions.db"
+	}
+	return filepath.Join(home, ".pplx", "sessions.db")
+}
+
+// GetSessionKeyPath returns the path of the generated session encryption key
+func GetSessionKeyPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		// Fallback to current directory if can't get home
+		return ".pplx/session.key"
+	}
+	return filepath.Join(home, ".pplx", "session.key")
+}
+
+// GetSessionSaltPath returns the path of the salt used to derive session
+// encryption keys from a passphrase
+func GetSessionSaltPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		// Fallback to current directory if can't get home
+		return ".pplx/session.salt"
+	}
+	return filepath.Join(home, ".pplx", "session.salt")
+}
+
 // EnsureSessionsDir creates the sessions directory if it doesn't exist
 func EnsureSessionsDir() error {
 	sessionsDir := GetSessionsDir()
-	return os.MkdirAll(sessionsDir, 0755)
+	return os.MkdirAll(sessionsDir, 0700)
 }
 
 // generateSessionID generates a unique session ID based on timestamp
@@ -102,6 +134,27 @@ func encodeBase62(n int64) string {
 	return string(result)
 }
 
+// idSuffixLength is the number of random Base62 characters appended to the
+// IDs of a session created in the same millisecond as an existing one
+const idSuffixLength = 4
+
+// randomBase62 returns n random Base62 characters
+func randomBase62(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = base62Chars[rand.IntN(len(base62Chars))]
+	}
+	return string(b)
+}
+
+// reassignID gives a session whose ID collided with an existing session a
+// new ID and short ID carrying the same random suffix
+func (s *Session) reassignID() {
+	suffix := randomBase62(idSuffixLength)
+	s.ID = generateSessionID(s.Metadata.CreatedAt) + "-" + suffix
+	s.ShortID = GenerateShortID(s.Metadata.CreatedAt) + suffix
+}
+
 // GenerateShortID generates a short, unique session ID using Base62-encoded Unix timestamp
 // The ID is based on Unix timestamp in milliseconds, ensuring uniqueness and monotonic ordering
 func GenerateShortID(t time.Time) string {
@@ -0,0 +1,404 @@
+// Package templates loads prompt templates from ~/.pplx/templates. A
+// template is a Markdown file whose body is a Go text/template with named
+// variables, such as {{.id}}, and whose optional YAML front matter sets the
+// model, search filters, system prompt and output format, so a template
+// fully describes a repeatable query.
+package templates
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"go.yaml.in/yaml/v3"
+	"perplexity-cli/pkg/config"
+)
+
+// Ext is the file extension of templates
+const Ext = ".md"
+
+// ErrNotFound is returned when no template has the given name
+var ErrNotFound = errors.New("template not found")
+
+// Formats are the output formats a template can set
+var Formats = []string{"markdown", "plain", "json"}
+
+// validName matches template names, which are also file names
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// Settings are the front matter of a template. Empty settings leave the
+// configuration unchanged.
+type Settings struct {
+	Description  string `yaml:"description"`
+	Model        string `yaml:"model"`
+	SystemPrompt string `yaml:"system_prompt"`
+	SearchMode   string `yaml:"search_mode"`
+	// SearchDomainFilter limits web search to these domains; a domain
+	// starting with - is excluded instead
+	SearchDomainFilter  []string `yaml:"search_domain_filter"`
+	SearchRecencyFilter string   `yaml:"search_recency_filter"`
+	// Format is how the answer is printed: markdown, plain or json
+	Format string `yaml:"format"`
+	// Vars holds default values of variables
+	Vars map[string]string `yaml:"vars"`
+}
+
+// Template is a parsed prompt template
+type Template struct {
+	Name string
+	Path string
+	Settings
+	// Body is the template text after the front matter
+	Body string
+
+	tmpl *template.Template
+}
+
+// Dir returns the directory templates are read from
+func Dir() string {
+	return filepath.Join(config.GetConfigDir(), "templates")
+}
+
+// Path returns the file of the template called name in dir
+func Path(dir, name string) string {
+	return filepath.Join(dir, name+Ext)
+}
+
+// CheckName returns an error if name cannot be used as a template name
+func CheckName(name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid template name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+// Load reads the template called name from dir
+func Load(dir, name string) (*Template, error) {
+	if err := CheckName(name); err != nil {
+		return nil, err
+	}
+
+	path := Path(dir, name)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s (looked for %s)", ErrNotFound, name, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template: %w", err)
+	}
+
+	t, err := Parse(name, string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	t.Path = path
+	return t, nil
+}
+
+// List reads the templates in dir, sorted by name. A missing directory has
+// no templates; files that fail to parse are returned in errs.
+func List(dir string) (list []*Template, errs []error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, []error{fmt.Errorf("failed to read templates: %w", err)}
+	}
+
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), Ext)
+		if !ok || entry.IsDir() || CheckName(name) != nil {
+			continue
+		}
+		t, err := Load(dir, name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, errs
+}
+
+// Parse parses a template from its file content
+func Parse(name, content string) (*Template, error) {
+	front, body, err := splitFrontMatter(content)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Template{Name: name, Body: body}
+	if front != "" {
+		dec := yaml.NewDecoder(strings.NewReader(front))
+		dec.KnownFields(true)
+		if err := dec.Decode(&t.Settings); err != nil {
+			return nil, fmt.Errorf("invalid front matter: %w", err)
+		}
+	}
+	if t.Format != "" && !slices.Contains(Formats, t.Format) {
+		return nil, fmt.Errorf("invalid front matter: format must be one of %s", strings.Join(Formats, ", "))
+	}
+
+	if strings.TrimSpace(body) == "" {
+		return nil, fmt.Errorf("the template has no prompt after its front matter")
+	}
+	t.tmpl, err = template.New(name).Option("missingkey=error").Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	return t, nil
+}
+
+// splitFrontMatter splits content into the YAML between its leading ---
+// lines, if any, and the rest
+func splitFrontMatter(content string) (string, string, error) {
+	content = strings.TrimPrefix(content, "\ufeff")
+	first, rest, _ := strings.Cut(content, "\n")
+	if strings.TrimSpace(first) != "---" {
+		return "", content, nil
+	}
+
+	var front []string
+	for len(rest) > 0 {
+		var line string
+		line, rest, _ = strings.Cut(rest, "\n")
+		if strings.TrimSpace(line) == "---" {
+			return strings.Join(front, "\n"), rest, nil
+		}
+		front = append(front, line)
+	}
+	return "", "", fmt.Errorf("the front matter is not closed with a --- line")
+}
+
+// Variables returns the names of the variables the template uses, sorted.
+// The bodies of define and block templates it calls with its data count too.
+func (t *Template) Variables() []string {
+	w := &walker{tmpl: t.tmpl, seen: make(map[string]bool), called: make(map[string]bool)}
+	w.walk(t.tmpl.Tree.Root, true)
+
+	names := make([]string, 0, len(w.seen))
+	for name := range w.seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// walker collects the variables used in a template and the templates it
+// calls
+type walker struct {
+	tmpl *template.Template
+	// seen holds the variables found so far
+	seen map[string]bool
+	// called holds the templates already walked, so recursive templates
+	// are walked once
+	called map[string]bool
+}
+
+// walk adds the variables used in node to seen. fields is false inside
+// range and with blocks, where fields refer to the value they iterate or
+// bind rather than to variables; $.name still refers to a variable there.
+// Their else branches run with the template's data, like the rest of it.
+func (w *walker) walk(node parse.Node, fields bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			w.walk(child, fields)
+		}
+	case *parse.ActionNode:
+		w.walk(n.Pipe, fields)
+	case *parse.TemplateNode:
+		w.walk(n.Pipe, fields)
+		w.call(n, fields)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			w.walk(cmd, fields)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			w.walk(arg, fields)
+		}
+	case *parse.FieldNode:
+		if fields {
+			w.seen[n.Ident[0]] = true
+		}
+	case *parse.VariableNode:
+		// $.name refers to a variable from anywhere in the template
+		if n.Ident[0] == "$" && len(n.Ident) > 1 {
+			w.seen[n.Ident[1]] = true
+		}
+	case *parse.IfNode:
+		w.walk(n.Pipe, fields)
+		w.walk(n.List, fields)
+		w.walk(n.ElseList, fields)
+	case *parse.RangeNode:
+		w.walk(n.Pipe, fields)
+		w.walk(n.List, false)
+		w.walk(n.ElseList, fields)
+	case *parse.WithNode:
+		w.walk(n.Pipe, fields)
+		w.walk(n.List, false)
+		w.walk(n.ElseList, fields)
+	}
+}
+
+// call walks the body of the template n calls if n passes it the
+// template's data, as {{template "name" .}} and {{block "name" .}} do
+// outside range and with blocks, or as {{template "name" $}} does anywhere.
+// Templates called with other data use no variables, since both their
+// fields and $ refer to that data.
+func (w *walker) call(n *parse.TemplateNode, fields bool) {
+	if !passesData(n.Pipe, fields) || w.called[n.Name] {
+		return
+	}
+	w.called[n.Name] = true
+
+	if called := w.tmpl.Lookup(n.Name); called != nil && called.Tree != nil {
+		w.walk(called.Tree.Root, true)
+	}
+}
+
+// passesData reports whether pipe evaluates to the template's data: $, or
+// . where dot has not been rebound
+func passesData(pipe *parse.PipeNode, fields bool) bool {
+	if pipe == nil || len(pipe.Decl) > 0 || len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		return false
+	}
+	switch arg := pipe.Cmds[0].Args[0].(type) {
+	case *parse.DotNode:
+		return fields
+	case *parse.VariableNode:
+		return len(arg.Ident) == 1 && arg.Ident[0] == "$"
+	}
+	return false
+}
+
+// Render executes the template with vars over the template's defaults. It
+// fails if a variable the template uses has no value, or if vars sets one
+// it neither uses nor declares, which is most likely misspelt.
+func (t *Template) Render(vars map[string]string) (string, error) {
+	data := make(map[string]string, len(t.Vars)+len(vars))
+	for name, value := range t.Vars {
+		data[name] = value
+	}
+
+	used := t.Variables()
+	var unknown []string
+	for name, value := range vars {
+		if _, declared := t.Vars[name]; !declared && !slices.Contains(used, name) {
+			unknown = append(unknown, name)
+		}
+		data[name] = value
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return "", fmt.Errorf("template %s has no variable %s (it uses: %s)",
+			t.Name, strings.Join(unknown, ", "), listOrNone(used))
+	}
+
+	var missing []string
+	for _, name := range used {
+		if _, ok := data[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("template %s needs a value for %s", t.Name, strings.Join(missing, ", "))
+	}
+
+	var b bytes.Buffer
+	if err := t.tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render template %s: %w", t.Name, err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// Apply sets the configuration given in the template's front matter on cfg.
+// The model is not part of the configuration passed to requests, so it is
+// left to the caller.
+func (t *Template) Apply(cfg *config.Config) {
+	if t.SystemPrompt != "" {
+		cfg.SystemPrompt = strings.TrimSpace(t.SystemPrompt)
+	}
+	if t.SearchMode != "" {
+		cfg.SearchMode = t.SearchMode
+	}
+	if len(t.SearchDomainFilter) > 0 {
+		cfg.SearchDomainFilter = t.SearchDomainFilter
+	}
+	if t.SearchRecencyFilter != "" {
+		cfg.SearchRecencyFilter = t.SearchRecencyFilter
+	}
+}
+
+// skeleton is the content of a new template
+const skeleton = `---
+description:
+# Settings below override the configuration when the template is used;
+# remove the ones you do not need.
+# model: sonar-pro
+# system_prompt: You are a concise technical writer.
+# search_mode: web
+# search_domain_filter: [go.dev, pkg.go.dev]
+# search_recency_filter: month
+# format: markdown
+# Default values of variables; variables without one must be given with --var
+# vars:
+#   audience: engineers
+---
+Write the prompt here. Variables such as {{.topic}} are set with
+--var topic=value.
+`
+
+// New creates the template called name in dir with an example front matter,
+// and returns its path. It fails if the template exists.
+func New(dir, name string) (string, error) {
+	if err := CheckName(name); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create templates directory: %w", err)
+	}
+
+	path := Path(dir, name)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if os.IsExist(err) {
+		return "", fmt.Errorf("template %s already exists: %s", name, path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to create template: %w", err)
+	}
+
+	_, err = f.WriteString(skeleton)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write template: %w", err)
+	}
+	return path, nil
+}
+
+// listOrNone joins names with commas, or returns "none"
+func listOrNone(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,230 @@
+package templates
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"perplexity-cli/pkg/config"
+)
+
+const cveTemplate = `---
+description: Summarize a CVE
+model: sonar-pro
+system_prompt: You are a security analyst.
+search_domain_filter: [nvd.nist.gov, -reddit.com]
+search_recency_filter: month
+format: plain
+vars:
+  audience: engineers
+---
+Summarize {{.id}} for {{.audience}}.
+{{if .extra}}Also cover {{.extra}}.{{end}}
+{{range .list}}{{.Ignored}}{{end}}{{$.tail}}
+`
+
+func TestParse(t *testing.T) {
+	tmpl, err := Parse("cve", cveTemplate)
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+
+	if tmpl.Model != "sonar-pro" || tmpl.Format != "plain" || tmpl.SearchRecencyFilter != "month" {
+		t.Errorf("Parse() settings = %+v", tmpl.Settings)
+	}
+	if !reflect.DeepEqual(tmpl.SearchDomainFilter, []string{"nvd.nist.gov", "-reddit.com"}) {
+		t.Errorf("SearchDomainFilter = %q", tmpl.SearchDomainFilter)
+	}
+	if !strings.HasPrefix(tmpl.Body, "Summarize") {
+		t.Errorf("Body = %q, expected the text after the front matter", tmpl.Body)
+	}
+
+	// Fields inside range refer to the item, not to variables
+	expected := []string{"audience", "extra", "id", "list", "tail"}
+	if vars := tmpl.Variables(); !reflect.DeepEqual(vars, expected) {
+		t.Errorf("Variables() = %q, expected %q", vars, expected)
+	}
+
+	plain, err := Parse("plain", "Explain {{.topic}}")
+	if err != nil {
+		t.Fatalf("Parse() without front matter failed: %v", err)
+	}
+	if plain.Body != "Explain {{.topic}}" || plain.Model != "" {
+		t.Errorf("Parse() without front matter = %+v", plain)
+	}
+}
+
+func TestVariables(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected []string
+	}{
+		{"range else", "{{range .items}}{{.Name}}{{else}}No {{.fallback}}{{end}}", []string{"fallback", "items"}},
+		{"with else", "{{with .topic}}{{.Title}}{{else}}{{.default}}{{end}}", []string{"default", "topic"}},
+		{"template", `{{define "quote"}}> {{.}}{{end}}{{template "quote" .text}}`, []string{"text"}},
+		{"root inside range", "{{range .items}}{{.Name}}{{$.sep}}{{end}}", []string{"items", "sep"}},
+		{"define", `{{define "a"}}Hi {{.who}}{{end}}{{template "a" .}} about {{.topic}}`, []string{"topic", "who"}},
+		{"block", `{{block "intro" .}}Dear {{.name}},{{end}} {{.body}}`, []string{"body", "name"}},
+		{"define inside range", `{{define "item"}}{{.Name}} {{$.sep}}{{end}}{{range .items}}{{template "item" .}}{{template "item" $}}{{end}}`, []string{"Name", "items", "sep"}},
+		{"recursive", `{{define "r"}}{{.x}}{{if .more}}{{template "r" .}}{{end}}{{end}}{{template "r" .}}`, []string{"more", "x"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := Parse(tt.name, tt.body)
+			if err != nil {
+				t.Fatalf("Parse() failed: %v", err)
+			}
+			if vars := tmpl.Variables(); !reflect.DeepEqual(vars, tt.expected) {
+				t.Errorf("Variables() = %q, expected %q", vars, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"unclosed front matter", "---\nmodel: sonar\nAsk", "not closed"},
+		{"unknown key", "---\nmodle: sonar\n---\nAsk", "field modle not found"},
+		{"bad format", "---\nformat: html\n---\nAsk", "format must be one of"},
+		{"empty body", "---\nmodel: sonar\n---\n\n", "no prompt"},
+		{"bad syntax", "Ask {{.id", "invalid template"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse("bad", tt.content)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Parse() error = %v, expected %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	tmpl, err := Parse("cve", "---\nvars:\n  audience: engineers\n  extra: \"\"\n---\nSummarize {{.id}} for {{.audience}}.{{if .extra}} Also {{.extra}}.{{end}}\n")
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		vars     map[string]string
+		expected string
+		err      string
+	}{
+		{
+			name:     "defaults",
+			vars:     map[string]string{"id": "CVE-2024-3094"},
+			expected: "Summarize CVE-2024-3094 for engineers.",
+		},
+		{
+			name:     "overrides",
+			vars:     map[string]string{"id": "CVE-2024-3094", "audience": "managers", "extra": "detection"},
+			expected: "Summarize CVE-2024-3094 for managers. Also detection.",
+		},
+		{
+			name: "missing",
+			vars: nil,
+			err:  "needs a value for id",
+		},
+		{
+			name: "misspelt",
+			vars: map[string]string{"id": "x", "audiense": "managers"},
+			err:  "has no variable audiense",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tmpl.Render(tt.vars)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("Render() error = %v, expected %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Render() failed: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Render() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	tmpl, err := Parse("cve", cveTemplate)
+	if err != nil {
+		t.Fatalf("Parse() failed: %v", err)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.SystemPrompt = "configured"
+	tmpl.Apply(cfg)
+	if cfg.SystemPrompt != "You are a security analyst." || cfg.SearchRecencyFilter != "month" || len(cfg.SearchDomainFilter) != 2 {
+		t.Errorf("Apply() config = %+v", cfg)
+	}
+	if cfg.SearchMode != "web" {
+		t.Errorf("Apply() changed search_mode to %q, which the template does not set", cfg.SearchMode)
+	}
+}
+
+func TestNewLoadList(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "templates")
+
+	path, err := New(dir, "digest")
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	if _, err := New(dir, "digest"); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("New() over an existing template error = %v", err)
+	}
+	if _, err := New(dir, "../escape"); err == nil {
+		t.Error("New() accepted a name with a path separator")
+	}
+
+	// The skeleton is a usable template
+	tmpl, err := Load(dir, "digest")
+	if err != nil {
+		t.Fatalf("Load() of a new template failed: %v", err)
+	}
+	if tmpl.Path != path || !reflect.DeepEqual(tmpl.Variables(), []string{"topic"}) {
+		t.Errorf("Load() = %+v with variables %q", tmpl, tmpl.Variables())
+	}
+
+	if _, err := Load(dir, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Load(missing) error = %v, expected ErrNotFound", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "broken.md"), []byte("---\nformat: html\n---\nAsk"), 0600); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a template"), 0600); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ask.md"), []byte("Ask {{.q}}"), 0600); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+
+	list, errs := List(dir)
+	if len(list) != 2 || list[0].Name != "ask" || list[1].Name != "digest" {
+		t.Errorf("List() = %d templates, expected ask and digest", len(list))
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "broken.md") {
+		t.Errorf("List() errors = %v, expected one for broken.md", errs)
+	}
+
+	if list, errs := List(filepath.Join(dir, "missing")); len(list) != 0 || len(errs) != 0 {
+		t.Errorf("List(missing dir) = %v, %v", list, errs)
+	}
+}
@@ -18,6 +18,7 @@ var (
 	Magenta = color.New(color.FgMagenta).SprintFunc()
 	White   = color.New(color.FgWhite).SprintFunc()
 	Bold    = color.New(color.Bold).SprintFunc()
+	Faint   = color.New(color.Faint).SprintFunc()
 
 	// Specific use colors
 	PromptColor  = color.New(color.FgCyan, color.Bold).SprintFunc()
@@ -68,6 +69,16 @@ func PrintPrompt(text string) string {
 	return PromptColor(text)
 }
 
+// PrintReasoning prints the reasoning of a response dimmed, to go before
+// its answer; it prints nothing when there is no reasoning
+func PrintReasoning(reasoning string) {
+	if reasoning == "" {
+		return
+	}
+	fmt.Println(Faint("Reasoning:\n" + reasoning))
+	fmt.Println()
+}
+
 // PrintSeparator prints a colored separator line
 func PrintSeparator(colorFunc func(...interface{}) string) {
 	fmt.Println(colorFunc(strings.Repeat("─", 60)))
@@ -4,6 +4,7 @@ import (
 	"perplexity-cli/pkg/config"
 
 	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/lipgloss"
 )
 
 func RenderMarkdown(content string, cfg *config.Config) (string, error) {
@@ -66,3 +67,27 @@ func RenderMarkdownAlways(content string, cfg *config.Config) string {
 
 	return rendered
 }
+
+// ResolveStyle returns the configured glamour style with "auto" replaced by
+// "dark" or "light" for the terminal background. Full-screen programs call
+// it before they start, since the terminal cannot be queried while they run.
+func ResolveStyle(cfg *config.Config) string {
+	if cfg.GlowStyle != "" && cfg.GlowStyle != "auto" {
+		return cfg.GlowStyle
+	}
+	if lipgloss.HasDarkBackground() {
+		return "dark"
+	}
+	return "light"
+}
+
+// NewRenderer returns a markdown renderer for a standard style that wraps
+// at width columns
+func NewRenderer(style string, width int) (*glamour.TermRenderer, error) {
+	return glamour.NewTermRenderer(
+		glamour.WithEmoji(),
+		glamour.WithPreservedNewLines(),
+		glamour.WithStandardStyle(style),
+		glamour.WithWordWrap(width),
+	)
+}